@@ -0,0 +1,557 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// BITFIELD overflow behaviours
+const (
+	BITFIELD_WRAP = iota
+	BITFIELD_SAT
+	BITFIELD_FAIL
+)
+
+// BITFIELD operations
+const (
+	BITFIELD_GET = iota
+	BITFIELD_SET
+	BITFIELD_INCRBY
+)
+
+// Bitmap commands ------------------------------------------------------------
+func (s *Server) setbit(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'setbit' command")
+	}
+	offset, errResp := parseBitOffset(args[1].Value, false, 0)
+	if errResp != nil {
+		return errResp
+	}
+	if args[2].Value != "0" && args[2].Value != "1" {
+		return ErrResp("ERR bit is not an integer or out of range")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	value, _, errResp := db.getBytes(key)
+	if errResp != nil {
+		return errResp
+	}
+
+	value = growBytes(value, int(offset>>3)+1)
+	old := getBit(value, offset)
+	setBit(value, offset, args[2].Value == "1")
+	db.setValue(key, value)
+	s.Dirty.Add(1)
+	return Integer(old)
+}
+
+func (s *Server) getbit(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'getbit' command")
+	}
+	offset, errResp := parseBitOffset(args[1].Value, false, 0)
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	value, _, errResp := db.getBytes(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if offset>>3 >= int64(len(value)) {
+		return Integer(0)
+	}
+	return Integer(getBit(value, offset))
+}
+
+func (s *Server) bitcount(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'bitcount' command")
+	}
+	if len(args) == 2 || len(args) > 4 {
+		return ErrResp("ERR syntax error")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	value, _, errResp := db.getBytes(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	first, last := int64(0), int64(len(value))*8-1
+	if len(args) > 1 {
+		var ok bool
+		first, last, ok, errResp = parseBitRange(args[1:], len(value))
+		if errResp != nil {
+			return errResp
+		}
+		if !ok {
+			return Integer(0)
+		}
+	}
+
+	count := 0
+	for pos := first; pos <= last; {
+		// Count whole bytes at once
+		if pos&7 == 0 && pos+7 <= last {
+			count += bits.OnesCount8(value[pos>>3])
+			pos += 8
+			continue
+		}
+		count += getBit(value, pos)
+		pos++
+	}
+	return Integer(count)
+}
+
+func (s *Server) bitpos(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'bitpos' command")
+	}
+	if len(args) > 5 {
+		return ErrResp("ERR syntax error")
+	}
+	if args[1].Value != "0" && args[1].Value != "1" {
+		return ErrResp("ERR The bit argument must be 1 or 0.")
+	}
+	bit := int(args[1].Value[0] - '0')
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	value, exists, errResp := db.getBytes(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if !exists {
+		// Missing keys are an empty string of zeroes
+		if bit == 1 {
+			return Integer(-1)
+		}
+		return Integer(0)
+	}
+
+	first, last := int64(0), int64(len(value))*8-1
+	if len(args) > 2 {
+		rangeArgs := args[2:]
+		if len(rangeArgs) == 1 {
+			rangeArgs = append(rangeArgs, BulkString("-1"))
+		}
+		var ok bool
+		first, last, ok, errResp = parseBitRange(rangeArgs, len(value))
+		if errResp != nil {
+			return errResp
+		}
+		if !ok {
+			return Integer(-1)
+		}
+	}
+
+	// Skip whole bytes that can't hold the bit
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xFF
+	}
+	for pos := first; pos <= last; {
+		if pos&7 == 0 && pos+7 <= last && value[pos>>3] == skip {
+			pos += 8
+			continue
+		}
+		if getBit(value, pos) == bit {
+			return Integer(pos)
+		}
+		pos++
+	}
+
+	// Without an end, the zeroes right after the string count
+	if bit == 0 && len(args) < 4 {
+		return Integer(last + 1)
+	}
+	return Integer(-1)
+}
+
+func (s *Server) bitop(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 {
+		return ErrResp("ERR wrong number of arguments for 'bitop' command")
+	}
+	op := strings.ToUpper(args[0].Value)
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(args) != 3 {
+			return ErrResp("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return ErrResp("ERR syntax error")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	sources := make([][]byte, 0, len(args)-2)
+	size := 0
+	for _, key := range args[2:] {
+		value, _, errResp := db.getBytes(key.Value)
+		if errResp != nil {
+			return errResp
+		}
+		sources = append(sources, value)
+		size = max(size, len(value))
+	}
+
+	// Shorter strings are padded with zeroes
+	result := make([]byte, size)
+	for i := range result {
+		b := byteAt(sources[0], i)
+		for _, src := range sources[1:] {
+			switch op {
+			case "AND":
+				b &= byteAt(src, i)
+			case "OR":
+				b |= byteAt(src, i)
+			case "XOR":
+				b ^= byteAt(src, i)
+			}
+		}
+		if op == "NOT" {
+			b = ^b
+		}
+		result[i] = b
+	}
+
+	// The destination is replaced whatever its type, or deleted if the
+	// result is empty
+	dst := args[1].Value
+	if db.typeOf(dst) != "none" || size > 0 {
+		s.Dirty.Add(1)
+	}
+	db.deleteKey(dst)
+	if size > 0 {
+		db.setValue(dst, result)
+	}
+	return Integer(size)
+}
+
+func (s *Server) bitfield(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'bitfield' command")
+	}
+	return s.bitfieldGeneric(db, args, false)
+}
+
+func (s *Server) bitfieldRO(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'bitfield_ro' command")
+	}
+	return s.bitfieldGeneric(db, args, true)
+}
+
+// ----------------------------------------------------------------------------
+
+// Bitmap helpers -------------------------------------------------------------
+// Operation of a BITFIELD command
+type bitfieldOp struct {
+	op       int
+	signed   bool
+	bits     int
+	offset   int64
+	value    int64
+	overflow int
+}
+
+// bitfieldGeneric runs the operations of a BITFIELD command, which are parsed
+// up front so nothing is changed if any of them is invalid. With readOnly only
+// GET is allowed.
+func (s *Server) bitfieldGeneric(db *Database, args []*RESP, readOnly bool) *RESP {
+	ops := []bitfieldOp{}
+	overflow := BITFIELD_WRAP
+	writeEnd := int64(0)
+	for i := 1; i < len(args); i++ {
+		sub := strings.ToUpper(args[i].Value)
+		if sub == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			i++
+			switch strings.ToUpper(args[i].Value) {
+			case "WRAP":
+				overflow = BITFIELD_WRAP
+			case "SAT":
+				overflow = BITFIELD_SAT
+			case "FAIL":
+				overflow = BITFIELD_FAIL
+			default:
+				return ErrResp("ERR Invalid OVERFLOW type specified")
+			}
+			continue
+		}
+
+		op := bitfieldOp{overflow: overflow}
+		argc := 2
+		switch sub {
+		case "GET":
+			op.op = BITFIELD_GET
+		case "SET":
+			op.op, argc = BITFIELD_SET, 3
+		case "INCRBY":
+			op.op, argc = BITFIELD_INCRBY, 3
+		default:
+			return ErrResp("ERR syntax error")
+		}
+		if i+argc >= len(args) {
+			return ErrResp("ERR syntax error")
+		}
+
+		var errResp *RESP
+		op.signed, op.bits, errResp = parseBitfieldType(args[i+1].Value)
+		if errResp != nil {
+			return errResp
+		}
+		offset := args[i+2].Value
+		op.offset, errResp = parseBitOffset(strings.TrimPrefix(offset, "#"), strings.HasPrefix(offset, "#"), op.bits)
+		if errResp != nil {
+			return errResp
+		}
+		if op.op != BITFIELD_GET {
+			if readOnly {
+				return ErrResp("ERR BITFIELD_RO only supports the GET subcommand")
+			}
+			var ok bool
+			if op.value, ok = parseInt64(args[i+3].Value); !ok {
+				return ErrResp("ERR value is not an integer or out of range")
+			}
+			writeEnd = max(writeEnd, op.offset+int64(op.bits))
+		}
+		ops = append(ops, op)
+		i += argc
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	value, _, errResp := db.getBytes(key)
+	if errResp != nil {
+		return errResp
+	}
+	if writeEnd > 0 {
+		value = growBytes(value, int((writeEnd+7)>>3))
+		db.setValue(key, value)
+	}
+
+	replies := make([]*RESP, 0, len(ops))
+	for _, op := range ops {
+		old := getBitfield(value, op.offset, op.bits, op.signed)
+		if op.op == BITFIELD_GET {
+			replies = append(replies, Integer(old))
+			continue
+		}
+
+		base, incr := op.value, int64(0)
+		if op.op == BITFIELD_INCRBY {
+			base, incr = old, op.value
+		}
+		result, overflowed := bitfieldAdd(base, incr, op.bits, op.signed, op.overflow)
+		if overflowed && op.overflow == BITFIELD_FAIL {
+			replies = append(replies, NullResp())
+			continue
+		}
+		setBitfield(value, op.offset, op.bits, result)
+		s.Dirty.Add(1)
+		if op.op == BITFIELD_SET {
+			replies = append(replies, Integer(old))
+		} else {
+			replies = append(replies, Integer(result))
+		}
+	}
+	return &RESP{Type: ARRAY, Values: replies}
+}
+
+// parseBitOffset parses a bit offset, which with hash is a number of fields
+// of the given width, and checks it lies within the largest string.
+func parseBitOffset(value string, hash bool, width int) (int64, *RESP) {
+	offset, ok := parseInt64(value)
+	if !ok || offset < 0 {
+		return 0, ErrResp("ERR bit offset is not an integer or out of range")
+	}
+	if hash {
+		if offset > math.MaxInt64/int64(width) {
+			return 0, ErrResp("ERR bit offset is not an integer or out of range")
+		}
+		offset *= int64(width)
+	}
+	if offset>>3 >= maxStringSize {
+		return 0, ErrResp("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// parseBitfieldType parses a BITFIELD type such as i8 or u16.
+func parseBitfieldType(value string) (bool, int, *RESP) {
+	errResp := ErrResp("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	if len(value) < 2 || (value[0] != 'i' && value[0] != 'u' && value[0] != 'I' && value[0] != 'U') {
+		return false, 0, errResp
+	}
+	signed := value[0] == 'i' || value[0] == 'I'
+	width, err := strconv.Atoi(value[1:])
+	if err != nil || width < 1 || (signed && width > 64) || (!signed && width > 63) {
+		return false, 0, errResp
+	}
+	return signed, width, nil
+}
+
+// parseBitRange parses the start, end and optional BYTE or BIT unit of
+// BITCOUNT and BITPOS into an inclusive range of bits within a string of size
+// bytes. Reports false if the range is empty.
+func parseBitRange(args []*RESP, size int) (int64, int64, bool, *RESP) {
+	start, ok := parseInt64(args[0].Value)
+	if !ok {
+		return 0, 0, false, ErrResp("ERR value is not an integer or out of range")
+	}
+	end, ok := parseInt64(args[1].Value)
+	if !ok {
+		return 0, 0, false, ErrResp("ERR value is not an integer or out of range")
+	}
+	inBits := false
+	if len(args) == 3 {
+		switch strings.ToUpper(args[2].Value) {
+		case "BYTE":
+		case "BIT":
+			inBits = true
+		default:
+			return 0, 0, false, ErrResp("ERR syntax error")
+		}
+	}
+
+	// Negative offsets count from the end, and the range is clamped to the
+	// string
+	n := int64(size)
+	if inBits {
+		n *= 8
+	}
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	start, end = max(start, 0), min(max(end, 0), n-1)
+	if start > end {
+		return 0, 0, false, nil
+	}
+	if !inBits {
+		start, end = start*8, end*8+7
+	}
+	return start, end, true, nil
+}
+
+// getBit returns the bit at offset, counting from the most significant bit
+// of the first byte. The offset must be within b.
+func getBit(b []byte, offset int64) int {
+	return int(b[offset>>3]>>(7-offset&7)) & 1
+}
+
+// setBit sets or clears the bit at offset, which must be within b.
+func setBit(b []byte, offset int64, on bool) {
+	mask := byte(1) << (7 - offset&7)
+	if on {
+		b[offset>>3] |= mask
+	} else {
+		b[offset>>3] &^= mask
+	}
+}
+
+// byteAt returns the byte at i, or 0 past the end of b.
+func byteAt(b []byte, i int) byte {
+	if i < len(b) {
+		return b[i]
+	}
+	return 0
+}
+
+// getBitfield returns the integer of width bits at offset, with bits past the
+// end of b read as zeroes.
+func getBitfield(b []byte, offset int64, width int, signed bool) int64 {
+	var u uint64
+	for i := int64(0); i < int64(width); i++ {
+		u <<= 1
+		if (offset+i)>>3 < int64(len(b)) {
+			u |= uint64(getBit(b, offset+i))
+		}
+	}
+	if signed && width < 64 && u&(1<<(width-1)) != 0 {
+		u |= math.MaxUint64 << width
+	}
+	return int64(u)
+}
+
+// setBitfield stores the low width bits of value at offset, which must be
+// within b.
+func setBitfield(b []byte, offset int64, width int, value int64) {
+	u := uint64(value)
+	for i := int64(0); i < int64(width); i++ {
+		setBit(b, offset+i, u&(1<<(int64(width)-1-i)) != 0)
+	}
+}
+
+// bitfieldAdd adds incr to value for a field of width bits, and reports
+// whether that overflowed. On overflow the result is wrapped or saturated
+// depending on overflow, like Redis.
+func bitfieldAdd(value, incr int64, width int, signed bool, overflow int) (int64, bool) {
+	var limit int64
+	over := false
+	if signed {
+		maxValue := int64(math.MaxInt64)
+		if width < 64 {
+			maxValue = 1<<(width-1) - 1
+		}
+		minValue := -maxValue - 1
+		maxIncr, minIncr := maxValue-value, minValue-value
+		switch {
+		case value > maxValue || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr):
+			limit, over = maxValue, true
+		case value < minValue || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr):
+			limit, over = minValue, true
+		}
+	} else {
+		maxValue := uint64(1)<<width - 1
+		maxIncr, minIncr := int64(maxValue-uint64(value)), -value
+		switch {
+		case uint64(value) > maxValue || (incr > 0 && incr > maxIncr):
+			limit, over = int64(maxValue), true
+		case incr < 0 && incr < minIncr:
+			limit, over = 0, true
+		}
+	}
+	if !over {
+		return value + incr, false
+	}
+	if overflow == BITFIELD_SAT {
+		return limit, true
+	}
+
+	// Wrap by keeping the low bits, sign extended for signed fields
+	result := uint64(value) + uint64(incr)
+	if width < 64 {
+		mask := uint64(math.MaxUint64) << width
+		if signed && result&(1<<(width-1)) != 0 {
+			result |= mask
+		} else {
+			result &^= mask
+		}
+	}
+	return int64(result), true
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBitCommands(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	for _, args := range [][]string{
+		{"SET", "bit:foobar", "foobar"},
+		{"SET", "bit:abcdef", "abcdef"},
+		{"SET", "bit:high", "\xff\xf0\x00"},
+		{"SET", "bit:low", "\x00\xff\xf0"},
+		{"SET", "bit:ones", "\xff\xff\xff"},
+		{"RPUSH", "bit:list", "a"},
+	} {
+		Write(conn.Writer, ToResp(args...))
+		conn.Buffer.Read()
+	}
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"SETBIT", "bit:set", "7", "1"}, INTEGER, "0"},
+		{[]string{"SETBIT", "bit:set", "7", "1"}, INTEGER, "1"},
+		{[]string{"GET", "bit:set"}, BULK, "\x01"},
+		{[]string{"GETBIT", "bit:set", "7"}, INTEGER, "1"},
+		{[]string{"GETBIT", "bit:set", "100"}, INTEGER, "0"},
+		{[]string{"SETBIT", "bit:set", "100", "1"}, INTEGER, "0"},
+		{[]string{"STRLEN", "bit:set"}, INTEGER, "13"},
+		{[]string{"SETBIT", "bit:set", "-1", "1"}, ERROR, "ERR bit offset is not an integer or out of range"},
+		{[]string{"SETBIT", "bit:set", "4294967296", "1"}, ERROR, "ERR bit offset is not an integer or out of range"},
+		{[]string{"SETBIT", "bit:set", "1", "2"}, ERROR, "ERR bit is not an integer or out of range"},
+		{[]string{"SETBIT", "bit:list", "1", "1"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"BITCOUNT", "bit:foobar"}, INTEGER, "26"},
+		{[]string{"BITCOUNT", "bit:foobar", "0", "0"}, INTEGER, "4"},
+		{[]string{"BITCOUNT", "bit:foobar", "1", "1"}, INTEGER, "6"},
+		{[]string{"BITCOUNT", "bit:foobar", "1", "1", "BYTE"}, INTEGER, "6"},
+		{[]string{"BITCOUNT", "bit:foobar", "5", "30", "BIT"}, INTEGER, "17"},
+		{[]string{"BITCOUNT", "bit:foobar", "-2", "-1"}, INTEGER, "7"},
+		{[]string{"BITCOUNT", "bit:foobar", "1"}, ERROR, "ERR syntax error"},
+		{[]string{"BITCOUNT", "bit:foobar", "0", "1", "WORD"}, ERROR, "ERR syntax error"},
+		{[]string{"BITCOUNT", "bit:missing"}, INTEGER, "0"},
+		{[]string{"BITPOS", "bit:high", "0"}, INTEGER, "12"},
+		{[]string{"BITPOS", "bit:low", "1", "0"}, INTEGER, "8"},
+		{[]string{"BITPOS", "bit:low", "1", "2"}, INTEGER, "16"},
+		{[]string{"BITPOS", "bit:low", "1", "2", "-1", "BYTE"}, INTEGER, "16"},
+		{[]string{"BITPOS", "bit:low", "1", "7", "15", "BIT"}, INTEGER, "8"},
+		{[]string{"BITPOS", "bit:low", "1", "7", "-3", "BIT"}, INTEGER, "8"},
+		{[]string{"BITPOS", "bit:ones", "0"}, INTEGER, "24"},
+		{[]string{"BITPOS", "bit:ones", "0", "0", "-1"}, INTEGER, "-1"},
+		{[]string{"BITPOS", "bit:missing", "0"}, INTEGER, "0"},
+		{[]string{"BITPOS", "bit:missing", "1"}, INTEGER, "-1"},
+		{[]string{"BITPOS", "bit:low", "2"}, ERROR, "ERR The bit argument must be 1 or 0."},
+		{[]string{"BITOP", "AND", "bit:dest", "bit:foobar", "bit:abcdef"}, INTEGER, "6"},
+		{[]string{"GET", "bit:dest"}, BULK, "`bc`ab"},
+		{[]string{"BITOP", "OR", "bit:dest", "bit:high", "bit:foobar"}, INTEGER, "6"},
+		{[]string{"GET", "bit:dest"}, BULK, "\xff\xffobar"},
+		{[]string{"BITOP", "XOR", "bit:dest", "bit:high", "bit:high"}, INTEGER, "3"},
+		{[]string{"GET", "bit:dest"}, BULK, "\x00\x00\x00"},
+		{[]string{"BITOP", "NOT", "bit:dest", "bit:low"}, INTEGER, "3"},
+		{[]string{"GET", "bit:dest"}, BULK, "\xff\x00\x0f"},
+		{[]string{"BITOP", "NOT", "bit:dest", "bit:low", "bit:high"}, ERROR, "ERR BITOP NOT must be called with a single source key."},
+		{[]string{"BITOP", "NAND", "bit:dest", "bit:low"}, ERROR, "ERR syntax error"},
+		{[]string{"BITOP", "AND", "bit:dest", "bit:list"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"BITOP", "AND", "bit:dest", "bit:missing"}, INTEGER, "0"},
+		{[]string{"EXISTS", "bit:dest"}, INTEGER, "0"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.args, test.expected, parsedResp.Value)
+		}
+	}
+}
+
+func TestBitfield(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	tests := []struct {
+		args     []string
+		expected []string // "nil" for a nil reply
+	}{
+		{[]string{"BITFIELD", "bitfield:a", "INCRBY", "i5", "100", "1", "GET", "u4", "0"}, []string{"1", "0"}},
+		{[]string{"BITFIELD", "bitfield:b", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, []string{"1", "1"}},
+		{[]string{"BITFIELD", "bitfield:b", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, []string{"2", "2"}},
+		{[]string{"BITFIELD", "bitfield:b", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, []string{"3", "3"}},
+		{[]string{"BITFIELD", "bitfield:b", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"}, []string{"0", "3"}},
+		{[]string{"BITFIELD", "bitfield:b", "OVERFLOW", "FAIL", "INCRBY", "u2", "102", "1"}, []string{"nil"}},
+		{[]string{"BITFIELD", "bitfield:c", "SET", "i8", "#0", "127", "INCRBY", "i8", "#0", "1"}, []string{"0", "-128"}},
+		{[]string{"BITFIELD", "bitfield:c", "OVERFLOW", "SAT", "INCRBY", "i8", "#0", "-1", "INCRBY", "i8", "#0", "-100"}, []string{"-128", "-128"}},
+		{[]string{"BITFIELD", "bitfield:c", "SET", "u8", "#1", "300", "GET", "u8", "#1"}, []string{"0", "44"}},
+		{[]string{"BITFIELD", "bitfield:c", "OVERFLOW", "SAT", "SET", "u8", "#1", "-1", "GET", "u8", "8"}, []string{"44", "255"}},
+		{[]string{"BITFIELD", "bitfield:c", "SET", "i64", "0", "-1", "INCRBY", "i64", "0", "-9223372036854775807"}, []string{"-9151595917793558528", "-9223372036854775808"}},
+		{[]string{"BITFIELD", "bitfield:c", "OVERFLOW", "FAIL", "INCRBY", "i64", "0", "-1", "GET", "i64", "0"}, []string{"nil", "-9223372036854775808"}},
+		{[]string{"BITFIELD_RO", "bitfield:c", "GET", "u8", "0"}, []string{"128"}},
+		{[]string{"BITFIELD", "bitfield:missing", "GET", "u8", "0"}, []string{"0"}},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != ARRAY || len(parsedResp.Values) != len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, parsedResp)
+			continue
+		}
+		for i, value := range parsedResp.Values {
+			if test.expected[i] == "nil" && value.Type != 0 || test.expected[i] != "nil" && value.Value != test.expected[i] {
+				t.Errorf("%v: expected %v, got %v", test.args, test.expected, parsedResp)
+				break
+			}
+		}
+	}
+
+	errors := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"BITFIELD", "bitfield:a", "GET", "u64", "0"}, "ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."},
+		{[]string{"BITFIELD", "bitfield:a", "GET", "i65", "0"}, "ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is."},
+		{[]string{"BITFIELD", "bitfield:a", "GET", "u8", "-1"}, "ERR bit offset is not an integer or out of range"},
+		{[]string{"BITFIELD", "bitfield:a", "OVERFLOW", "CLAMP"}, "ERR Invalid OVERFLOW type specified"},
+		{[]string{"BITFIELD", "bitfield:a", "SET", "u8", "0"}, "ERR syntax error"},
+		{[]string{"BITFIELD", "bitfield:a", "SET", "u8", "0", "x"}, "ERR value is not an integer or out of range"},
+		{[]string{"BITFIELD_RO", "bitfield:a", "SET", "u8", "0", "1"}, "ERR BITFIELD_RO only supports the GET subcommand"},
+	}
+	for _, test := range errors {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != ERROR || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
+
+func TestSetbitInPlace(t *testing.T) {
+	db := NewDatabase(0)
+	s := &Server{DBs: []*Database{db}}
+	s.setbit(db, []*RESP{BulkString("bit"), BulkString("1000"), BulkString("1")})
+	before := &db.SETs["bit"][0]
+
+	for _, offset := range []string{"0", "7", "999"} {
+		s.setbit(db, []*RESP{BulkString("bit"), BulkString(offset), BulkString("1")})
+		s.bitfield(db, []*RESP{BulkString("bit"), BulkString("INCRBY"), BulkString("u8"), BulkString(offset), BulkString("1")})
+	}
+	if &db.SETs["bit"][0] != before {
+		t.Errorf("Expected bits to be changed in place")
+	}
+}
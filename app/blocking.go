@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	queue "github.com/elordeiro/redis-server/queue"
+)
+
+// Blocking helpers -----------------------------------------------------------
+// block runs a blocking command on its own goroutine so the connection loop
+// can keep reading and notice a disconnect. Inside a transaction the command
+// runs inline and must not block.
+func (s *Server) block(conn *ConnRW, cmd func() *RESP) []*RESP {
+	if conn.RedirectRead {
+		return []*RESP{cmd()}
+	}
+	blocked := make(chan struct{})
+	conn.Blocked = blocked
+	go func() {
+		Write(conn.Writer, cmd())
+		close(blocked)
+	}()
+	return []*RESP{}
+}
+
+// blockOn appends client to the wait queue of each of its keys.
+// Caller must hold SETsMu.
+func (s *Server) blockOn(client *BlockedClient) {
+	for _, key := range client.Keys {
+		q, ok := client.DB.BLOCKs[key]
+		if !ok {
+			q = queue.NewQueue()
+			client.DB.BLOCKs[key] = q
+		}
+		q.Enqueue(client)
+	}
+}
+
+// unblock removes client from the wait queue of every key it is blocked on.
+// Caller must hold SETsMu.
+func (s *Server) unblock(client *BlockedClient) {
+	client.Done = true
+	for _, key := range client.Keys {
+		q, ok := client.DB.BLOCKs[key]
+		if !ok {
+			continue
+		}
+		q.Remove(client)
+		if q.IsEmpty() {
+			delete(client.DB.BLOCKs, key)
+		}
+	}
+}
+
+// signalKeyReady serves the clients blocked on key in the order they blocked,
+// skipping the ones that can't be served, e.g. readers of another consumer
+// group. Keys signalled while serving, e.g. the destination of BLMOVE, are
+// queued and served afterwards by the outermost call. Caller must hold SETsMu.
+func (s *Server) signalKeyReady(db *Database, key string) {
+	if _, ok := db.BLOCKs[key]; !ok {
+		return
+	}
+	s.READYs = append(s.READYs, ReadyKey{db, key})
+	if len(s.READYs) > 1 {
+		return
+	}
+
+	for len(s.READYs) > 0 {
+		ready := s.READYs[0]
+		var clients []any
+		if q, ok := ready.DB.BLOCKs[ready.Key]; ok {
+			clients = q.Values()
+		}
+		for _, value := range clients {
+			client := value.(*BlockedClient)
+			if client.Done {
+				continue
+			}
+			if resp := client.Serve(ready.Key); resp != nil {
+				s.unblock(client)
+				client.Ch <- resp
+			}
+		}
+		s.READYs = s.READYs[1:]
+	}
+}
+
+// waitForKeys waits until client is served, the timeout expires or the
+// connection closes. A timeout of 0 waits forever. Returns nil if the client
+// was not served.
+func (s *Server) waitForKeys(client *BlockedClient, timeout time.Duration, conn *ConnRW) *RESP {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case resp := <-client.Ch:
+		return resp
+	case <-timer:
+	case <-conn.Closed:
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	// The client may have been served while the timer fired
+	if client.Done {
+		return <-client.Ch
+	}
+	s.unblock(client)
+	return nil
+}
+
+// parseTimeout parses a blocking timeout given in seconds
+func parseTimeout(value string) (time.Duration, *RESP) {
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, ErrResp("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, ErrResp("ERR timeout is negative")
+	}
+	if seconds > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, ErrResp("ERR timeout is out of range")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ----------------------------------------------------------------------------
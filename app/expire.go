@@ -0,0 +1,268 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expiry commands ------------------------------------------------------------
+func (s *Server) expire(db *Database, args []*RESP) *RESP {
+	return s.expireGeneric(db, args, "expire", true, true)
+}
+
+func (s *Server) pexpire(db *Database, args []*RESP) *RESP {
+	return s.expireGeneric(db, args, "pexpire", false, true)
+}
+
+func (s *Server) expireat(db *Database, args []*RESP) *RESP {
+	return s.expireGeneric(db, args, "expireat", true, false)
+}
+
+func (s *Server) pexpireat(db *Database, args []*RESP) *RESP {
+	return s.expireGeneric(db, args, "pexpireat", false, false)
+}
+
+func (s *Server) ttl(db *Database, args []*RESP) *RESP {
+	return s.ttlGeneric(db, args, "ttl", true, false)
+}
+
+func (s *Server) pttl(db *Database, args []*RESP) *RESP {
+	return s.ttlGeneric(db, args, "pttl", false, false)
+}
+
+func (s *Server) expiretime(db *Database, args []*RESP) *RESP {
+	return s.ttlGeneric(db, args, "expiretime", true, true)
+}
+
+func (s *Server) pexpiretime(db *Database, args []*RESP) *RESP {
+	return s.ttlGeneric(db, args, "pexpiretime", false, true)
+}
+
+func (s *Server) persist(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'persist' command")
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	db.expireIfNeeded(key)
+	if _, ok := db.EXPs[key]; !ok {
+		return Integer(0)
+	}
+	delete(db.EXPs, key)
+	s.Dirty.Add(1)
+	return Integer(1)
+}
+
+// ----------------------------------------------------------------------------
+
+// Expiry helpers -------------------------------------------------------------
+// expireGeneric sets the expiry of a key given in seconds or milliseconds,
+// either relative to now or as a unix time. A time in the past deletes the
+// key.
+func (s *Server) expireGeneric(db *Database, args []*RESP, cmd string, seconds, relative bool) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for '" + cmd + "' command")
+	}
+
+	var nx, xx, gt, lt bool
+	for _, arg := range args[2:] {
+		switch strings.ToUpper(arg.Value) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return ErrResp("ERR Unsupported option " + arg.Value)
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return ErrResp("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return ErrResp("ERR GT and LT options at the same time are not compatible")
+	}
+
+	n, err := strconv.ParseInt(args[1].Value, 10, 64)
+	if err != nil {
+		return ErrResp("ERR value is not an integer or out of range")
+	}
+	at, ok := toUnixMilli(n, seconds, relative)
+	if !ok {
+		return ErrResp("ERR invalid expire time in '" + cmd + "' command")
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	db.expireIfNeeded(key)
+	if db.typeOf(key) == "none" {
+		return Integer(0)
+	}
+
+	// A key without an expiry has an infinite TTL
+	current, hasExpiry := db.EXPs[key]
+	switch {
+	case nx && hasExpiry,
+		xx && !hasExpiry,
+		gt && (!hasExpiry || at <= current),
+		lt && hasExpiry && at >= current:
+		return Integer(0)
+	}
+
+	// Replicas get the expiry as a unix time, so one that applies the command
+	// late doesn't keep the key longer than the master
+	s.propagateCommand(db, ToResp("PEXPIREAT", key, strconv.FormatInt(at, 10)))
+	s.Dirty.Add(1)
+	if at <= time.Now().UnixMilli() {
+		db.deleteKey(key)
+		return Integer(1)
+	}
+	db.EXPs[key] = at
+	return Integer(1)
+}
+
+// ttlGeneric replies with the remaining time to live of a key, or with its
+// expiry as a unix time if absolute is set. Replies -2 if the key does not
+// exist and -1 if it has no expiry.
+func (s *Server) ttlGeneric(db *Database, args []*RESP, cmd string, seconds, absolute bool) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for '" + cmd + "' command")
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	db.expireIfNeeded(key)
+	if db.typeOf(key) == "none" {
+		return Integer(-2)
+	}
+	at, ok := db.EXPs[key]
+	if !ok {
+		return Integer(-1)
+	}
+
+	if !absolute {
+		at = max(at-time.Now().UnixMilli(), 0)
+		if seconds {
+			// Round to the nearest second
+			return Integer((at + 500) / 1000)
+		}
+		return Integer(at)
+	}
+	if seconds {
+		return Integer((at + 500) / 1000)
+	}
+	return Integer(at)
+}
+
+// ----------------------------------------------------------------------------
+
+// Active expiry --------------------------------------------------------------
+// Active expiry defaults and limits
+const (
+	defaultHz           = 10
+	maxHz               = 500
+	defaultExpireEffort = 1
+	maxExpireEffort     = 10
+)
+
+// Active expiry tuning at the lowest effort. Each point of effort samples more
+// keys per loop, spends more of each cycle expiring and tolerates fewer
+// expired keys being left behind.
+const (
+	activeExpireKeysPerLoop   = 20
+	activeExpireCyclePercent  = 25
+	activeExpireAcceptedStale = 10
+)
+
+// activeExpireLoop runs an active expiry cycle hz times per second
+func (s *Server) activeExpireLoop() {
+	for {
+		s.SETsMu.RLock()
+		hz := s.Hz
+		s.SETsMu.RUnlock()
+
+		time.Sleep(time.Second / time.Duration(hz))
+		s.activeExpireCycle()
+	}
+}
+
+// activeExpireCycle deletes expired keys by sampling keys with an expiry in
+// each database, like the adaptive cycle of Redis. Sampling is repeated while
+// the share of expired keys found stays above the accepted stale percentage,
+// until the cycle runs out of time. SETsMu is released between samples so
+// clients are not blocked for the whole cycle. Returns the number of keys
+// deleted.
+func (s *Server) activeExpireCycle() int {
+	// Replicas delete expired keys when the master propagates their deletion
+	if s.Role == REPLICA {
+		return 0
+	}
+
+	s.SETsMu.RLock()
+	hz, effort := s.Hz, s.ExpireEffort-1
+	s.SETsMu.RUnlock()
+
+	keysPerLoop := activeExpireKeysPerLoop + activeExpireKeysPerLoop/4*effort
+	cyclePercent := activeExpireCyclePercent + 2*effort
+	acceptedStale := activeExpireAcceptedStale - effort
+	limit := time.Second / time.Duration(hz) * time.Duration(cyclePercent) / 100
+
+	start := time.Now()
+	deleted := 0
+	for _, db := range s.DBs {
+		for {
+			sampled, expired := 0, 0
+
+			// Map iteration order is random, which makes this a sample
+			s.SETsMu.Lock()
+			now := time.Now().UnixMilli()
+			for key, at := range db.EXPs {
+				if sampled == keysPerLoop {
+					break
+				}
+				sampled++
+				if at <= now {
+					db.deleteKey(key)
+					s.propagateCommand(db, ToResp("DEL", key))
+					expired++
+				}
+			}
+			s.SETsMu.Unlock()
+
+			deleted += expired
+			if time.Since(start) > limit {
+				return deleted
+			}
+			if sampled == 0 || expired*100 <= sampled*acceptedStale {
+				break
+			}
+		}
+	}
+	return deleted
+}
+
+// propagateExpiries sends replicas a DEL for each key deleted lazily by expiry,
+// so they don't depend on their own clock to drop it.
+func (s *Server) propagateExpiries() {
+	for _, db := range s.DBs {
+		db.Expired = func(key string) {
+			s.propagateCommand(db, ToResp("DEL", key))
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
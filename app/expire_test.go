@@ -0,0 +1,224 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpireOptions(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "expire:list", "a"))
+	conn.Buffer.Read()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"TTL", "expire:missing"}, INTEGER, "-2"},
+		{[]string{"TTL", "expire:list"}, INTEGER, "-1"},
+		{[]string{"EXPIRE", "expire:missing", "100"}, INTEGER, "0"},
+		{[]string{"EXPIRE", "expire:list", "100", "XX"}, INTEGER, "0"},
+		{[]string{"EXPIRE", "expire:list", "100", "GT"}, INTEGER, "0"},
+		{[]string{"EXPIRE", "expire:list", "100", "NX"}, INTEGER, "1"},
+		{[]string{"EXPIRE", "expire:list", "200", "NX"}, INTEGER, "0"},
+		{[]string{"EXPIRE", "expire:list", "200", "LT"}, INTEGER, "0"},
+		{[]string{"EXPIRE", "expire:list", "200", "GT"}, INTEGER, "1"},
+		{[]string{"TTL", "expire:list"}, INTEGER, "200"},
+		{[]string{"PEXPIREAT", "expire:list", "4102444800000"}, INTEGER, "1"},
+		{[]string{"EXPIRETIME", "expire:list"}, INTEGER, "4102444800"},
+		{[]string{"PEXPIREAT", "expire:list", "4102444800600"}, INTEGER, "1"},
+		{[]string{"EXPIRETIME", "expire:list"}, INTEGER, "4102444801"},
+		{[]string{"PEXPIRETIME", "expire:list"}, INTEGER, "4102444800600"},
+		{[]string{"PERSIST", "expire:list"}, INTEGER, "1"},
+		{[]string{"PERSIST", "expire:list"}, INTEGER, "0"},
+		{[]string{"PTTL", "expire:list"}, INTEGER, "-1"},
+		{[]string{"EXPIRE", "expire:list", "100", "NX", "XX"}, ERROR, "ERR NX and XX, GT or LT options at the same time are not compatible"},
+		{[]string{"EXPIRE", "expire:list", "100", "GT", "LT"}, ERROR, "ERR GT and LT options at the same time are not compatible"},
+		{[]string{"EXPIRE", "expire:list", "100", "YY"}, ERROR, "ERR Unsupported option YY"},
+		{[]string{"EXPIRE", "expire:list", "ten"}, ERROR, "ERR value is not an integer or out of range"},
+		{[]string{"EXPIRE", "expire:list", "9223372036854775807"}, ERROR, "ERR invalid expire time in 'expire' command"},
+		{[]string{"EXPIRE", "expire:list", "-1"}, INTEGER, "1"},
+		{[]string{"TYPE", "expire:list"}, STRING, "none"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
+
+func TestExpireAllTypes(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("HSET", "expire:hash", "f", "v"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("XADD", "expire:stream", "1-1", "f", "v"))
+	conn.Buffer.Read()
+
+	for _, key := range []string{"expire:hash", "expire:stream"} {
+		Write(conn.Writer, ToResp("PEXPIRE", key, "50"))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != INTEGER || parsedResp.Value != "1" {
+			t.Errorf("Expected 1, got %v", parsedResp)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	Write(conn.Writer, ToResp("HGET", "expire:hash", "f"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != 0 {
+		t.Errorf("Expected nil, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("TTL", "expire:stream"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "-2" {
+		t.Errorf("Expected -2, got %v", parsedResp)
+	}
+}
+
+func TestExpirePropagatesAbsoluteTime(t *testing.T) {
+	db := NewDatabase(0)
+	replica := &ConnRW{Type: REPLICA, ReplBuffer: [][]byte{}}
+	server := &Server{DBs: []*Database{db}, Conns: []*ConnRW{replica}}
+	conn := &ConnRW{RedirectRead: true}
+	server.Handler(ToResp("SET", "expiry:key", "a"), conn)
+
+	// Relative expiries reach replicas as the unix time set on the master
+	at := strconv.FormatInt(time.Now().Add(300*time.Second).Unix(), 10)
+	for _, args := range [][]string{
+		{"EXPIRE", "expiry:key", "100"},
+		{"PEXPIRE", "expiry:key", "200000", "GT"},
+		{"EXPIREAT", "expiry:key", at},
+		{"PEXPIREAT", "expiry:key", at + "000", "XX"},
+	} {
+		server.Handler(ToResp(args...), conn)
+		expected := string(ToResp("PEXPIREAT", "expiry:key", strconv.FormatInt(db.EXPs["expiry:key"], 10)).Marshal())
+		if got := string(replica.ReplBuffer[len(replica.ReplBuffer)-1]); got != expected {
+			t.Errorf("%v: expected %q, got %q", args, expected, got)
+		}
+	}
+
+	// Expiries that aren't set are not propagated
+	propagated := len(replica.ReplBuffer)
+	server.Handler(ToResp("EXPIRE", "expiry:key", "100", "NX"), conn)
+	server.Handler(ToResp("EXPIRE", "expiry:missing", "100"), conn)
+	if len(replica.ReplBuffer) != propagated {
+		t.Errorf("Expected %d propagated commands, got %d", propagated, len(replica.ReplBuffer))
+	}
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	db := NewDatabase(0)
+	s := &Server{DBs: []*Database{db}, Hz: defaultHz, ExpireEffort: defaultExpireEffort}
+	now := time.Now().UnixMilli()
+	for i := range 1000 {
+		key := "expire:" + strconv.Itoa(i)
+		db.setValue(key, "v")
+		if i%2 == 0 {
+			db.EXPs[key] = now - 1
+		} else {
+			db.EXPs[key] = now + 60000
+		}
+	}
+
+	deleted := 0
+	for range 1000 {
+		deleted += s.activeExpireCycle()
+		if deleted == 500 {
+			break
+		}
+	}
+	if deleted != 500 || len(db.SETs) != 500 || len(db.EXPs) != 500 {
+		t.Errorf("Expected 500 keys deleted, got %d with %d keys left", deleted, len(db.SETs))
+	}
+	for key := range db.EXPs {
+		if db.EXPs[key] <= now {
+			t.Errorf("Expected %s to be deleted", key)
+		}
+	}
+}
+
+func TestExpiryPropagatesDel(t *testing.T) {
+	db := NewDatabase(1)
+	replica := &ConnRW{Type: REPLICA, ReplBuffer: [][]byte{}}
+	s := &Server{DBs: []*Database{db}, Conns: []*ConnRW{replica}, Hz: defaultHz, ExpireEffort: defaultExpireEffort}
+	s.propagateExpiries()
+	now := time.Now().UnixMilli()
+	db.setValue("expire:lazy", "v")
+	db.EXPs["expire:lazy"] = now - 1
+	conn := &ConnRW{RedirectRead: true}
+	s.Handler(ToResp("GET", "expire:lazy"), conn)
+
+	// Replicas are sent a DEL for keys deleted lazily or actively
+	db.setValue("expire:active", "v")
+	db.EXPs["expire:active"] = now - 1
+	s.activeExpireCycle()
+	expected := []string{
+		string(ToResp("SELECT", "1").Marshal()),
+		string(ToResp("DEL", "expire:lazy").Marshal()),
+		string(ToResp("DEL", "expire:active").Marshal()),
+	}
+	if len(replica.ReplBuffer) != len(expected) {
+		t.Fatalf("Expected %d propagated commands, got %d", len(expected), len(replica.ReplBuffer))
+	}
+	for i, cmd := range replica.ReplBuffer {
+		if string(cmd) != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], cmd)
+		}
+	}
+
+	// Replicas leave expired keys to the master
+	s.Role = REPLICA
+	db.setValue("expire:replica", "v")
+	db.EXPs["expire:replica"] = now - 1
+	if deleted := s.activeExpireCycle(); deleted != 0 || len(db.SETs) != 1 {
+		t.Errorf("Expected no keys deleted on a replica, got %d", deleted)
+	}
+}
+
+func TestConfigHz(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("CONFIG", "SET", "hz", "100"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if !parsedResp.IsOkay() {
+		t.Errorf("Expected OK, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("CONFIG", "GET", "hz"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 || parsedResp.Values[1].Value != "100" {
+		t.Errorf("Expected [hz 100], got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("CONFIG", "SET", "active-expire-effort", "11"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ERROR {
+		t.Errorf("Expected error, got %v", parsedResp)
+	}
+
+	// Expired keys are no longer listed, even before the active cycle runs
+	Write(conn.Writer, ToResp("SET", "expire:lazy", "v", "PX", "20"))
+	conn.Buffer.Read()
+	time.Sleep(50 * time.Millisecond)
+	Write(conn.Writer, ToResp("KEYS", "expire:lazy"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 0 {
+		t.Errorf("Expected no keys, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("CONFIG", "SET", "hz", "10"))
+	conn.Buffer.Read()
+}
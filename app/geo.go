@@ -0,0 +1,444 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	geohash "github.com/elordeiro/redis-server/geohash"
+	zset "github.com/elordeiro/redis-server/zset"
+)
+
+// Geo commands ---------------------------------------------------------------
+func (s *Server) geoadd(db *Database, args []*RESP) *RESP {
+	if len(args) < 4 {
+		return ErrResp("ERR wrong number of arguments for 'geoadd' command")
+	}
+
+	// Points are added as a ZADD with their geohash as score
+	zargs := []*RESP{args[0]}
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "NX", "XX", "CH":
+			zargs = append(zargs, args[i])
+		default:
+			break flags
+		}
+	}
+
+	points := args[i:]
+	if len(points) == 0 || len(points)%3 != 0 {
+		return ErrResp("ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... ")
+	}
+	for j := 0; j < len(points); j += 3 {
+		lon, lat, errResp := parseLonLat(points[j].Value, points[j+1].Value)
+		if errResp != nil {
+			return errResp
+		}
+		score := strconv.FormatUint(geohash.Encode(lon, lat), 10)
+		zargs = append(zargs, BulkString(score), points[j+2])
+	}
+	return s.zadd(db, zargs)
+}
+
+func (s *Server) geopos(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'geopos' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	values := make([]*RESP, 0, len(args)-1)
+	for _, member := range args[1:] {
+		lon, lat, ok := geoMemberPos(z, member.Value)
+		if !ok {
+			values = append(values, NullResp())
+			continue
+		}
+		values = append(values, ToResp(formatCoord(lon), formatCoord(lat)))
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+func (s *Server) geodist(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 && len(args) != 4 {
+		return ErrResp("ERR wrong number of arguments for 'geodist' command")
+	}
+
+	conversion := 1.0
+	if len(args) == 4 {
+		var errResp *RESP
+		if conversion, errResp = parseGeoUnit(args[3].Value); errResp != nil {
+			return errResp
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	lon1, lat1, ok1 := geoMemberPos(z, args[1].Value)
+	lon2, lat2, ok2 := geoMemberPos(z, args[2].Value)
+	if !ok1 || !ok2 {
+		return NullResp()
+	}
+	return BulkString(formatDistance(geohash.Distance(lon1, lat1, lon2, lat2) / conversion))
+}
+
+func (s *Server) geohashcmd(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'geohash' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	values := make([]*RESP, 0, len(args)-1)
+	for _, member := range args[1:] {
+		if z == nil {
+			values = append(values, NullResp())
+			continue
+		}
+		score, ok := z.Score(member.Value)
+		if !ok {
+			values = append(values, NullResp())
+			continue
+		}
+		values = append(values, BulkString(geohash.String(uint64(score))))
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+func (s *Server) geosearch(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'geosearch' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	query, errResp := parseGeoQuery("GEOSEARCH", z, args[1:])
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return ToResp()
+	}
+
+	points := query.search(z)
+	values := make([]*RESP, 0, len(points))
+	for _, p := range points {
+		if !query.withDist && !query.withHash && !query.withCoord {
+			values = append(values, BulkString(p.member))
+			continue
+		}
+		item := []*RESP{BulkString(p.member)}
+		if query.withDist {
+			item = append(item, BulkString(formatDistance(p.dist/query.conversion)))
+		}
+		if query.withHash {
+			item = append(item, Integer(int64(p.score)))
+		}
+		if query.withCoord {
+			item = append(item, ToResp(formatCoord(p.lon), formatCoord(p.lat)))
+		}
+		values = append(values, &RESP{Type: ARRAY, Values: item})
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+func (s *Server) geosearchstore(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'geosearchstore' command")
+	}
+
+	dst := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+	query, errResp := parseGeoQuery("GEOSEARCHSTORE", z, args[2:])
+	if errResp != nil {
+		return errResp
+	}
+
+	var points []geoPoint
+	if z != nil {
+		points = query.search(z)
+	}
+	if db.typeOf(dst) != "none" || len(points) > 0 {
+		s.Dirty.Add(1)
+	}
+	db.deleteKey(dst)
+	if len(points) == 0 {
+		return Integer(0)
+	}
+
+	result := zset.NewZSet()
+	for _, p := range points {
+		if query.storeDist {
+			result.Add(p.member, p.dist/query.conversion)
+		} else {
+			result.Add(p.member, float64(p.score))
+		}
+	}
+	db.setValue(dst, result)
+	s.signalKeyReady(db, dst)
+	return Integer(result.Len())
+}
+
+// ----------------------------------------------------------------------------
+
+// Geo helpers ----------------------------------------------------------------
+// GEOSEARCH sort orders
+const (
+	GEO_SORT_NONE = iota
+	GEO_SORT_ASC
+	GEO_SORT_DESC
+)
+
+type geoQuery struct {
+	shape      geohash.Shape
+	conversion float64
+	sort       int
+	count      int
+	any        bool
+	withDist   bool
+	withHash   bool
+	withCoord  bool
+	storeDist  bool
+}
+
+type geoPoint struct {
+	member string
+	score  uint64
+	dist   float64
+	lon    float64
+	lat    float64
+}
+
+// parseGeoQuery parses the options of GEOSEARCH or GEOSEARCHSTORE, looking up
+// FROMMEMBER in z. Caller must hold SETsMu.
+func parseGeoQuery(cmd string, z *zset.ZSet, args []*RESP) (*geoQuery, *RESP) {
+	query := &geoQuery{conversion: 1}
+	store := cmd == "GEOSEARCHSTORE"
+	var from, by bool
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch arg := strings.ToUpper(args[i].Value); {
+		case arg == "WITHDIST":
+			query.withDist = true
+		case arg == "WITHHASH":
+			query.withHash = true
+		case arg == "WITHCOORD":
+			query.withCoord = true
+		case arg == "ANY":
+			query.any = true
+		case arg == "ASC":
+			query.sort = GEO_SORT_ASC
+		case arg == "DESC":
+			query.sort = GEO_SORT_DESC
+		case arg == "COUNT" && remaining >= 1:
+			count, errResp := parseInt(args[i+1].Value)
+			if errResp != nil {
+				return nil, errResp
+			}
+			if count <= 0 {
+				return nil, ErrResp("ERR COUNT must be > 0")
+			}
+			query.count = count
+			i++
+		case arg == "FROMMEMBER" && remaining >= 1 && !from:
+			lon, lat, ok := geoMemberPos(z, args[i+1].Value)
+			if !ok {
+				return nil, ErrResp("ERR could not decode requested zset member")
+			}
+			query.shape.Lon, query.shape.Lat = lon, lat
+			from = true
+			i++
+		case arg == "FROMLONLAT" && remaining >= 2 && !from:
+			lon, lat, errResp := parseLonLat(args[i+1].Value, args[i+2].Value)
+			if errResp != nil {
+				return nil, errResp
+			}
+			query.shape.Lon, query.shape.Lat = lon, lat
+			from = true
+			i += 2
+		case arg == "BYRADIUS" && remaining >= 2 && !by:
+			radius, err := strconv.ParseFloat(args[i+1].Value, 64)
+			if err != nil {
+				return nil, ErrResp("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return nil, ErrResp("ERR radius cannot be negative")
+			}
+			conversion, errResp := parseGeoUnit(args[i+2].Value)
+			if errResp != nil {
+				return nil, errResp
+			}
+			query.shape.Radius = radius * conversion
+			query.conversion = conversion
+			by = true
+			i += 2
+		case arg == "BYBOX" && remaining >= 3 && !by:
+			width, err := strconv.ParseFloat(args[i+1].Value, 64)
+			if err != nil {
+				return nil, ErrResp("ERR need numeric width")
+			}
+			height, err := strconv.ParseFloat(args[i+2].Value, 64)
+			if err != nil {
+				return nil, ErrResp("ERR need numeric height")
+			}
+			if width < 0 || height < 0 {
+				return nil, ErrResp("ERR height or width cannot be negative")
+			}
+			conversion, errResp := parseGeoUnit(args[i+3].Value)
+			if errResp != nil {
+				return nil, errResp
+			}
+			query.shape.Width, query.shape.Height = width*conversion, height*conversion
+			query.shape.Box = true
+			query.conversion = conversion
+			by = true
+			i += 3
+		case arg == "STOREDIST" && store:
+			query.storeDist = true
+		default:
+			return nil, ErrResp("ERR syntax error")
+		}
+	}
+
+	if store && (query.withDist || query.withHash || query.withCoord) {
+		return nil, ErrResp("ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	if !from {
+		return nil, ErrResp("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmd)
+	}
+	if !by {
+		return nil, ErrResp("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmd)
+	}
+	if query.any && query.count == 0 {
+		return nil, ErrResp("ERR the ANY argument requires COUNT argument")
+	}
+	// Without ANY, COUNT returns the closest points
+	if query.count > 0 && query.sort == GEO_SORT_NONE && !query.any {
+		query.sort = GEO_SORT_ASC
+	}
+	return query, nil
+}
+
+// search returns the members of z within the shape of the query. Only the
+// boxes covering the shape are scanned, and with ANY the scan stops as soon as
+// COUNT members are found. Caller must hold SETsMu.
+func (query *geoQuery) search(z *zset.ZSet) []geoPoint {
+	points := []geoPoint{}
+	for _, r := range query.shape.Ranges() {
+		if query.any && len(points) >= query.count {
+			break
+		}
+		scores := zset.Range{Min: float64(r.Min), Max: float64(r.Max), MaxExclusive: true}
+		for _, e := range z.RangeByScore(scores, 0, -1, false) {
+			if query.any && len(points) >= query.count {
+				break
+			}
+			lon, lat := geohash.Decode(uint64(e.Score))
+			if dist, ok := query.shape.Contains(lon, lat); ok {
+				points = append(points, geoPoint{e.Member, uint64(e.Score), dist, lon, lat})
+			}
+		}
+	}
+
+	switch query.sort {
+	case GEO_SORT_ASC:
+		slices.SortFunc(points, func(a, b geoPoint) int { return cmp.Compare(a.dist, b.dist) })
+	case GEO_SORT_DESC:
+		slices.SortFunc(points, func(a, b geoPoint) int { return cmp.Compare(b.dist, a.dist) })
+	}
+	if query.count > 0 && len(points) > query.count {
+		points = points[:query.count]
+	}
+	return points
+}
+
+// geoMemberPos returns the position of member in z, which may be nil.
+func geoMemberPos(z *zset.ZSet, member string) (float64, float64, bool) {
+	if z == nil {
+		return 0, 0, false
+	}
+	score, ok := z.Score(member)
+	if !ok {
+		return 0, 0, false
+	}
+	lon, lat := geohash.Decode(uint64(score))
+	return lon, lat, true
+}
+
+// parseLonLat parses a longitude and latitude that can be indexed
+func parseLonLat(lonArg, latArg string) (float64, float64, *RESP) {
+	lon, errResp := parseScore(lonArg)
+	if errResp != nil {
+		return 0, 0, errResp
+	}
+	lat, errResp := parseScore(latArg)
+	if errResp != nil {
+		return 0, 0, errResp
+	}
+	if !geohash.Valid(lon, lat) {
+		return 0, 0, ErrResp(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lon, lat))
+	}
+	return lon, lat, nil
+}
+
+// parseGeoUnit returns the number of meters in a unit
+func parseGeoUnit(unit string) (float64, *RESP) {
+	switch strings.ToLower(unit) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, ErrResp("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+// formatCoord formats a coordinate with 17 decimals, trimming trailing zeros
+func formatCoord(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 17, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func formatDistance(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
+
+// ----------------------------------------------------------------------------
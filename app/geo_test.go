@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGeoCommands(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "geo:list", "a"))
+	conn.Buffer.Read()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"GEOADD", "geo:sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"}, INTEGER, "2"},
+		{[]string{"GEOADD", "geo:sicily", "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"}, INTEGER, "2"},
+		{[]string{"GEOADD", "geo:sicily", "NX", "CH", "0", "0", "Palermo"}, INTEGER, "0"},
+		{[]string{"GEOADD", "geo:sicily", "181", "0", "x"}, ERROR, "ERR invalid longitude,latitude pair 181.000000,0.000000"},
+		{[]string{"GEOADD", "geo:sicily", "0", "86", "x"}, ERROR, "ERR invalid longitude,latitude pair 0.000000,86.000000"},
+		{[]string{"GEOADD", "geo:sicily", "0", "0"}, ERROR, "ERR wrong number of arguments for 'geoadd' command"},
+		{[]string{"GEOADD", "geo:sicily", "0", "0", "a", "1"}, ERROR, "ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... "},
+		{[]string{"GEOADD", "geo:list", "0", "0", "a"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"ZSCORE", "geo:sicily", "Palermo"}, BULK, "3479099956230698"},
+		{[]string{"GEODIST", "geo:sicily", "Palermo", "Catania"}, BULK, "166274.1516"},
+		{[]string{"GEODIST", "geo:sicily", "Palermo", "Catania", "km"}, BULK, "166.2742"},
+		{[]string{"GEODIST", "geo:sicily", "Palermo", "Catania", "MI"}, BULK, "103.3182"},
+		{[]string{"GEODIST", "geo:sicily", "Palermo", "Catania", "yd"}, ERROR, "ERR unsupported unit provided. please use M, KM, FT, MI"},
+		{[]string{"GEODIST", "geo:sicily", "Palermo", "Rome"}, 0, ""},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37"}, ERROR, "ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH"},
+		{[]string{"GEOSEARCH", "geo:sicily", "BYRADIUS", "1", "km"}, ERROR, "ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH"},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMMEMBER", "Rome", "BYRADIUS", "1", "km"}, ERROR, "ERR could not decode requested zset member"},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "FROMMEMBER", "Palermo", "BYRADIUS", "1", "km"}, ERROR, "ERR syntax error"},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "-1", "km"}, ERROR, "ERR radius cannot be negative"},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "COUNT", "0"}, ERROR, "ERR COUNT must be > 0"},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "ANY"}, ERROR, "ERR the ANY argument requires COUNT argument"},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "BYBOX", "1", "x", "km"}, ERROR, "ERR need numeric height"},
+		{[]string{"GEOSEARCHSTORE", "geo:dst", "geo:sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km", "WITHDIST"}, ERROR, "ERR GEOSEARCHSTORE is not compatible with WITHDIST, WITHHASH and WITHCOORD options"},
+		{[]string{"GEOSEARCHSTORE", "geo:dst", "geo:sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "COUNT", "3"}, INTEGER, "3"},
+		{[]string{"ZSCORE", "geo:dst", "edge2"}, BULK, "3481342659049484"},
+		{[]string{"GEOSEARCHSTORE", "geo:dist", "geo:sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "COUNT", "3", "STOREDIST"}, INTEGER, "3"},
+		{[]string{"ZSCORE", "geo:dist", "Catania"}, BULK, "56.4412578701582"},
+		{[]string{"GEOSEARCHSTORE", "geo:dst", "geo:missing", "FROMLONLAT", "15", "37", "BYRADIUS", "1", "km"}, INTEGER, "0"},
+		{[]string{"EXISTS", "geo:dst"}, INTEGER, "0"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+
+	arrays := []struct {
+		args     []string
+		expected []string // nested arrays are flattened, "nil" for a nil reply
+	}{
+		{[]string{"GEOPOS", "geo:sicily", "Palermo", "Rome"}, []string{"13.36138933897018433", "38.11555639549629859", "nil"}},
+		{[]string{"GEOPOS", "geo:missing", "Palermo"}, []string{"nil"}},
+		{[]string{"GEOHASH", "geo:sicily", "Palermo", "Catania", "Rome"}, []string{"sqc8b49rny0", "sqdtr74hyu0", "nil"}},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"}, []string{"Catania", "Palermo"}},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "DESC"}, []string{"Palermo", "Catania"}},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "WITHCOORD", "WITHDIST"}, []string{
+			"Catania", "56.4413", "15.08726745843887329", "37.50266842333162032",
+			"Palermo", "190.4424", "13.36138933897018433", "38.11555639549629859",
+			"edge2", "279.7403", "17.24151045083999634", "38.78813451624225195",
+			"edge1", "279.7405", "12.7584877610206604", "38.78813451624225195",
+		}},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "200", "km", "COUNT", "1", "WITHHASH"}, []string{"Palermo", "3479099956230698"}},
+		{[]string{"GEOSEARCH", "geo:sicily", "FROMMEMBER", "Palermo", "BYRADIUS", "200", "km", "COUNT", "1", "ANY"}, nil},
+		{[]string{"GEOSEARCH", "geo:missing", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km"}, []string{}},
+	}
+	for _, test := range arrays {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != ARRAY {
+			t.Errorf("%v: expected an array, got %v", test.args, parsedResp)
+			continue
+		}
+		values := flattenResp(parsedResp.Values)
+		// With ANY any single member may be returned
+		if test.expected == nil {
+			if len(values) != 1 {
+				t.Errorf("%v: expected one member, got %v", test.args, values)
+			}
+			continue
+		}
+		if len(values) != len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, values)
+			continue
+		}
+		for i, v := range test.expected {
+			if v == "nil" && values[i].Type != 0 || v != "nil" && values[i].Value != v {
+				t.Errorf("%v: expected %s at index %d, got %v", test.args, v, i, values[i])
+			}
+		}
+	}
+}
+
+func flattenResp(values []*RESP) []*RESP {
+	flat := []*RESP{}
+	for _, value := range values {
+		if value.Type == ARRAY {
+			flat = append(flat, flattenResp(value.Values)...)
+		} else {
+			flat = append(flat, value)
+		}
+	}
+	return flat
+}
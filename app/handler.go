@@ -4,12 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"math"
 	"strconv"
 	"strings"
 	"time"
-
-	radix "github.com/elordeiro/redis-server/radix"
 )
 
 // Handler entry point --------------------------------------------------------
@@ -18,6 +15,10 @@ func (s *Server) Handler(parsedResp *RESP, conn *ConnRW) (resp []*RESP) {
 	case ERROR, INTEGER, BULK, STRING:
 		return []*RESP{{Type: ERROR, Value: "Response type " + parsedResp.Value + " handle not yet implemented"}}
 	case ARRAY:
+		// Commands are propagated before they run, so replica snapshots are
+		// taken between commands
+		s.SyncMu.RLock()
+		defer s.SyncMu.RUnlock()
 		return s.handleArray(parsedResp, conn)
 	case RDB:
 		return []*RESP{s.decodeRDB(NewBuffer(bytes.NewReader([]byte(parsedResp.Value))))}
@@ -28,44 +29,330 @@ func (s *Server) Handler(parsedResp *RESP, conn *ConnRW) (resp []*RESP) {
 
 func (s *Server) handleArray(resp *RESP, conn *ConnRW) []*RESP {
 	command, args := resp.getCmdAndArgs()
+	db := s.DBs[conn.DB]
 	switch command {
 	case "PING":
 		return []*RESP{ping(args)}
 	case "ECHO":
 		return []*RESP{echo(args)}
 	case "SET":
-		s.propagateCommand(resp)
-		return []*RESP{s.set(args)}
+		return []*RESP{s.set(db, args)}
 	case "GET":
-		return []*RESP{s.get(args)}
+		return []*RESP{s.get(db, args)}
+	case "MGET":
+		return []*RESP{s.mget(db, args)}
+	case "MSET":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.mset(db, args)}
+	case "MSETNX":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.msetnx(db, args)}
+	case "SETNX":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.setnx(db, args)}
+	case "APPEND":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.appendcmd(db, args)}
+	case "STRLEN":
+		return []*RESP{s.strlen(db, args)}
+	case "GETRANGE":
+		return []*RESP{s.getrange(db, args)}
+	case "SETRANGE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.setrange(db, args)}
+	case "GETSET":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.getset(db, args)}
+	case "GETDEL":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.getdel(db, args)}
+	case "GETEX":
+		return []*RESP{s.getex(db, args)}
+	case "DEL":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.del(db, args)}
+	case "UNLINK":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.unlink(db, args)}
+	case "EXISTS":
+		return []*RESP{s.exists(db, args)}
+	case "RENAME":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.rename(db, args)}
+	case "RENAMENX":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.renamenx(db, args)}
+	case "COPY":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.copy(db, args)}
+	case "RANDOMKEY":
+		return []*RESP{s.randomkey(db, args)}
+	case "SCAN":
+		return []*RESP{s.scan(db, args)}
+	case "DBSIZE":
+		return []*RESP{s.dbsize(db, args)}
+	case "SELECT":
+		return []*RESP{s.selectDB(args, conn)}
+	case "MOVE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.movecmd(db, args)}
+	case "SWAPDB":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.swapdb(args)}
+	case "FLUSHDB":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.flushdb(db, args)}
+	case "FLUSHALL":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.flushall(args)}
+	case "EXPIRE":
+		return []*RESP{s.expire(db, args)}
+	case "PEXPIRE":
+		return []*RESP{s.pexpire(db, args)}
+	case "EXPIREAT":
+		return []*RESP{s.expireat(db, args)}
+	case "PEXPIREAT":
+		return []*RESP{s.pexpireat(db, args)}
+	case "PERSIST":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.persist(db, args)}
+	case "TTL":
+		return []*RESP{s.ttl(db, args)}
+	case "PTTL":
+		return []*RESP{s.pttl(db, args)}
+	case "EXPIRETIME":
+		return []*RESP{s.expiretime(db, args)}
+	case "PEXPIRETIME":
+		return []*RESP{s.pexpiretime(db, args)}
 	case "XADD":
-		return []*RESP{s.xadd(args)}
+		return []*RESP{s.xadd(db, args)}
 	case "XRANGE":
-		return []*RESP{s.xrange(args)}
+		return []*RESP{s.xrange(db, args)}
+	case "XREVRANGE":
+		return []*RESP{s.xrevrange(db, args)}
+	case "XLEN":
+		return []*RESP{s.xlen(db, args)}
+	case "XDEL":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.xdel(db, args)}
+	case "XTRIM":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.xtrim(db, args)}
+	case "XSETID":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.xsetid(db, args)}
 	case "XREAD":
-		go func() {
-			result := s.xread(args)
-			Write(conn.Writer, result)
-		}()
-		return []*RESP{}
+		return s.block(conn, func() *RESP { return s.xread(db, args, conn) })
+	case "XGROUP":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.xgroup(db, args)}
+	case "XREADGROUP":
+		return s.block(conn, func() *RESP { return s.xreadgroup(db, args, conn) })
+	case "XACK":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.xack(db, args)}
+	case "XPENDING":
+		return []*RESP{s.xpending(db, args)}
+	case "XCLAIM":
+		return []*RESP{s.xclaim(db, args)}
+	case "XAUTOCLAIM":
+		return []*RESP{s.xautoclaim(db, args)}
+	case "XINFO":
+		return []*RESP{s.xinfo(db, args)}
+	case "SETBIT":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.setbit(db, args)}
+	case "GETBIT":
+		return []*RESP{s.getbit(db, args)}
+	case "BITCOUNT":
+		return []*RESP{s.bitcount(db, args)}
+	case "BITPOS":
+		return []*RESP{s.bitpos(db, args)}
+	case "BITOP":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.bitop(db, args)}
+	case "BITFIELD":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.bitfield(db, args)}
+	case "BITFIELD_RO":
+		return []*RESP{s.bitfieldRO(db, args)}
+	case "PFADD":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.pfadd(db, args)}
+	case "PFCOUNT":
+		return []*RESP{s.pfcount(db, args)}
+	case "PFMERGE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.pfmerge(db, args)}
 	case "INCR":
-		return []*RESP{s.incr(args)}
+		s.propagateCommand(db, resp)
+		return []*RESP{s.incr(db, args)}
+	case "DECR":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.decr(db, args)}
+	case "INCRBY":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.incrby(db, args)}
+	case "DECRBY":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.decrby(db, args)}
+	case "INCRBYFLOAT":
+		return []*RESP{s.incrbyfloat(db, args)}
+	case "LPUSH":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.lpush(db, args)}
+	case "RPUSH":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.rpush(db, args)}
+	case "LPOP":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.lpop(db, args)}
+	case "RPOP":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.rpop(db, args)}
+	case "LMOVE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.lmove(db, args)}
+	case "BLPOP":
+		return s.block(conn, func() *RESP { return s.blpop(db, args, conn) })
+	case "BRPOP":
+		return s.block(conn, func() *RESP { return s.brpop(db, args, conn) })
+	case "BLMOVE":
+		return s.block(conn, func() *RESP { return s.blmove(db, args, conn) })
+	case "LRANGE":
+		return []*RESP{s.lrange(db, args)}
+	case "LLEN":
+		return []*RESP{s.llen(db, args)}
+	case "LINDEX":
+		return []*RESP{s.lindex(db, args)}
+	case "LSET":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.lset(db, args)}
+	case "LREM":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.lrem(db, args)}
+	case "LTRIM":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.ltrim(db, args)}
+	case "HSET":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.hset(db, args)}
+	case "HMSET":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.hmset(db, args)}
+	case "HSETNX":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.hsetnx(db, args)}
+	case "HGET":
+		return []*RESP{s.hget(db, args)}
+	case "HMGET":
+		return []*RESP{s.hmget(db, args)}
+	case "HGETALL":
+		return []*RESP{s.hgetall(db, args)}
+	case "HKEYS":
+		return []*RESP{s.hkeys(db, args)}
+	case "HVALS":
+		return []*RESP{s.hvals(db, args)}
+	case "HLEN":
+		return []*RESP{s.hlen(db, args)}
+	case "HEXISTS":
+		return []*RESP{s.hexists(db, args)}
+	case "HSTRLEN":
+		return []*RESP{s.hstrlen(db, args)}
+	case "HDEL":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.hdel(db, args)}
+	case "HINCRBY":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.hincrby(db, args)}
+	case "SADD":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.sadd(db, args)}
+	case "SREM":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.srem(db, args)}
+	case "SMEMBERS":
+		return []*RESP{s.smembers(db, args)}
+	case "SISMEMBER":
+		return []*RESP{s.sismember(db, args)}
+	case "SCARD":
+		return []*RESP{s.scard(db, args)}
+	case "SINTER":
+		return []*RESP{s.sinter(db, args)}
+	case "SUNION":
+		return []*RESP{s.sunion(db, args)}
+	case "SDIFF":
+		return []*RESP{s.sdiff(db, args)}
+	case "SINTERSTORE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.sinterstore(db, args)}
+	case "SUNIONSTORE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.sunionstore(db, args)}
+	case "SDIFFSTORE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.sdiffstore(db, args)}
+	case "ZADD":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.zadd(db, args)}
+	case "ZINCRBY":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.zincrby(db, args)}
+	case "ZREM":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.zrem(db, args)}
+	case "ZCARD":
+		return []*RESP{s.zcard(db, args)}
+	case "ZSCORE":
+		return []*RESP{s.zscore(db, args)}
+	case "ZRANK":
+		return []*RESP{s.zrank(db, args)}
+	case "ZREVRANK":
+		return []*RESP{s.zrevrank(db, args)}
+	case "ZCOUNT":
+		return []*RESP{s.zcount(db, args)}
+	case "ZRANGE":
+		return []*RESP{s.zrange(db, args)}
+	case "ZRANGEBYSCORE":
+		return []*RESP{s.zrangebyscore(db, args)}
+	case "ZPOPMIN":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.zpopmin(db, args)}
+	case "ZPOPMAX":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.zpopmax(db, args)}
+	case "BZPOPMIN":
+		return s.block(conn, func() *RESP { return s.bzpopmin(db, args, conn) })
+	case "BZPOPMAX":
+		return s.block(conn, func() *RESP { return s.bzpopmax(db, args, conn) })
+	case "GEOADD":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.geoadd(db, args)}
+	case "GEOPOS":
+		return []*RESP{s.geopos(db, args)}
+	case "GEODIST":
+		return []*RESP{s.geodist(db, args)}
+	case "GEOHASH":
+		return []*RESP{s.geohashcmd(db, args)}
+	case "GEOSEARCH":
+		return []*RESP{s.geosearch(db, args)}
+	case "GEOSEARCHSTORE":
+		s.propagateCommand(db, resp)
+		return []*RESP{s.geosearchstore(db, args)}
 	case "INFO":
 		return []*RESP{info(args, s.Role.String(), s.MasterReplid, s.MasterReplOffset)}
 	case "REPLCONF":
 		s.replConfig(args, conn)
 		return []*RESP{}
 	case "PSYNC":
-		conn.Type = REPLICA
-		s.ReplicaCount++
-		go s.checkOnReplica(conn, false)
-		return []*RESP{psync(s.MasterReplid, s.MasterReplOffset), getRDB()}
+		go s.fullResync(conn)
+		return []*RESP{}
 	case "WAIT":
 		return []*RESP{s.wait(args)}
 	case "KEYS":
-		return []*RESP{s.keys(args)}
+		return []*RESP{s.keys(db, args)}
 	case "TYPE":
-		return []*RESP{s.typecmd(args)}
+		return []*RESP{s.typecmd(db, args)}
 	case "MULTI":
 		go func() {
 			s.multi(conn)
@@ -77,6 +364,12 @@ func (s *Server) handleArray(resp *RESP, conn *ConnRW) []*RESP {
 		return []*RESP{s.discard()}
 	case "CONFIG":
 		return []*RESP{s.config(args)}
+	case "SAVE":
+		return []*RESP{s.save(args)}
+	case "BGSAVE":
+		return []*RESP{s.bgsave(args)}
+	case "LASTSAVE":
+		return []*RESP{s.lastsave(args)}
 	case "COMMAND":
 		return []*RESP{commandFunc()}
 	default:
@@ -84,17 +377,82 @@ func (s *Server) handleArray(resp *RESP, conn *ConnRW) []*RESP {
 	}
 }
 
-func (s *Server) propagateCommand(resp *RESP) {
+func (s *Server) propagateCommand(db *Database, resp *RESP) {
+	s.ReplMu.Lock()
+	defer s.ReplMu.Unlock()
+
+	// Replicas run commands on the database selected last
+	cmds := []*RESP{resp}
+	if db.ID != s.ReplDB {
+		cmds = []*RESP{ToResp("SELECT", strconv.Itoa(db.ID)), resp}
+		s.ReplDB = db.ID
+	}
 	for _, conn := range s.Conns {
 		if conn.Type != REPLICA {
 			continue
 		}
-		marshaled := resp.Marshal()
-		s.MasterReplOffset += len(marshaled)
-		Write(conn.Writer, marshaled)
+		for _, cmd := range cmds {
+			marshaled := cmd.Marshal()
+			s.MasterReplOffset += len(marshaled)
+			s.writeToReplica(conn, marshaled)
+		}
 	}
 }
 
+// fullResync sends a new replica a snapshot of every database, followed by
+// the writes propagated since. Writes propagated while the snapshot is
+// encoded and sent are buffered, then streamed once the replica has it.
+func (s *Server) fullResync(conn *ConnRW) {
+	// No command is between being propagated and running
+	s.SyncMu.Lock()
+	s.SETsMu.Lock()
+	dbs := s.snapshot(true)
+	s.ReplMu.Lock()
+	conn.Type = REPLICA
+	conn.ReplBuffer = [][]byte{}
+	s.ReplicaCount++
+	s.ReplDB = -1
+	offset := s.MasterReplOffset
+	s.ReplMu.Unlock()
+	s.SETsMu.Unlock()
+	s.SyncMu.Unlock()
+
+	var rdb bytes.Buffer
+	if err := encodeRDB(&rdb, dbs); err != nil {
+		fmt.Println("Failed to encode RDB:", err)
+	}
+	Write(conn.Writer, psync(s.MasterReplid, offset))
+	Write(conn.Writer, &RESP{Type: RDB, Value: rdb.String()})
+
+	// Writes may be buffered while the previous ones are sent
+	for {
+		s.ReplMu.Lock()
+		buffered := conn.ReplBuffer
+		if len(buffered) == 0 {
+			conn.ReplBuffer = nil
+			s.ReplMu.Unlock()
+			break
+		}
+		conn.ReplBuffer = [][]byte{}
+		s.ReplMu.Unlock()
+
+		for _, b := range buffered {
+			Write(conn.Writer, b)
+		}
+	}
+	go s.checkOnReplica(conn, false)
+}
+
+// writeToReplica sends b to a replica, or buffers it while the replica waits
+// for its snapshot. Caller must hold ReplMu.
+func (s *Server) writeToReplica(conn *ConnRW, b []byte) {
+	if conn.ReplBuffer != nil {
+		conn.ReplBuffer = append(conn.ReplBuffer, b)
+		return
+	}
+	Write(conn.Writer, b)
+}
+
 func (s *Server) checkOnReplica(conn *ConnRW, featureOn bool) {
 	if !featureOn {
 		return
@@ -193,76 +551,68 @@ func (s *Server) decodeRDB(buf *Buffer) *RESP {
 		}
 	}
 
+	// Keys go to database 0 until a selector says otherwise
+	db := s.DBs[0]
 	for {
-		byt, _ := data.Peek(1)
-		if byt[0] == 0xff {
-			break
-		}
-		// Database section - 0xfe
-		data.ReadByte()
-
-		// This byte is the database index
-		// TODO - Implement support for multiple databases
-		decodeSize(data)
-
-		fb, err := data.ReadByte()
-		if err != nil || fb != 0xfb {
+		opcode, err := data.ReadByte()
+		if err != nil {
 			return ErrResp("Error reading database section")
 		}
+		switch opcode {
+		case 0xff:
+			return OkResp()
+		case 0xfe:
+			// Database selector
+			index, err := decodeSize(data)
+			if err != nil || index >= len(s.DBs) {
+				return ErrResp("Error reading database section")
+			}
+			db = s.DBs[index]
+			continue
+		case 0xfb:
+			// Hash table and expiry table sizes, only a hint
+			if _, err := decodeSize(data); err != nil {
+				return ErrResp("Error reading database section")
+			}
+			if _, err := decodeSize(data); err != nil {
+				return ErrResp("Error reading database section")
+			}
+			continue
+		}
+		data.UnreadByte()
 
-		dbsize, err := decodeSize(data)
+		// Expiry
+		expiryTime, err := dedodeTime(data)
 		if err != nil {
-			return ErrResp("Error reading database section")
+			return ErrResp("Error reading expiry")
 		}
 
-		// Expiry size
-		_, err = decodeSize(data)
+		// This byte is the value type
+		typ, err := data.ReadByte()
 		if err != nil {
-			return ErrResp("Error reading database section")
+			return ErrResp("Error reading value type")
 		}
 
-		// Iterate over keys
-		for i := 0; i < dbsize; i++ {
-			// Expiry
-			expiryTime, err := dedodeTime(data)
-			if err != nil {
-				return ErrResp("Error reading expiry")
-			}
-
-			// This byte is the key type
-			// TODO - Implement support for different key types
-			data.ReadByte()
-
-			// Key
-			key, err := decodeString(data)
-			if err != nil {
-				return ErrResp("Error reading key")
-			}
-
-			// Value
-			value, err := decodeString(data)
-			if err != nil {
-				return ErrResp("Error reading value")
-			}
-
-			s.SETsMu.Lock()
-			s.SETs[string(key)] = string(value)
-			if expiryTime > 0 {
-				s.EXPs[string(key)] = expiryTime
-				fmt.Println("Key: ", key, "Value: ", value, "Expiry: ", expiryTime)
-			}
-			s.SETsMu.Unlock()
+		// Key
+		key, err := decodeString(data)
+		if err != nil {
+			return ErrResp("Error reading key")
 		}
 
-		next, _ := data.Peek(1)
-		if next[0] == 0xff {
-			break
+		// Value
+		s.SETsMu.Lock()
+		err = db.decodeValue(data, typ, key)
+		if err == nil && expiryTime > 0 {
+			db.EXPs[key] = expiryTime
+		}
+		s.SETsMu.Unlock()
+		if err != nil {
+			return ErrResp("Error reading value")
 		}
 	}
-	return OkResp()
 }
 
-func (s *Server) keys(args []*RESP) *RESP {
+func (s *Server) keys(db *Database, args []*RESP) *RESP {
 	if len(args) != 1 {
 		return &RESP{Type: ERROR, Value: "ERR wrong number of arguments for 'keys' command"}
 	}
@@ -270,21 +620,16 @@ func (s *Server) keys(args []*RESP) *RESP {
 	pattern := args[0].Value
 	keys := []string{}
 
-	if pattern == "*" {
-		s.SETsMu.Lock()
-		for k := range s.SETs {
-			keys = append(keys, k)
+	s.SETsMu.Lock()
+	for _, k := range db.allKeys() {
+		if db.expireIfNeeded(k) {
+			continue
 		}
-		s.SETsMu.Unlock()
-	} else {
-		s.SETsMu.Lock()
-		for k := range s.SETs {
-			if strings.Contains(k, pattern) {
-				keys = append(keys, k)
-			}
+		if stringMatch(pattern, k) {
+			keys = append(keys, k)
 		}
-		s.SETsMu.Unlock()
 	}
+	s.SETsMu.Unlock()
 
 	return &RESP{
 		Type:   ARRAY,
@@ -292,272 +637,121 @@ func (s *Server) keys(args []*RESP) *RESP {
 	}
 }
 
-func (s *Server) set(args []*RESP) *RESP {
-	if !(len(args) == 2 || len(args) == 4) {
+func (s *Server) set(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
 		return &RESP{Type: ERROR, Value: "ERR wrong number of arguments for 'set' command"}
 	}
 	s.NeedAcks = true
-	var length int
-	if len(args) > 2 {
-		if strings.ToLower(args[2].Value) != "px" {
-			return &RESP{Type: ERROR, Value: "ERR syntax error"}
-		}
 
-		l, err := strconv.Atoi(args[3].Value)
-		if err != nil {
-			return &RESP{Type: ERROR, Value: "ERR value is not an integer or out of range"}
+	var nx, xx, get, keepTTL bool
+	var expireAt int64
+	expireOpt, expireIndex := "", 0
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Value)
+		switch opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireOpt != "" || i+1 >= len(args) {
+				return &RESP{Type: ERROR, Value: "ERR syntax error"}
+			}
+			expireOpt, expireIndex = opt, i
+			i++
+			at, errResp := parseExpireTime(opt, args[i].Value, "set")
+			if errResp != nil {
+				return errResp
+			}
+			expireAt = at
+		default:
+			return &RESP{Type: ERROR, Value: "ERR syntax error"}
 		}
-		length = l
+	}
+	if (nx && xx) || (keepTTL && expireOpt != "") {
+		return &RESP{Type: ERROR, Value: "ERR syntax error"}
 	}
 
 	key, value := args[0].Value, args[1].Value
 
 	s.SETsMu.Lock()
-	s.SETs[key] = value
-	if length > 0 {
-		// Set expiry time in milliseconds
-		s.EXPs[key] = time.Now().Add(time.Duration(length) * time.Millisecond).UnixMilli()
-	}
-	s.SETsMu.Unlock()
-
-	return OkResp()
-}
+	defer s.SETsMu.Unlock()
 
-func (s *Server) get(args []*RESP) *RESP {
-	if len(args) != 1 {
-		return &RESP{Type: ERROR, Value: "ERR wrong number of arguments for 'get' command"}
+	db.expireIfNeeded(key)
+	old, exists := db.SETs[key]
+	typ := db.typeOf(key)
+	if get && typ != "none" && typ != "string" {
+		return WrongTypeResp()
 	}
 
-	key := args[0].Value
-
-	s.SETsMu.Lock()
-	value, ok := s.SETs[key]
-	if exp, ok := s.EXPs[key]; ok {
-		expTime := time.UnixMilli(exp)
-		if time.Now().After(expTime) {
-			delete(s.SETs, key)
-			delete(s.EXPs, key)
-			s.SETsMu.Unlock()
-			return NullResp()
+	reply := OkResp()
+	if get {
+		reply = NullResp()
+		if exists {
+			reply = BulkString(string(old))
 		}
 	}
-	s.SETsMu.Unlock()
-
-	if !ok {
+	if (nx && typ != "none") || (xx && typ == "none") {
+		if get {
+			return reply
+		}
 		return NullResp()
 	}
 
-	return &RESP{Type: STRING, Value: value}
-}
-
-func (s *Server) xadd(args []*RESP) *RESP {
-	if len(args) < 2 {
-		return &RESP{Type: ERROR, Value: "ERR wrong number of arguments for 'xadd' command"}
-	}
-
-	streamKey := args[0].Value
-	stream, ok := s.XADDs[streamKey]
-	if !ok {
-		s.XADDsMu.Lock()
-		stream = radix.NewRadix()
-		s.XADDs[streamKey] = stream
-		stream.Insert("0-0", &StreamTop{Time: 0, Seq: 0})
-		s.XADDsMu.Unlock()
-	}
-
-	id := args[1].Value
-	time, seq, err := validateEntryID(stream, id)
-	if err != nil {
-		return ErrResp(err.Error())
-	}
-
-	entries := []*StreamKV{}
-	for i := 2; i < len(args); i += 2 {
-		entries = append(entries, &StreamKV{Key: args[i].Value, Value: args[i+1].Value})
+	if typ != "none" && typ != "string" {
+		db.deleteKey(key)
 	}
-
-	timeStr := intToStr(time) + "-" + intToStr(seq)
-	streamEntry := &StreamEntry{Seq: seq, Entries: entries}
-	stream.Insert(timeStr, streamEntry)
-	stream.Insert("0-0", &StreamTop{Time: time, Seq: seq})
-
-	if s.XREADsBlock {
-		s.XADDsCh <- false
+	db.setValue(key, value)
+	if expireOpt != "" {
+		db.EXPs[key] = expireAt
+	} else if !keepTTL {
+		delete(db.EXPs, key)
 	}
+	s.Dirty.Add(1)
 
-	return &RESP{Type: BULK, Value: timeStr}
-}
-
-func (s *Server) xrange(args []*RESP) *RESP {
-	if len(args) < 3 {
-		return &RESP{Type: ERROR, Value: "ERR wrong number of arguments for 'xrange' command"}
-	}
-
-	streamKey := args[0].Value
-	stream, ok := s.XADDs[streamKey]
-	if !ok {
-		return ErrResp("ERR stream not found")
-	}
-
-	// st = starttime, ss = startseq
-	st, ss, err := splitEntryId(args[1].Value)
-	if err != nil {
-		return ErrResp(err.Error())
-	}
-	if st == math.MinInt64 {
-		key, _, _ := stream.GetFirst()
-		st, ss, _ = splitEntryId(key)
-	}
-	// et = endtime, es = endseq
-	et, es, err := splitEntryId(args[2].Value)
-	if err != nil {
-		return ErrResp(err.Error())
-	}
-	if et == math.MaxInt64 {
-		key, _, _ := stream.GetLast()
-		et, es, _ = splitEntryId(key)
-	}
-
-	entries := []*RESP{}
-
-	for t := st; t <= et; t++ {
-		tStr := intToStr(t)
-		sEntries := stream.FindAll(tStr)
-		for _, e := range sEntries {
-			switch entry := e.(type) {
-			case *StreamEntry:
-				if t > st || t < et ||
-					(t == st && entry.Seq >= ss && t == et && entry.Seq <= es) {
-					outter := []*RESP{}
-					outter = append(outter, SimpleString(tStr+"-"+intToStr(entry.Seq)))
-					inner := make([]string, 0, len(entry.Entries)*2)
-					for _, en := range entry.Entries {
-						inner = append(inner, en.Key)
-						inner = append(inner, en.Value)
-					}
-					outter = append(outter, &RESP{Type: ARRAY, Values: ToRespArray(inner)})
-					entries = append(entries, &RESP{Type: ARRAY, Values: outter})
-				}
-			default:
-				continue
-			}
+	// Replicas get the expiry as a unix time, so one that applies the command
+	// late doesn't keep the key longer than the master
+	cmd := make([]string, 0, len(args)+1)
+	cmd = append(cmd, "SET")
+	for i, arg := range args {
+		switch {
+		case expireOpt != "" && i == expireIndex:
+			cmd = append(cmd, "PXAT")
+		case expireOpt != "" && i == expireIndex+1:
+			cmd = append(cmd, strconv.FormatInt(expireAt, 10))
+		default:
+			cmd = append(cmd, arg.Value)
 		}
 	}
-
-	return &RESP{Type: ARRAY, Values: entries}
+	s.propagateCommand(db, ToResp(cmd...))
+	return reply
 }
 
-func (s *Server) xread(args []*RESP) *RESP {
-	if len(args) < 3 {
-		return &RESP{Type: ERROR, Value: "ERR wrong number of arguments for 'xread' command"}
-	}
-
-	blockTime := -1
-	if strings.ToUpper(args[0].Value) == "BLOCK" {
-		t, err := strconv.Atoi(args[1].Value)
-		if err != nil {
-			return ErrResp("ERR block time is not an integer or out of range")
-		}
-		blockTime = t
-		args = args[2:]
-	}
-
-	if blockTime > 0 {
-		time.Sleep(time.Duration(blockTime) * time.Millisecond)
-	} else if blockTime == 0 {
-		s.XREADsBlock = true
-		s.XREADsBlock = <-s.XADDsCh
+func (s *Server) get(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return &RESP{Type: ERROR, Value: "ERR wrong number of arguments for 'get' command"}
 	}
 
-	if args[0].Value != "streams" {
-		return &RESP{Type: ERROR, Value: "ERR can only read streams at the moment"}
-	}
+	key := args[0].Value
 
-	args = args[1:]
-	if len(args)%2 != 0 {
-		return ErrResp("Err wrong number of arguments for 'xread' command")
+	s.SETsMu.Lock()
+	db.expireIfNeeded(key)
+	value, ok := db.SETs[key]
+	if !ok && db.typeOf(key) != "none" {
+		s.SETsMu.Unlock()
+		return WrongTypeResp()
 	}
+	s.SETsMu.Unlock()
 
-	readLen := len(args) / 2
-
-	streamLst := []*RESP{}
-
-	for i := 0; i < readLen; i++ {
-		streamKey := args[i].Value
-		stream, ok := s.XADDs[streamKey]
-		if !ok {
-			return ErrResp("ERR stream not found")
-		}
-
-		start := args[i+readLen].Value
-		if start == "$" {
-			start, _, _ = stream.GetLast()
-		} else {
-			start, _, ok = stream.GetNext(start)
-			if !ok {
-				return NullResp()
-			}
-		}
-		// st = starttime, ss = startseq
-		st, ss, err := splitEntryId(start)
-		if err != nil {
-			return ErrResp(err.Error())
-		}
-
-		// et == endtime, es = endseq
-		last, _, _ := stream.GetLast()
-		et, es, _ := splitEntryId(last)
-
-		entryLst := []*RESP{BulkString(streamKey)}
-
-		for t := st; t <= et; t++ {
-			tLst := []*RESP{}
-			tStr := intToStr(t)
-			sEntries := stream.FindAll(tStr)
-			for _, e := range sEntries {
-				switch entry := e.(type) {
-				case *StreamEntry:
-					if t > st || t < et ||
-						(t == st && entry.Seq >= ss && t == et && entry.Seq <= es) {
-						idLst := []*RESP{BulkString(tStr + "-" + intToStr(entry.Seq))}
-						kvLst := make([]string, 0, len(entry.Entries)*2)
-						for _, en := range entry.Entries {
-							kvLst = append(kvLst, en.Key)
-							kvLst = append(kvLst, en.Value)
-						}
-						idLst = append(idLst, &RESP{Type: ARRAY, Values: ToRespArray(kvLst)})
-						tLst = append(tLst, &RESP{Type: ARRAY, Values: idLst})
-					}
-				default:
-					continue
-				}
-			}
-			entryLst = append(entryLst, &RESP{Type: ARRAY, Values: tLst})
-		}
-		streamLst = append(streamLst, &RESP{Type: ARRAY, Values: entryLst})
+	if !ok {
+		return NullResp()
 	}
 
-	return &RESP{Type: ARRAY, Values: streamLst}
-}
-
-func (s *Server) incr(args []*RESP) *RESP {
-	if len(args) != 1 {
-		return ErrResp("ERR wrong number of arguments for 'incr' command")
-	}
-	key := args[0].Value
-	s.SETsMu.Lock()
-	defer s.SETsMu.Unlock()
-	if val, ok := s.SETs[key]; ok {
-		val, err := strconv.ParseInt(val, 10, 64)
-		if err != nil {
-			return ErrResp("ERR value is not an integer or out of range")
-		}
-		s.SETs[key] = intToStr(val + 1)
-		return Integer(val + 1)
-	} else {
-		s.SETs[key] = "1"
-		return Integer(1)
-	}
+	return BulkString(string(value))
 }
 
 func (s *Server) replConfig(args []*RESP, conn *ConnRW) (resp *RESP) {
@@ -611,11 +805,13 @@ func (s *Server) wait(args []*RESP) *RESP {
 
 	s.RedirectRead = true
 	go func() {
+		s.ReplMu.Lock()
+		defer s.ReplMu.Unlock()
 		for _, c := range s.Conns {
 			if c.Type != REPLICA {
 				continue
 			}
-			Write(c.Writer, getAck)
+			s.writeToReplica(c, getAck)
 		}
 	}()
 
@@ -704,31 +900,80 @@ func (s *Server) discard() *RESP {
 }
 
 func (s *Server) config(args []*RESP) *RESP {
-	if strings.ToUpper(args[0].Value) == "GET" {
-		if strings.ToLower(args[1].Value) == "dir" {
-			return &RESP{
-				Type: ARRAY,
-				Values: []*RESP{
-					{Type: STRING, Value: "dir"},
-					{Type: STRING, Value: s.Dir},
-				},
-			}
+	if len(args) == 2 && strings.ToUpper(args[0].Value) == "GET" {
+		name := strings.ToLower(args[1].Value)
+		var value string
+		switch name {
+		case "dir":
+			value = s.Dir
+		case "dbfilename":
+			value = s.Dbfilename
+		case "hz":
+			s.SETsMu.RLock()
+			value = strconv.Itoa(s.Hz)
+			s.SETsMu.RUnlock()
+		case "active-expire-effort":
+			s.SETsMu.RLock()
+			value = strconv.Itoa(s.ExpireEffort)
+			s.SETsMu.RUnlock()
+		case "databases":
+			value = strconv.Itoa(len(s.DBs))
+		case "save":
+			s.SETsMu.RLock()
+			value = saveParamsString(s.SaveParams)
+			s.SETsMu.RUnlock()
+		default:
+			return &RESP{Type: ARRAY, Values: []*RESP{}}
 		}
 		return &RESP{
 			Type: ARRAY,
 			Values: []*RESP{
-				{Type: STRING, Value: "dbfilename"},
-				{Type: STRING, Value: s.Dbfilename},
+				{Type: STRING, Value: name},
+				{Type: STRING, Value: value},
 			},
 		}
 	}
+	if len(args) == 3 && strings.ToUpper(args[0].Value) == "SET" {
+		return s.configSet(strings.ToLower(args[1].Value), args[2].Value)
+	}
 	return &RESP{
 		Type:  ERROR,
 		Value: "ERR unknown subcommand or wrong number of arguments",
 	}
 }
 
-func (s *Server) typecmd(args []*RESP) *RESP {
+func (s *Server) configSet(name, value string) *RESP {
+	n, err := strconv.Atoi(value)
+	switch name {
+	case "hz":
+		if err != nil || n < 0 {
+			return ErrResp("ERR CONFIG SET failed (possibly related to argument 'hz') - argument couldn't be parsed into an integer")
+		}
+		s.SETsMu.Lock()
+		s.Hz = min(max(n, 1), maxHz)
+		s.SETsMu.Unlock()
+	case "active-expire-effort":
+		if err != nil || n < 1 || n > maxExpireEffort {
+			return ErrResp("ERR CONFIG SET failed (possibly related to argument 'active-expire-effort') - argument must be between 1 and 10 inclusive")
+		}
+		s.SETsMu.Lock()
+		s.ExpireEffort = n
+		s.SETsMu.Unlock()
+	case "save":
+		params, err := parseSaveParams(value)
+		if err != nil {
+			return ErrResp("ERR CONFIG SET failed (possibly related to argument 'save') - Invalid save parameters")
+		}
+		s.SETsMu.Lock()
+		s.SaveParams = params
+		s.SETsMu.Unlock()
+	default:
+		return ErrResp("ERR Unknown option or number of arguments for CONFIG SET - '" + name + "'")
+	}
+	return OkResp()
+}
+
+func (s *Server) typecmd(db *Database, args []*RESP) *RESP {
 	if len(args) == 0 {
 		return ErrResp("Err no key given to TYPE command")
 	}
@@ -739,20 +984,11 @@ func (s *Server) typecmd(args []*RESP) *RESP {
 	key := args[0].Value
 
 	s.SETsMu.Lock()
-	_, ok := s.SETs[key]
+	db.expireIfNeeded(key)
+	t := db.typeOf(key)
 	s.SETsMu.Unlock()
-	if ok {
-		return SimpleString("string")
-	}
-
-	s.XADDsMu.Lock()
-	_, ok = s.XADDs[key]
-	s.XADDsMu.Unlock()
-	if ok {
-		return SimpleString("stream")
-	}
 
-	return SimpleString("none")
+	return SimpleString(t)
 }
 
 // ----------------------------------------------------------------------------
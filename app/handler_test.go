@@ -1,7 +1,9 @@
 package main
 
 import (
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestPing(t *testing.T) {
@@ -49,6 +51,97 @@ func TestSet(t *testing.T) {
 	}
 }
 
+func TestSetOptions(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"SET", "set:lock", "a", "NX", "PX", "30000"}, STRING, "OK"},
+		{[]string{"SET", "set:lock", "b", "NX"}, 0, ""},
+		{[]string{"SET", "set:lock", "b", "XX", "GET", "KEEPTTL"}, BULK, "a"},
+		{[]string{"SET", "set:missing", "b", "XX", "GET"}, 0, ""},
+		{[]string{"SET", "set:lock", "c", "NX", "XX"}, ERROR, "ERR syntax error"},
+		{[]string{"SET", "set:lock", "c", "EX", "1", "PX", "1000"}, ERROR, "ERR syntax error"},
+		{[]string{"SET", "set:lock", "c", "KEEPTTL", "EXAT", "1"}, ERROR, "ERR syntax error"},
+		{[]string{"SET", "set:lock", "c", "EX", "0"}, ERROR, "ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "set:lock", "c", "PX", "ten"}, ERROR, "ERR value is not an integer or out of range"},
+		{[]string{"SET", "set:lock", "c", "EX"}, ERROR, "ERR syntax error"},
+		{[]string{"LPUSH", "set:list", "a"}, INTEGER, "1"},
+		{[]string{"SET", "set:list", "b", "GET"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+
+	// A plain SET clears the expiry while KEEPTTL keeps it
+	Write(conn.Writer, ToResp("SET", "set:expiring", "a", "PX", "50"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SET", "set:expiring", "b"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SET", "set:kept", "a", "PXAT", intToStr(time.Now().UnixMilli()+50)))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SET", "set:kept", "b", "KEEPTTL"))
+	conn.Buffer.Read()
+	time.Sleep(100 * time.Millisecond)
+
+	Write(conn.Writer, ToResp("GET", "set:expiring"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Value != "b" {
+		t.Errorf("Expected b, got %v", parsedResp)
+	}
+	Write(conn.Writer, ToResp("GET", "set:kept"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != 0 {
+		t.Errorf("Expected nil, got %v", parsedResp)
+	}
+}
+
+func TestSetPropagatesAbsoluteExpiry(t *testing.T) {
+	db := NewDatabase(0)
+	replica := &ConnRW{Type: REPLICA, ReplBuffer: [][]byte{}}
+	server := &Server{DBs: []*Database{db}, Conns: []*ConnRW{replica}}
+	conn := &ConnRW{RedirectRead: true}
+
+	// Relative expiries reach replicas as the unix time set on the master
+	tests := []struct {
+		args     []string
+		expected func(at string) []string
+	}{
+		{[]string{"SET", "expiry:ex", "a", "EX", "100"}, func(at string) []string {
+			return []string{"SET", "expiry:ex", "a", "PXAT", at}
+		}},
+		{[]string{"SET", "expiry:px", "a", "NX", "PX", "100000", "GET"}, func(at string) []string {
+			return []string{"SET", "expiry:px", "a", "NX", "PXAT", at, "GET"}
+		}},
+		{[]string{"SET", "expiry:none", "a"}, func(string) []string {
+			return []string{"SET", "expiry:none", "a"}
+		}},
+	}
+	for _, test := range tests {
+		server.Handler(ToResp(test.args...), conn)
+		at := strconv.FormatInt(db.EXPs[test.args[1]], 10)
+		expected := string(ToResp(test.expected(at)...).Marshal())
+		if got := string(replica.ReplBuffer[len(replica.ReplBuffer)-1]); got != expected {
+			t.Errorf("%v: expected %q, got %q", test.args, expected, got)
+		}
+	}
+
+	// Writes that don't happen are not propagated
+	server.Handler(ToResp("SET", "expiry:ex", "b", "NX", "EX", "100"), conn)
+	if len(replica.ReplBuffer) != len(tests) {
+		t.Errorf("Expected %d propagated commands, got %d", len(tests), len(replica.ReplBuffer))
+	}
+}
+
 func TestGet(t *testing.T) {
 	createMasterServer("6379")
 	conn := connectToServer("6379")
@@ -65,7 +158,7 @@ func TestGet(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed to read response: %v", err)
 	}
-	if parsedResp.Type != STRING || parsedResp.Value != "bar" {
+	if parsedResp.Type != BULK || parsedResp.Value != "bar" {
 		t.Errorf("Expected GET response, got %v", parsedResp)
 	}
 }
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// Hash commands --------------------------------------------------------------
+func (s *Server) hset(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return ErrResp("ERR wrong number of arguments for 'hset' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, true)
+	if errResp != nil {
+		return errResp
+	}
+
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := hash[args[i].Value]; !ok {
+			added++
+		}
+		hash[args[i].Value] = args[i+1].Value
+	}
+	s.Dirty.Add(int64(len(args) / 2))
+	return Integer(added)
+}
+
+func (s *Server) hmset(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return ErrResp("ERR wrong number of arguments for 'hmset' command")
+	}
+	if resp := s.hset(db, args); resp.Type == ERROR {
+		return resp
+	}
+	return OkResp()
+}
+
+func (s *Server) hsetnx(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'hsetnx' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, true)
+	if errResp != nil {
+		return errResp
+	}
+
+	if _, ok := hash[args[1].Value]; ok {
+		return Integer(0)
+	}
+	hash[args[1].Value] = args[2].Value
+	s.Dirty.Add(1)
+	return Integer(1)
+}
+
+func (s *Server) hget(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'hget' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	value, ok := hash[args[1].Value]
+	if !ok {
+		return NullResp()
+	}
+	return BulkString(value)
+}
+
+func (s *Server) hmget(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'hmget' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	values := make([]*RESP, 0, len(args)-1)
+	for _, field := range args[1:] {
+		if value, ok := hash[field.Value]; ok {
+			values = append(values, BulkString(value))
+		} else {
+			values = append(values, NullResp())
+		}
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+func (s *Server) hgetall(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'hgetall' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	values := make([]string, 0, len(hash)*2)
+	for field, value := range hash {
+		values = append(values, field, value)
+	}
+	return ToResp(values...)
+}
+
+func (s *Server) hkeys(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'hkeys' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	return ToResp(fields...)
+}
+
+func (s *Server) hvals(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'hvals' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	values := make([]string, 0, len(hash))
+	for _, value := range hash {
+		values = append(values, value)
+	}
+	return ToResp(values...)
+}
+
+func (s *Server) hlen(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'hlen' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+	return Integer(len(hash))
+}
+
+func (s *Server) hexists(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'hexists' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	if _, ok := hash[args[1].Value]; ok {
+		return Integer(1)
+	}
+	return Integer(0)
+}
+
+func (s *Server) hdel(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'hdel' command")
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(key, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		if _, ok := hash[field.Value]; ok {
+			delete(hash, field.Value)
+			deleted++
+		}
+	}
+	if hash != nil && len(hash) == 0 {
+		db.deleteKey(key)
+	}
+	s.Dirty.Add(int64(deleted))
+	return Integer(deleted)
+}
+
+func (s *Server) hincrby(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'hincrby' command")
+	}
+
+	incr, err := strconv.ParseInt(args[2].Value, 10, 64)
+	if err != nil {
+		return ErrResp("ERR value is not an integer or out of range")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, true)
+	if errResp != nil {
+		return errResp
+	}
+
+	var current int64
+	if value, ok := hash[args[1].Value]; ok {
+		current, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return ErrResp("ERR hash value is not an integer")
+		}
+	}
+	if (incr > 0 && current > math.MaxInt64-incr) || (incr < 0 && current < math.MinInt64-incr) {
+		return ErrResp("ERR increment or decrement would overflow")
+	}
+
+	hash[args[1].Value] = strconv.FormatInt(current+incr, 10)
+	s.Dirty.Add(1)
+	return Integer(current + incr)
+}
+
+func (s *Server) hstrlen(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'hstrlen' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	hash, errResp := db.getHash(args[0].Value, false)
+	if errResp != nil {
+		return errResp
+	}
+	return Integer(len(hash[args[1].Value]))
+}
+
+// ----------------------------------------------------------------------------
+
+// Hash helpers ---------------------------------------------------------------
+// getHash returns the hash stored at key, or a WRONGTYPE error if the key holds
+// another type. A missing key returns nil unless create is set, in which case
+// an empty hash is stored at key. Caller must hold SETsMu.
+func (db *Database) getHash(key string, create bool) (map[string]string, *RESP) {
+	db.expireIfNeeded(key)
+	hash, ok := db.HSETs[key]
+	if ok {
+		return hash, nil
+	}
+	if db.typeOf(key) != "none" {
+		return nil, WrongTypeResp()
+	}
+	if create {
+		hash = map[string]string{}
+		db.setValue(key, hash)
+	}
+	return hash, nil
+}
+
+// ----------------------------------------------------------------------------
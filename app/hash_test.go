@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHsetAndHget(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("HSET", "hash:user", "name", "ada", "age", "36"))
+	parsedResp, _, err := conn.Buffer.Read()
+	if err != nil {
+		t.Errorf("Failed to read response: %v", err)
+	}
+	if parsedResp.Type != INTEGER || parsedResp.Value != "2" {
+		t.Errorf("Expected 2, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("HSET", "hash:user", "name", "grace"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "0" {
+		t.Errorf("Expected 0, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("HGET", "hash:user", "name"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != BULK || parsedResp.Value != "grace" {
+		t.Errorf("Expected grace, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("HMGET", "hash:user", "age", "missing"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 ||
+		parsedResp.Values[0].Value != "36" || parsedResp.Values[1].Type != 0 {
+		t.Errorf("Expected [36 nil], got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("HGETALL", "hash:user"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 4 {
+		t.Errorf("Expected 4 values, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("TYPE", "hash:user"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Value != "hash" {
+		t.Errorf("Expected hash, got %v", parsedResp)
+	}
+}
+
+func TestHincrbyAndHdel(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("HINCRBY", "hash:counter", "hits", "5"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "5" {
+		t.Errorf("Expected 5, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("HINCRBY", "hash:counter", "hits", "9223372036854775807"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ERROR || !strings.Contains(parsedResp.Value, "overflow") {
+		t.Errorf("Expected overflow error, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("HDEL", "hash:counter", "hits", "missing"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "1" {
+		t.Errorf("Expected 1, got %v", parsedResp)
+	}
+
+	// The key is removed once the hash is empty
+	Write(conn.Writer, ToResp("HLEN", "hash:counter"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "0" {
+		t.Errorf("Expected 0, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("SET", "hash:string", "a"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("HGET", "hash:string", "a"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ERROR || !strings.HasPrefix(parsedResp.Value, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE error, got %v", parsedResp)
+	}
+}
+
+func TestHashRDB(t *testing.T) {
+	var rdb bytes.Buffer
+	rdb.WriteString("REDIS0011")
+	rdb.Write([]byte{0xFE, 0x00, 0xFB, 0x02, 0x00})
+	// Hash encoded as a plain list of fields and values
+	rdb.Write([]byte{RDB_HASH, 0x01, 'h', 0x01, 0x01, 'f', 0x01, 'v'})
+	// Hash encoded as a listpack
+	rdb.Write([]byte{RDB_HASH_LISTPACK, 0x02, 'l', 'p', 0x0C,
+		0x0C, 0x00, 0x00, 0x00, 0x02, 0x00, 0x81, 'a', 0x02, 0x01, 0x01, 0xFF})
+	rdb.Write([]byte{0xFF, 0, 0, 0, 0, 0, 0, 0, 0})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dump.rdb"), rdb.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write rdb: %v", err)
+	}
+
+	server, err := NewServer(&Config{Port: "6390", Dir: dir, Dbfilename: "dump.rdb"})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Listener.Close()
+
+	if server.DBs[0].HSETs["h"]["f"] != "v" {
+		t.Errorf("Expected h.f to be v, got %v", server.DBs[0].HSETs["h"])
+	}
+	if server.DBs[0].HSETs["lp"]["a"] != "1" {
+		t.Errorf("Expected lp.a to be 1, got %v", server.DBs[0].HSETs["lp"])
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	hyperloglog "github.com/elordeiro/redis-server/hyperloglog"
+)
+
+// HyperLogLog commands -------------------------------------------------------
+func (s *Server) pfadd(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'pfadd' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	hll, exists, errResp := db.getHLL(key)
+	if errResp != nil {
+		return errResp
+	}
+	if !exists {
+		hll = hyperloglog.New()
+	}
+
+	elements := make([]string, 0, len(args)-1)
+	for _, element := range args[1:] {
+		elements = append(elements, element.Value)
+	}
+	hll, changed, err := hyperloglog.Add(hll, elements...)
+	if err != nil {
+		return ErrResp("INVALIDOBJ Corrupted HLL object detected")
+	}
+	if !exists || changed {
+		db.setValue(key, hll)
+		s.Dirty.Add(1)
+		return Integer(1)
+	}
+	return Integer(0)
+}
+
+func (s *Server) pfcount(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'pfcount' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	// A single key uses and updates the cached count
+	if len(args) == 1 {
+		hll, exists, errResp := db.getHLL(args[0].Value)
+		if errResp != nil {
+			return errResp
+		}
+		if !exists {
+			return Integer(0)
+		}
+		count, err := hyperloglog.Count(hll)
+		if err != nil {
+			return ErrResp("INVALIDOBJ Corrupted HLL object detected")
+		}
+		return Integer(int64(count))
+	}
+
+	registers, _, errResp := db.mergeHLLs(args)
+	if errResp != nil {
+		return errResp
+	}
+	return Integer(int64(hyperloglog.CountRegisters(registers)))
+}
+
+func (s *Server) pfmerge(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'pfmerge' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	// The destination is merged too, and stays dense once any value is
+	registers, dense, errResp := db.mergeHLLs(args)
+	if errResp != nil {
+		return errResp
+	}
+	db.setValue(args[0].Value, hyperloglog.Encode(registers, dense))
+	s.Dirty.Add(1)
+	return OkResp()
+}
+
+// ----------------------------------------------------------------------------
+
+// HyperLogLog helpers --------------------------------------------------------
+// getHLL returns the HyperLogLog stored at key and whether it exists, or an
+// error if the key holds anything else. Caller must hold SETsMu.
+func (db *Database) getHLL(key string) ([]byte, bool, *RESP) {
+	hll, exists, errResp := db.getBytes(key)
+	if errResp != nil {
+		return nil, false, errResp
+	}
+	if exists && !hyperloglog.Valid(hll) {
+		return nil, false, ErrResp("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	}
+	return hll, exists, nil
+}
+
+// mergeHLLs returns the largest value of every register across the
+// HyperLogLogs at keys, and whether any of them is dense. Missing keys are
+// skipped. Caller must hold SETsMu.
+func (db *Database) mergeHLLs(keys []*RESP) ([]uint8, bool, *RESP) {
+	registers := make([]uint8, hyperloglog.Registers)
+	dense := false
+	for _, key := range keys {
+		hll, exists, errResp := db.getHLL(key.Value)
+		if errResp != nil {
+			return nil, false, errResp
+		}
+		if !exists {
+			continue
+		}
+		if err := hyperloglog.Merge(registers, hll); err != nil {
+			return nil, false, ErrResp("INVALIDOBJ Corrupted HLL object detected")
+		}
+		dense = dense || hyperloglog.IsDense(hll)
+	}
+	return registers, dense, nil
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	for _, args := range [][]string{
+		{"SET", "hll:string", "not a hll"},
+		{"RPUSH", "hll:list", "a"},
+		{"SET", "hll:corrupt", "HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x00"},
+	} {
+		Write(conn.Writer, ToResp(args...))
+		conn.Buffer.Read()
+	}
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"PFADD", "hll:a"}, INTEGER, "1"},
+		{[]string{"PFADD", "hll:a"}, INTEGER, "0"},
+		{[]string{"PFCOUNT", "hll:a"}, INTEGER, "0"},
+		{[]string{"PFADD", "hll:a", "a", "b", "c", "d", "e", "f", "g"}, INTEGER, "1"},
+		{[]string{"PFADD", "hll:a", "a", "b"}, INTEGER, "0"},
+		{[]string{"PFCOUNT", "hll:a"}, INTEGER, "7"},
+		{[]string{"PFADD", "hll:b", "e", "f", "g", "h", "i"}, INTEGER, "1"},
+		{[]string{"PFCOUNT", "hll:a", "hll:b"}, INTEGER, "9"},
+		{[]string{"PFCOUNT", "hll:a", "hll:missing"}, INTEGER, "7"},
+		{[]string{"PFCOUNT", "hll:missing"}, INTEGER, "0"},
+		{[]string{"PFMERGE", "hll:c", "hll:a", "hll:b"}, STRING, "OK"},
+		{[]string{"PFCOUNT", "hll:c"}, INTEGER, "9"},
+		{[]string{"PFMERGE", "hll:c"}, STRING, "OK"},
+		{[]string{"PFCOUNT", "hll:c"}, INTEGER, "9"},
+		{[]string{"PFMERGE", "hll:d"}, STRING, "OK"},
+		{[]string{"PFCOUNT", "hll:d"}, INTEGER, "0"},
+		{[]string{"TYPE", "hll:d"}, STRING, "string"},
+		{[]string{"PFADD", "hll:string", "a"}, ERROR, "WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{[]string{"PFCOUNT", "hll:string"}, ERROR, "WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{[]string{"PFMERGE", "hll:c", "hll:string"}, ERROR, "WRONGTYPE Key is not a valid HyperLogLog string value."},
+		{[]string{"PFADD", "hll:list", "a"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"PFCOUNT", "hll:a", "hll:list"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"PFADD"}, ERROR, "ERR wrong number of arguments for 'pfadd' command"},
+		{[]string{"PFCOUNT", "hll:corrupt"}, ERROR, "INVALIDOBJ Corrupted HLL object detected"},
+		{[]string{"PFADD", "hll:corrupt", "a"}, ERROR, "INVALIDOBJ Corrupted HLL object detected"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
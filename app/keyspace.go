@@ -0,0 +1,507 @@
+package main
+
+import (
+	"container/list"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	zset "github.com/elordeiro/redis-server/zset"
+)
+
+// Keyspace commands ----------------------------------------------------------
+func (s *Server) del(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'del' command")
+	}
+	return s.delGeneric(db, args, false)
+}
+
+func (s *Server) unlink(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'unlink' command")
+	}
+	return s.delGeneric(db, args, true)
+}
+
+func (s *Server) exists(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'exists' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	count := 0
+	for _, key := range args {
+		db.expireIfNeeded(key.Value)
+		if db.typeOf(key.Value) != "none" {
+			count++
+		}
+	}
+	return Integer(count)
+}
+
+func (s *Server) rename(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'rename' command")
+	}
+	if resp := s.renameGeneric(db, args[0].Value, args[1].Value, false); resp.Type == ERROR {
+		return resp
+	}
+	return OkResp()
+}
+
+func (s *Server) renamenx(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'renamenx' command")
+	}
+	return s.renameGeneric(db, args[0].Value, args[1].Value, true)
+}
+
+func (s *Server) copy(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'copy' command")
+	}
+
+	src, dst := args[0].Value, args[1].Value
+	dstDB := db
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			i++
+			index, errResp := s.parseDBIndex(args[i].Value)
+			if errResp != nil {
+				return errResp
+			}
+			dstDB = s.DBs[index]
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+	if src == dst && dstDB == db {
+		return ErrResp("ERR source and destination objects are the same")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	db.expireIfNeeded(src)
+	dstDB.expireIfNeeded(dst)
+	value := db.getValue(src)
+	if value == nil {
+		return Integer(0)
+	}
+	if dstDB.typeOf(dst) != "none" {
+		if !replace {
+			return Integer(0)
+		}
+		dstDB.deleteKey(dst)
+	}
+
+	dstDB.setValue(dst, copyValue(value))
+	if exp, ok := db.EXPs[src]; ok {
+		dstDB.EXPs[dst] = exp
+	}
+	s.signalKeyReady(dstDB, dst)
+	s.Dirty.Add(1)
+	return Integer(1)
+}
+
+func (s *Server) randomkey(db *Database, args []*RESP) *RESP {
+	if len(args) != 0 {
+		return ErrResp("ERR wrong number of arguments for 'randomkey' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	keys := db.allKeys()
+	for len(keys) > 0 {
+		i := rand.IntN(len(keys))
+		if !db.expireIfNeeded(keys[i]) {
+			return BulkString(keys[i])
+		}
+		keys[i] = keys[len(keys)-1]
+		keys = keys[:len(keys)-1]
+	}
+	return NullResp()
+}
+
+func (s *Server) dbsize(db *Database, args []*RESP) *RESP {
+	if len(args) != 0 {
+		return ErrResp("ERR wrong number of arguments for 'dbsize' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	return Integer(db.KEYs.Len())
+}
+
+func (s *Server) scan(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'scan' command")
+	}
+
+	cursor, err := strconv.ParseUint(args[0].Value, 10, 64)
+	if err != nil {
+		return ErrResp("ERR invalid cursor")
+	}
+
+	pattern, typ, count := "*", "", defaultScanCount
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return ErrResp("ERR syntax error")
+		}
+		switch strings.ToUpper(args[i].Value) {
+		case "MATCH":
+			pattern = args[i+1].Value
+		case "TYPE":
+			typ = strings.ToLower(args[i+1].Value)
+		case "COUNT":
+			n, errResp := parseInt(args[i+1].Value)
+			if errResp != nil {
+				return errResp
+			}
+			if n < 1 {
+				return ErrResp("ERR syntax error")
+			}
+			count = n
+		default:
+			return ErrResp("ERR syntax error")
+		}
+		i++
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	elements, next := db.scanKeys(cursor, count)
+	keys := []string{}
+	for _, e := range elements {
+		if db.expireIfNeeded(e.Member) || !stringMatch(pattern, e.Member) {
+			continue
+		}
+		if typ != "" && db.typeOf(e.Member) != typ {
+			continue
+		}
+		keys = append(keys, e.Member)
+	}
+	return &RESP{
+		Type:   ARRAY,
+		Values: []*RESP{BulkString(strconv.FormatUint(next, 10)), ToResp(keys...)},
+	}
+}
+
+func (s *Server) flushdb(db *Database, args []*RESP) *RESP {
+	return s.flushGeneric([]*Database{db}, args, "flushdb")
+}
+
+func (s *Server) flushall(args []*RESP) *RESP {
+	return s.flushGeneric(s.DBs, args, "flushall")
+}
+
+// ----------------------------------------------------------------------------
+
+// Database commands ----------------------------------------------------------
+func (s *Server) selectDB(args []*RESP, conn *ConnRW) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'select' command")
+	}
+	index, errResp := s.parseDBIndex(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	conn.DB = index
+	return OkResp()
+}
+
+func (s *Server) movecmd(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'move' command")
+	}
+	key := args[0].Value
+	index, errResp := s.parseDBIndex(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+	dstDB := s.DBs[index]
+	if dstDB == db {
+		return ErrResp("ERR source and destination objects are the same")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	db.expireIfNeeded(key)
+	dstDB.expireIfNeeded(key)
+	value := db.getValue(key)
+	if value == nil || dstDB.typeOf(key) != "none" {
+		return Integer(0)
+	}
+
+	exp, hasExpiry := db.EXPs[key]
+	db.deleteKey(key)
+	dstDB.setValue(key, value)
+	if hasExpiry {
+		dstDB.EXPs[key] = exp
+	}
+	s.signalKeyReady(dstDB, key)
+	s.Dirty.Add(1)
+	return Integer(1)
+}
+
+func (s *Server) swapdb(args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'swapdb' command")
+	}
+	first, err := strconv.Atoi(args[0].Value)
+	if err != nil {
+		return ErrResp("ERR invalid first DB index")
+	}
+	second, err := strconv.Atoi(args[1].Value)
+	if err != nil {
+		return ErrResp("ERR invalid second DB index")
+	}
+	if first < 0 || first >= len(s.DBs) || second < 0 || second >= len(s.DBs) {
+		return ErrResp("ERR DB index is out of range")
+	}
+	if first == second {
+		return OkResp()
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	a, b := s.DBs[first], s.DBs[second]
+	a.swap(b)
+	s.Dirty.Add(1)
+
+	// Clients stay blocked on the same index, which now holds other keys
+	for _, db := range []*Database{a, b} {
+		for key := range db.BLOCKs {
+			s.signalKeyReady(db, key)
+		}
+	}
+	return OkResp()
+}
+
+// ----------------------------------------------------------------------------
+
+// Keyspace command helpers ---------------------------------------------------
+// delGeneric deletes keys and replies with the number deleted. If async is
+// set their values are freed on a background goroutine.
+func (s *Server) delGeneric(db *Database, args []*RESP, async bool) *RESP {
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	deleted := 0
+	values := []any{}
+	for _, key := range args {
+		if db.expireIfNeeded(key.Value) {
+			continue
+		}
+		value := db.getValue(key.Value)
+		if value == nil {
+			continue
+		}
+		db.deleteKey(key.Value)
+		values = append(values, value)
+		deleted++
+	}
+	s.Dirty.Add(int64(deleted))
+
+	if async {
+		go func() {
+			for _, value := range values {
+				freeValue(value)
+			}
+		}()
+	}
+	return Integer(deleted)
+}
+
+// renameGeneric moves the value and expiry at src to dst, replacing dst
+// unless nx is set. Replies with 1 if the key was renamed and 0 otherwise.
+func (s *Server) renameGeneric(db *Database, src, dst string, nx bool) *RESP {
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	db.expireIfNeeded(src)
+	db.expireIfNeeded(dst)
+	value := db.getValue(src)
+	if value == nil {
+		return ErrResp("ERR no such key")
+	}
+	if src == dst {
+		if nx {
+			return Integer(0)
+		}
+		return Integer(1)
+	}
+	if nx && db.typeOf(dst) != "none" {
+		return Integer(0)
+	}
+
+	exp, hasExpiry := db.EXPs[src]
+	db.deleteKey(src)
+	db.deleteKey(dst)
+	db.setValue(dst, value)
+	if hasExpiry {
+		db.EXPs[dst] = exp
+	}
+	s.signalKeyReady(db, dst)
+	s.Dirty.Add(1)
+	return Integer(1)
+}
+
+// parseDBIndex parses the index of one of the databases.
+func (s *Server) parseDBIndex(value string) (int, *RESP) {
+	index, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, ErrResp("ERR value is not an integer or out of range")
+	}
+	if index < 0 || index >= len(s.DBs) {
+		return 0, ErrResp("ERR DB index is out of range")
+	}
+	return index, nil
+}
+
+// swap exchanges the keys of db and other. Blocked clients and the ID stay
+// with their database. Caller must hold SETsMu.
+func (db *Database) swap(other *Database) {
+	db.SETs, other.SETs = other.SETs, db.SETs
+	db.EXPs, other.EXPs = other.EXPs, db.EXPs
+	db.LISTs, other.LISTs = other.LISTs, db.LISTs
+	db.HSETs, other.HSETs = other.HSETs, db.HSETs
+	db.SADDs, other.SADDs = other.SADDs, db.SADDs
+	db.ZADDs, other.ZADDs = other.ZADDs, db.ZADDs
+	db.KEYs, other.KEYs = other.KEYs, db.KEYs
+
+	// Lock in index order so concurrent swaps can't deadlock
+	first, second := db, other
+	if first.ID > second.ID {
+		first, second = second, first
+	}
+	first.XADDsMu.Lock()
+	second.XADDsMu.Lock()
+	db.XADDs, other.XADDs = other.XADDs, db.XADDs
+	second.XADDsMu.Unlock()
+	first.XADDsMu.Unlock()
+}
+
+// Number of keys SCAN looks at when no COUNT is given
+const defaultScanCount = 10
+
+// scanKeys returns about count keys from the scan index starting at cursor,
+// and the cursor to continue from, which is 0 once every key was returned.
+// The index orders keys by a hash of their name, and a cursor is the hash to
+// resume from, so keys that exist for the whole iteration are returned
+// exactly once however the keyspace changes in between. Keys sharing a hash
+// are always returned together. Caller must hold SETsMu.
+func (db *Database) scanKeys(cursor uint64, count int) ([]zset.Element, uint64) {
+	all := zset.Range{Min: float64(cursor), Max: math.Inf(1)}
+	elements := db.KEYs.RangeByScore(all, 0, count, false)
+	if len(elements) == 0 {
+		return elements, 0
+	}
+
+	last := elements[len(elements)-1]
+	same := zset.Range{Min: last.Score, Max: last.Score}
+	for _, e := range db.KEYs.RangeByScore(same, 0, -1, false) {
+		if e.Member > last.Member {
+			elements = append(elements, e)
+		}
+	}
+
+	after := zset.Range{Min: last.Score, MinExclusive: true, Max: math.Inf(1)}
+	next := db.KEYs.RangeByScore(after, 0, 1, false)
+	if len(next) == 0 {
+		return elements, 0
+	}
+	return elements, uint64(next[0].Score)
+}
+
+// flushGeneric deletes every key of dbs. With ASYNC the old keyspaces are
+// freed on a background goroutine.
+func (s *Server) flushGeneric(dbs []*Database, args []*RESP, cmd string) *RESP {
+	async := false
+	if len(args) > 1 {
+		return ErrResp("ERR wrong number of arguments for '" + cmd + "' command")
+	}
+	if len(args) == 1 {
+		switch strings.ToUpper(args[0].Value) {
+		case "ASYNC":
+			async = true
+		case "SYNC":
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+
+	s.SETsMu.Lock()
+	frees := make([]func(), len(dbs))
+	for i, db := range dbs {
+		s.Dirty.Add(int64(db.KEYs.Len()))
+		frees[i] = db.empty()
+	}
+	s.SETsMu.Unlock()
+
+	free := func() {
+		for _, free := range frees {
+			free()
+		}
+	}
+	if async {
+		go free()
+	} else {
+		free()
+	}
+	return OkResp()
+}
+
+// empty swaps in new keyspaces for db and returns a function freeing the old
+// ones. Caller must hold SETsMu.
+func (db *Database) empty() func() {
+	sets, exps, lists, hsets, sadds, zadds := db.SETs, db.EXPs, db.LISTs, db.HSETs, db.SADDs, db.ZADDs
+	db.SETs = map[string][]byte{}
+	db.EXPs = map[string]int64{}
+	db.LISTs = map[string]*list.List{}
+	db.HSETs = map[string]map[string]string{}
+	db.SADDs = map[string]*Set{}
+	db.ZADDs = map[string]*zset.ZSet{}
+	db.KEYs = zset.NewZSet()
+	db.XADDsMu.Lock()
+	xadds := db.XADDs
+	db.XADDs = map[string]*Stream{}
+	db.XADDsMu.Unlock()
+
+	return func() {
+		clear(sets)
+		clear(exps)
+		for _, l := range lists {
+			freeValue(l)
+		}
+		clear(lists)
+		for _, hash := range hsets {
+			freeValue(hash)
+		}
+		clear(hsets)
+		for _, set := range sadds {
+			freeValue(set)
+		}
+		clear(sadds)
+		clear(zadds)
+		clear(xadds)
+	}
+}
+
+// ----------------------------------------------------------------------------
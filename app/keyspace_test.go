@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDelAndExists(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("SET", "keyspace:string", "v"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("RPUSH", "keyspace:list", "a", "b"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("ZADD", "keyspace:zset", "1", "a"))
+	conn.Buffer.Read()
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"EXISTS", "keyspace:string", "keyspace:list", "keyspace:list", "keyspace:missing"}, "3"},
+		{[]string{"DEL", "keyspace:string", "keyspace:missing"}, "1"},
+		{[]string{"UNLINK", "keyspace:list", "keyspace:zset"}, "2"},
+		{[]string{"EXISTS", "keyspace:string", "keyspace:list", "keyspace:zset"}, "0"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != INTEGER || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
+
+func TestRenameAndCopy(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("HSET", "keyspace:src", "f", "v"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("EXPIRE", "keyspace:src", "100"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SET", "keyspace:taken", "v"))
+	conn.Buffer.Read()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"RENAME", "keyspace:missing", "keyspace:dst"}, ERROR, "ERR no such key"},
+		{[]string{"RENAMENX", "keyspace:src", "keyspace:taken"}, INTEGER, "0"},
+		{[]string{"RENAME", "keyspace:src", "keyspace:dst"}, STRING, "OK"},
+		{[]string{"TTL", "keyspace:dst"}, INTEGER, "100"},
+		{[]string{"EXISTS", "keyspace:src"}, INTEGER, "0"},
+		{[]string{"COPY", "keyspace:dst", "keyspace:taken"}, INTEGER, "0"},
+		{[]string{"COPY", "keyspace:dst", "keyspace:taken", "REPLACE"}, INTEGER, "1"},
+		{[]string{"HSET", "keyspace:taken", "f", "changed"}, INTEGER, "0"},
+		{[]string{"HGET", "keyspace:dst", "f"}, BULK, "v"},
+		{[]string{"TYPE", "keyspace:taken"}, STRING, "hash"},
+		{[]string{"COPY", "keyspace:dst", "keyspace:dst"}, ERROR, "ERR source and destination objects are the same"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
+
+func TestRenameServesBlockedClient(t *testing.T) {
+	createMasterServer("6379")
+	blocked := connectToServer("6379")
+	defer blocked.Conn.Close()
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(blocked.Writer, ToResp("BLPOP", "keyspace:blocked", "0"))
+	time.Sleep(50 * time.Millisecond)
+
+	Write(conn.Writer, ToResp("RPUSH", "keyspace:pushed", "a"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("RENAME", "keyspace:pushed", "keyspace:blocked"))
+	conn.Buffer.Read()
+
+	parsedResp, _, _ := blocked.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 || parsedResp.Values[1].Value != "a" {
+		t.Errorf("Expected [keyspace:blocked a], got %v", parsedResp)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	// Uses its own server so other tests keep their keys
+	createMasterServer("6391")
+	conn := connectToServer("6391")
+	defer conn.Conn.Close()
+
+	for _, flush := range [][]string{{"FLUSHDB"}, {"FLUSHALL", "ASYNC"}} {
+		Write(conn.Writer, ToResp("SET", "keyspace:a", "v"))
+		conn.Buffer.Read()
+		Write(conn.Writer, ToResp("SADD", "keyspace:b", "1", "2"))
+		conn.Buffer.Read()
+
+		Write(conn.Writer, ToResp("DBSIZE"))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != INTEGER || parsedResp.Value != "2" {
+			t.Errorf("Expected 2, got %v", parsedResp)
+		}
+
+		Write(conn.Writer, ToResp("RANDOMKEY"))
+		parsedResp, _, _ = conn.Buffer.Read()
+		if parsedResp.Value != "keyspace:a" && parsedResp.Value != "keyspace:b" {
+			t.Errorf("Expected a random key, got %v", parsedResp)
+		}
+
+		Write(conn.Writer, ToResp(flush...))
+		parsedResp, _, _ = conn.Buffer.Read()
+		if !parsedResp.IsOkay() {
+			t.Errorf("%v: expected OK, got %v", flush, parsedResp)
+		}
+
+		Write(conn.Writer, ToResp("DBSIZE"))
+		parsedResp, _, _ = conn.Buffer.Read()
+		if parsedResp.Type != INTEGER || parsedResp.Value != "0" {
+			t.Errorf("Expected 0, got %v", parsedResp)
+		}
+	}
+
+	Write(conn.Writer, ToResp("RANDOMKEY"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != 0 {
+		t.Errorf("Expected nil, got %v", parsedResp)
+	}
+}
+
+func TestKeysAndScan(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	expected := map[string]bool{}
+	for i := range 50 {
+		key := "scan:" + strconv.Itoa(i)
+		Write(conn.Writer, ToResp("SET", key, "v"))
+		conn.Buffer.Read()
+		expected[key] = true
+	}
+	Write(conn.Writer, ToResp("RPUSH", "scan:list", "a"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("KEYS", "scan:[1-2]?"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 20 {
+		t.Errorf("Expected 20 keys, got %v", parsedResp)
+	}
+
+	// Every key that exists for the whole iteration is returned once, even
+	// though keys are added along the way
+	seen := map[string]int{}
+	cursor := "0"
+	for i := 0; ; i++ {
+		Write(conn.Writer, ToResp("SCAN", cursor, "MATCH", "scan:*", "COUNT", "7", "TYPE", "string"))
+		parsedResp, _, _ = conn.Buffer.Read()
+		if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 {
+			t.Fatalf("Expected cursor and keys, got %v", parsedResp)
+		}
+		for _, key := range parsedResp.Values[1].Values {
+			seen[key.Value]++
+		}
+		cursor = parsedResp.Values[0].Value
+		if cursor == "0" {
+			break
+		}
+		Write(conn.Writer, ToResp("SET", "scan:added:"+strconv.Itoa(i), "v"))
+		conn.Buffer.Read()
+	}
+
+	for key := range expected {
+		if seen[key] != 1 {
+			t.Errorf("Expected %s to be returned once, got %d", key, seen[key])
+		}
+	}
+	if seen["scan:list"] != 0 {
+		t.Errorf("Expected scan:list to be filtered out by TYPE")
+	}
+}
+
+func TestSelectMoveAndSwapdb(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"SELECT", "16"}, ERROR, "ERR DB index is out of range"},
+		{[]string{"SELECT", "one"}, ERROR, "ERR value is not an integer or out of range"},
+		{[]string{"SELECT", "1"}, STRING, "OK"},
+		{[]string{"SET", "db:key", "one"}, STRING, "OK"},
+		{[]string{"EXPIRE", "db:key", "100"}, INTEGER, "1"},
+		{[]string{"MOVE", "db:key", "1"}, ERROR, "ERR source and destination objects are the same"},
+		{[]string{"MOVE", "db:key", "2"}, INTEGER, "1"},
+		{[]string{"MOVE", "db:key", "2"}, INTEGER, "0"},
+		{[]string{"EXISTS", "db:key"}, INTEGER, "0"},
+		{[]string{"COPY", "db:missing", "db:key", "DB", "16"}, ERROR, "ERR DB index is out of range"},
+		{[]string{"SELECT", "2"}, STRING, "OK"},
+		{[]string{"TTL", "db:key"}, INTEGER, "100"},
+		{[]string{"COPY", "db:key", "db:key", "DB", "3"}, INTEGER, "1"},
+		{[]string{"SWAPDB", "2", "one"}, ERROR, "ERR invalid second DB index"},
+		{[]string{"SWAPDB", "1", "2"}, STRING, "OK"},
+		{[]string{"EXISTS", "db:key"}, INTEGER, "0"},
+		{[]string{"SELECT", "1"}, STRING, "OK"},
+		{[]string{"GET", "db:key"}, BULK, "one"},
+		{[]string{"SELECT", "3"}, STRING, "OK"},
+		{[]string{"GET", "db:key"}, BULK, "one"},
+		{[]string{"FLUSHDB"}, STRING, "OK"},
+		{[]string{"SELECT", "1"}, STRING, "OK"},
+		{[]string{"DBSIZE"}, INTEGER, "1"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+
+	Write(conn.Writer, ToResp("CONFIG", "GET", "databases"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 || parsedResp.Values[1].Value != "16" {
+		t.Errorf("Expected [databases 16], got %v", parsedResp)
+	}
+
+	// Other connections start on database 0
+	other := connectToServer("6379")
+	defer other.Conn.Close()
+	Write(other.Writer, ToResp("EXISTS", "db:key"))
+	parsedResp, _, _ = other.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "0" {
+		t.Errorf("Expected 0, got %v", parsedResp)
+	}
+}
+
+func TestSwapdbServesBlockedClient(t *testing.T) {
+	createMasterServer("6379")
+	blocked := connectToServer("6379")
+	defer blocked.Conn.Close()
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(blocked.Writer, ToResp("SELECT", "4"))
+	blocked.Buffer.Read()
+	Write(blocked.Writer, ToResp("BLPOP", "db:blocked", "0"))
+	time.Sleep(50 * time.Millisecond)
+
+	Write(conn.Writer, ToResp("SELECT", "5"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("RPUSH", "db:blocked", "a"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SWAPDB", "4", "5"))
+	conn.Buffer.Read()
+
+	parsedResp, _, _ := blocked.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 || parsedResp.Values[1].Value != "a" {
+		t.Errorf("Expected [db:blocked a], got %v", parsedResp)
+	}
+}
+
+func TestRDBDatabases(t *testing.T) {
+	var rdb bytes.Buffer
+	rdb.WriteString("REDIS0011")
+	rdb.Write([]byte{0xFA, 0x03, 'v', 'e', 'r', 0x03, '7', '.', '2'})
+	rdb.Write([]byte{0xFE, 0x00, 0xFB, 0x01, 0x00})
+	rdb.Write([]byte{RDB_STRING, 0x01, 'a', 0x01, '0'})
+	rdb.Write([]byte{0xFE, 0x03, 0xFB, 0x02, 0x01})
+	rdb.Write([]byte{RDB_STRING, 0x01, 'b', 0x01, '3'})
+	// Expiry in seconds, 2100-01-01
+	rdb.Write([]byte{0xFD, 0x00, 0x57, 0x86, 0xF4, RDB_STRING, 0x01, 'c', 0x01, '3'})
+	rdb.Write([]byte{0xFF, 0, 0, 0, 0, 0, 0, 0, 0})
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dump.rdb"), rdb.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write rdb: %v", err)
+	}
+
+	server, err := NewServer(&Config{Port: "6392", Dir: dir, Dbfilename: "dump.rdb"})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Listener.Close()
+
+	if len(server.DBs) != defaultDatabases {
+		t.Errorf("Expected %d databases, got %d", defaultDatabases, len(server.DBs))
+	}
+	if string(server.DBs[0].SETs["a"]) != "0" || len(server.DBs[0].SETs) != 1 {
+		t.Errorf("Expected only a in database 0, got %v", server.DBs[0].SETs)
+	}
+	if string(server.DBs[3].SETs["b"]) != "3" || string(server.DBs[3].SETs["c"]) != "3" {
+		t.Errorf("Expected b and c in database 3, got %v", server.DBs[3].SETs)
+	}
+	if server.DBs[3].EXPs["c"] != 4102444800000 {
+		t.Errorf("Expected c to expire at 4102444800000, got %d", server.DBs[3].EXPs["c"])
+	}
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+)
+
+// List commands --------------------------------------------------------------
+func (s *Server) lpush(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'lpush' command")
+	}
+	return s.push(db, args, true)
+}
+
+func (s *Server) rpush(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'rpush' command")
+	}
+	return s.push(db, args, false)
+}
+
+func (s *Server) push(db *Database, args []*RESP, left bool) *RESP {
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		l = list.New()
+		db.setValue(key, l)
+	}
+
+	for _, arg := range args[1:] {
+		if left {
+			l.PushFront(arg.Value)
+		} else {
+			l.PushBack(arg.Value)
+		}
+	}
+	s.Dirty.Add(int64(len(args) - 1))
+
+	// Reply with the length before any blocked client pops from the list
+	resp := Integer(l.Len())
+	s.signalKeyReady(db, key)
+	return resp
+}
+
+func (s *Server) lpop(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 || len(args) > 2 {
+		return ErrResp("ERR wrong number of arguments for 'lpop' command")
+	}
+	return s.pop(db, args, true)
+}
+
+func (s *Server) rpop(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 || len(args) > 2 {
+		return ErrResp("ERR wrong number of arguments for 'rpop' command")
+	}
+	return s.pop(db, args, false)
+}
+
+func (s *Server) pop(db *Database, args []*RESP, left bool) *RESP {
+	// A count of -1 means no count was given and a single element is returned
+	count := -1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1].Value)
+		if err != nil || n < 0 {
+			return ErrResp("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		// Redis replies with a nil array when a count is given
+		if count != -1 {
+			return NullArrayResp()
+		}
+		return NullResp()
+	}
+
+	if count == -1 {
+		s.Dirty.Add(1)
+		return BulkString(db.popElement(key, l, left))
+	}
+
+	values := []string{}
+	for ; count > 0 && l.Len() > 0; count-- {
+		values = append(values, db.popElement(key, l, left))
+	}
+	s.Dirty.Add(int64(len(values)))
+	return ToResp(values...)
+}
+
+func (s *Server) lmove(db *Database, args []*RESP) *RESP {
+	if len(args) != 4 {
+		return ErrResp("ERR wrong number of arguments for 'lmove' command")
+	}
+
+	fromLeft, errResp := parseDirection(args[2].Value)
+	if errResp != nil {
+		return errResp
+	}
+	toLeft, errResp := parseDirection(args[3].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	src, dst := args[0].Value, args[1].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(src)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return NullResp()
+	}
+	return s.move(db, src, dst, l, fromLeft, toLeft)
+}
+
+func (s *Server) blpop(db *Database, args []*RESP, conn *ConnRW) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'blpop' command")
+	}
+	return s.bpop(db, args, true, conn)
+}
+
+func (s *Server) brpop(db *Database, args []*RESP, conn *ConnRW) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'brpop' command")
+	}
+	return s.bpop(db, args, false, conn)
+}
+
+func (s *Server) bpop(db *Database, args []*RESP, left bool, conn *ConnRW) *RESP {
+	timeout, errResp := parseTimeout(args[len(args)-1].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	keys := make([]string, len(args)-1)
+	for i := range keys {
+		keys[i] = args[i].Value
+	}
+
+	// Pops the element for a client and propagates the equivalent non-blocking
+	// command, since replicas must never block
+	popCmd := "RPOP"
+	if left {
+		popCmd = "LPOP"
+	}
+	popFrom := func(key string, l *list.List) *RESP {
+		s.propagateCommand(db, ToResp(popCmd, key))
+		s.Dirty.Add(1)
+		return ToResp(key, db.popElement(key, l, left))
+	}
+
+	s.SETsMu.Lock()
+	for _, key := range keys {
+		l, errResp := db.getList(key)
+		if errResp != nil {
+			s.SETsMu.Unlock()
+			return errResp
+		}
+		if l != nil {
+			resp := popFrom(key, l)
+			s.SETsMu.Unlock()
+			return resp
+		}
+	}
+	if conn.RedirectRead {
+		s.SETsMu.Unlock()
+		return NullArrayResp()
+	}
+
+	client := &BlockedClient{DB: db, Keys: keys, Ch: make(chan *RESP, 1)}
+	client.Serve = func(key string) *RESP {
+		l, ok := db.LISTs[key]
+		if !ok {
+			return nil
+		}
+		return popFrom(key, l)
+	}
+	s.blockOn(client)
+	s.SETsMu.Unlock()
+
+	resp := s.waitForKeys(client, timeout, conn)
+	if resp == nil {
+		return NullArrayResp()
+	}
+	return resp
+}
+
+func (s *Server) blmove(db *Database, args []*RESP, conn *ConnRW) *RESP {
+	if len(args) != 5 {
+		return ErrResp("ERR wrong number of arguments for 'blmove' command")
+	}
+
+	fromLeft, errResp := parseDirection(args[2].Value)
+	if errResp != nil {
+		return errResp
+	}
+	toLeft, errResp := parseDirection(args[3].Value)
+	if errResp != nil {
+		return errResp
+	}
+	timeout, errResp := parseTimeout(args[4].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	src, dst := args[0].Value, args[1].Value
+	moveCmd := ToResp("LMOVE", src, dst, args[2].Value, args[3].Value)
+
+	s.SETsMu.Lock()
+	l, errResp := db.getList(src)
+	if errResp != nil {
+		s.SETsMu.Unlock()
+		return errResp
+	}
+	if l != nil {
+		s.propagateCommand(db, moveCmd)
+		resp := s.move(db, src, dst, l, fromLeft, toLeft)
+		s.SETsMu.Unlock()
+		return resp
+	}
+	if conn.RedirectRead {
+		s.SETsMu.Unlock()
+		return NullResp()
+	}
+
+	client := &BlockedClient{DB: db, Keys: []string{src}, Ch: make(chan *RESP, 1)}
+	client.Serve = func(key string) *RESP {
+		l, ok := db.LISTs[key]
+		if !ok {
+			return nil
+		}
+		s.propagateCommand(db, moveCmd)
+		return s.move(db, src, dst, l, fromLeft, toLeft)
+	}
+	s.blockOn(client)
+	s.SETsMu.Unlock()
+
+	// Like the other blocking pops, and unlike a non-blocking call, a timeout
+	// replies with a nil array
+	resp := s.waitForKeys(client, timeout, conn)
+	if resp == nil {
+		return NullArrayResp()
+	}
+	return resp
+}
+
+func (s *Server) lrange(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'lrange' command")
+	}
+
+	start, errResp := parseInt(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+	stop, errResp := parseInt(args[2].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return ToResp()
+	}
+
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		return ToResp()
+	}
+
+	values := make([]string, 0, stop-start+1)
+	for e := listElementAt(l, start); e != nil && len(values) < cap(values); e = e.Next() {
+		values = append(values, e.Value.(string))
+	}
+	return ToResp(values...)
+}
+
+func (s *Server) llen(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'llen' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return Integer(0)
+	}
+	return Integer(l.Len())
+}
+
+func (s *Server) lindex(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'lindex' command")
+	}
+
+	index, errResp := parseInt(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return NullResp()
+	}
+
+	if index < 0 {
+		index += l.Len()
+	}
+	if index < 0 || index >= l.Len() {
+		return NullResp()
+	}
+	return BulkString(listElementAt(l, index).Value.(string))
+}
+
+func (s *Server) lset(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'lset' command")
+	}
+
+	index, errResp := parseInt(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return ErrResp("ERR no such key")
+	}
+
+	if index < 0 {
+		index += l.Len()
+	}
+	if index < 0 || index >= l.Len() {
+		return ErrResp("ERR index out of range")
+	}
+	listElementAt(l, index).Value = args[2].Value
+	s.Dirty.Add(1)
+	return OkResp()
+}
+
+func (s *Server) lrem(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'lrem' command")
+	}
+
+	count, errResp := parseInt(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	key, element := args[0].Value, args[2].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return Integer(0)
+	}
+
+	// count > 0 removes from head to tail, count < 0 from tail to head and
+	// count == 0 removes every matching element
+	removed := 0
+	if count >= 0 {
+		for e := l.Front(); e != nil && (count == 0 || removed < count); {
+			next := e.Next()
+			if e.Value.(string) == element {
+				l.Remove(e)
+				removed++
+			}
+			e = next
+		}
+	} else {
+		for e := l.Back(); e != nil && removed < -count; {
+			prev := e.Prev()
+			if e.Value.(string) == element {
+				l.Remove(e)
+				removed++
+			}
+			e = prev
+		}
+	}
+
+	if l.Len() == 0 {
+		db.deleteKey(key)
+	}
+	s.Dirty.Add(int64(removed))
+	return Integer(removed)
+}
+
+func (s *Server) ltrim(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'ltrim' command")
+	}
+
+	start, errResp := parseInt(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+	stop, errResp := parseInt(args[2].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	l, errResp := db.getList(key)
+	if errResp != nil {
+		return errResp
+	}
+	if l == nil {
+		return OkResp()
+	}
+
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		s.Dirty.Add(int64(l.Len()))
+		db.deleteKey(key)
+		return OkResp()
+	}
+
+	s.Dirty.Add(int64(l.Len() - (stop - start + 1)))
+	for i := 0; i < start; i++ {
+		l.Remove(l.Front())
+	}
+	for l.Len() > stop-start+1 {
+		l.Remove(l.Back())
+	}
+	return OkResp()
+}
+
+// ----------------------------------------------------------------------------
+
+// List helpers ---------------------------------------------------------------
+// getList returns the list stored at key, nil if the key does not exist, or a
+// WRONGTYPE error if the key holds another type. Caller must hold SETsMu.
+func (db *Database) getList(key string) (*list.List, *RESP) {
+	db.expireIfNeeded(key)
+	l, ok := db.LISTs[key]
+	if !ok && db.typeOf(key) != "none" {
+		return nil, WrongTypeResp()
+	}
+	return l, nil
+}
+
+// move pops an element from the list at src and pushes it onto dst, serving
+// any client blocked on dst. Caller must hold SETsMu.
+func (s *Server) move(db *Database, src, dst string, l *list.List, fromLeft, toLeft bool) *RESP {
+	if _, errResp := db.getList(dst); errResp != nil {
+		return errResp
+	}
+
+	value := db.popElement(src, l, fromLeft)
+
+	// Looked up after popping as src and dst may be the same list
+	dl, ok := db.LISTs[dst]
+	if !ok {
+		dl = list.New()
+		db.setValue(dst, dl)
+	}
+	if toLeft {
+		dl.PushFront(value)
+	} else {
+		dl.PushBack(value)
+	}
+
+	s.Dirty.Add(1)
+	s.signalKeyReady(db, dst)
+	return BulkString(value)
+}
+
+// parseDirection parses the LEFT / RIGHT argument of LMOVE and BLMOVE
+func parseDirection(value string) (bool, *RESP) {
+	switch strings.ToUpper(value) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	default:
+		return false, ErrResp("ERR syntax error")
+	}
+}
+
+// popElement removes an element from the head or tail of the list at key and
+// deletes the key once the list is empty. Caller must hold SETsMu.
+func (db *Database) popElement(key string, l *list.List, left bool) string {
+	e := l.Back()
+	if left {
+		e = l.Front()
+	}
+	l.Remove(e)
+	if l.Len() == 0 {
+		db.deleteKey(key)
+	}
+	return e.Value.(string)
+}
+
+// listElementAt walks to index from whichever end of the list is closer.
+// index must be within [0, l.Len()).
+func listElementAt(l *list.List, index int) *list.Element {
+	if index < l.Len()/2 {
+		e := l.Front()
+		for ; index > 0; index-- {
+			e = e.Next()
+		}
+		return e
+	}
+	e := l.Back()
+	for i := l.Len() - 1; i > index; i-- {
+		e = e.Prev()
+	}
+	return e
+}
+
+// normalizeRange converts Redis style inclusive start / stop indexes, which
+// may be negative, into offsets within a sequence of length n. The returned
+// bool is false when the range is empty.
+func normalizeRange(start, stop, n int) (int, int, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// ----------------------------------------------------------------------------
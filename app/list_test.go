@@ -0,0 +1,316 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushAndRange(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "list:range", "b", "c"))
+	parsedResp, _, err := conn.Buffer.Read()
+	if err != nil {
+		t.Errorf("Failed to read response: %v", err)
+	}
+	if parsedResp.Type != INTEGER || parsedResp.Value != "2" {
+		t.Errorf("Expected 2, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("LPUSH", "list:range", "a"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "3" {
+		t.Errorf("Expected 3, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("LRANGE", "list:range", "0", "-1"))
+	parsedResp, _, err = conn.Buffer.Read()
+	if err != nil {
+		t.Errorf("Failed to read response: %v", err)
+	}
+	expected := []string{"a", "b", "c"}
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, parsedResp)
+	}
+	for i, v := range expected {
+		if parsedResp.Values[i].Value != v {
+			t.Errorf("Expected %s at index %d, got %v", v, i, parsedResp.Values[i])
+		}
+	}
+
+	Write(conn.Writer, ToResp("LINDEX", "list:range", "-1"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != BULK || parsedResp.Value != "c" {
+		t.Errorf("Expected c, got %v", parsedResp)
+	}
+}
+
+func TestPop(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "list:pop", "a", "b", "c", "d"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("LPOP", "list:pop"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != BULK || parsedResp.Value != "a" {
+		t.Errorf("Expected a, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("RPOP", "list:pop", "2"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 ||
+		parsedResp.Values[0].Value != "d" || parsedResp.Values[1].Value != "c" {
+		t.Errorf("Expected [d c], got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("LPOP", "list:pop"))
+	conn.Buffer.Read()
+
+	// The key is removed once the list is empty
+	Write(conn.Writer, ToResp("TYPE", "list:pop"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Value != "none" {
+		t.Errorf("Expected none, got %v", parsedResp)
+	}
+}
+
+func TestPopMissingKey(t *testing.T) {
+	server := &Server{DBs: []*Database{NewDatabase(0)}}
+	conn := &ConnRW{RedirectRead: true}
+
+	// Popping with a count replies with a nil array instead of a nil string,
+	// as do the blocking pops that reply with a key and an element
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"LPOP", "list:missing"}, "$-1\r\n"},
+		{[]string{"RPOP", "list:missing"}, "$-1\r\n"},
+		{[]string{"LPOP", "list:missing", "2"}, "*-1\r\n"},
+		{[]string{"RPOP", "list:missing", "0"}, "*-1\r\n"},
+		{[]string{"BLPOP", "list:missing", "0"}, "*-1\r\n"},
+		{[]string{"BRPOP", "list:missing", "0"}, "*-1\r\n"},
+		{[]string{"BLMOVE", "list:missing", "list:dst", "LEFT", "RIGHT", "0"}, "$-1\r\n"},
+	}
+	for _, test := range tests {
+		resps := server.Handler(ToResp(test.args...), conn)
+		if got := string(resps[0].Marshal()); got != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.args, test.expected, got)
+		}
+	}
+}
+
+func TestRemAndTrim(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "list:rem", "x", "a", "x", "b", "x", "c"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("LREM", "list:rem", "-2", "x"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "2" {
+		t.Errorf("Expected 2, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("LTRIM", "list:rem", "1", "-1"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if !parsedResp.IsOkay() {
+		t.Errorf("Expected OK, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("LSET", "list:rem", "0", "z"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("LRANGE", "list:rem", "0", "-1"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	expected := []string{"z", "b", "c"}
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, parsedResp)
+	}
+	for i, v := range expected {
+		if parsedResp.Values[i].Value != v {
+			t.Errorf("Expected %s at index %d, got %v", v, i, parsedResp.Values[i])
+		}
+	}
+
+	Write(conn.Writer, ToResp("LLEN", "list:rem"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "3" {
+		t.Errorf("Expected 3, got %v", parsedResp)
+	}
+}
+
+func TestListWrongType(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "list:type", "a"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("TYPE", "list:type"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Value != "list" {
+		t.Errorf("Expected list, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("GET", "list:type"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ERROR || !strings.HasPrefix(parsedResp.Value, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE error, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("SET", "string:type", "a"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("LPUSH", "string:type", "a"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ERROR || !strings.HasPrefix(parsedResp.Value, "WRONGTYPE") {
+		t.Errorf("Expected WRONGTYPE error, got %v", parsedResp)
+	}
+
+	// SET replaces the list rather than creating a second key
+	Write(conn.Writer, ToResp("SET", "list:type", "b"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("TYPE", "list:type"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Value != "string" {
+		t.Errorf("Expected string, got %v", parsedResp)
+	}
+}
+
+func TestBlpopServesInOrder(t *testing.T) {
+	createMasterServer("6379")
+	first := connectToServer("6379")
+	defer first.Conn.Close()
+	second := connectToServer("6379")
+	defer second.Conn.Close()
+	pusher := connectToServer("6379")
+	defer pusher.Conn.Close()
+
+	Write(first.Writer, ToResp("BLPOP", "list:block", "list:other", "0"))
+	time.Sleep(50 * time.Millisecond)
+	Write(second.Writer, ToResp("BLPOP", "list:block", "0"))
+	time.Sleep(50 * time.Millisecond)
+
+	Write(pusher.Writer, ToResp("RPUSH", "list:block", "a", "b"))
+	parsedResp, _, _ := pusher.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "2" {
+		t.Errorf("Expected 2, got %v", parsedResp)
+	}
+
+	for _, c := range []struct {
+		conn     *ReadWriter
+		expected string
+	}{{first, "a"}, {second, "b"}} {
+		parsedResp, _, err := c.conn.Buffer.Read()
+		if err != nil {
+			t.Errorf("Failed to read response: %v", err)
+		}
+		if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 ||
+			parsedResp.Values[0].Value != "list:block" || parsedResp.Values[1].Value != c.expected {
+			t.Errorf("Expected [list:block %s], got %v", c.expected, parsedResp)
+		}
+	}
+}
+
+func TestBlpopTimeout(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	start := time.Now()
+	Write(conn.Writer, ToResp("BLPOP", "list:timeout", "0.1"))
+	parsedResp, _, err := conn.Buffer.Read()
+	if err != nil {
+		t.Errorf("Failed to read response: %v", err)
+	}
+	if parsedResp.Type != NULL_ARRAY {
+		t.Errorf("Expected nil array, got %v", parsedResp)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Errorf("Expected BLPOP to block for the timeout")
+	}
+
+	// Commands pipelined after a blocking command are answered in order
+	Write(conn.Writer, ToResp("BRPOP", "list:timeout", "0.05"))
+	Write(conn.Writer, PingResp())
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != NULL_ARRAY {
+		t.Errorf("Expected nil array, got %v", parsedResp)
+	}
+	parsedResp, _, _ = conn.Buffer.Read()
+	if !parsedResp.IsPong() {
+		t.Errorf("Expected PONG, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("BLMOVE", "list:timeout", "list:dst", "LEFT", "RIGHT", "0.05"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != NULL_ARRAY {
+		t.Errorf("Expected nil array, got %v", parsedResp)
+	}
+}
+
+func TestBlmove(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+	pusher := connectToServer("6379")
+	defer pusher.Conn.Close()
+
+	Write(conn.Writer, ToResp("BLMOVE", "list:src", "list:dst", "LEFT", "RIGHT", "0"))
+	time.Sleep(50 * time.Millisecond)
+
+	Write(pusher.Writer, ToResp("RPUSH", "list:src", "a"))
+	pusher.Buffer.Read()
+
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != BULK || parsedResp.Value != "a" {
+		t.Errorf("Expected a, got %v", parsedResp)
+	}
+
+	Write(pusher.Writer, ToResp("LRANGE", "list:dst", "0", "-1"))
+	parsedResp, _, _ = pusher.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 1 || parsedResp.Values[0].Value != "a" {
+		t.Errorf("Expected [a], got %v", parsedResp)
+	}
+
+	Write(pusher.Writer, ToResp("LLEN", "list:src"))
+	parsedResp, _, _ = pusher.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "0" {
+		t.Errorf("Expected 0, got %v", parsedResp)
+	}
+}
+
+func TestBlpopDisconnectWithPipeline(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	pusher := connectToServer("6379")
+	defer pusher.Conn.Close()
+
+	// A client that disconnects with commands pipelined behind BLPOP is
+	// unblocked, so a later push is not popped for it
+	pipeline := append(ToResp("BLPOP", "list:gone", "0").Marshal(), PingResp().Marshal()...)
+	conn.Conn.Write(pipeline)
+	time.Sleep(50 * time.Millisecond)
+	conn.Conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	Write(pusher.Writer, ToResp("LPUSH", "list:gone", "x"))
+	pusher.Buffer.Read()
+
+	Write(pusher.Writer, ToResp("LLEN", "list:gone"))
+	parsedResp, _, _ := pusher.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "1" {
+		t.Errorf("Expected 1, got %v", parsedResp)
+	}
+}
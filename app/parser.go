@@ -25,7 +25,7 @@ func (buf *Buffer) Read() (*RESP, int, error) {
 	case STRING:
 		resp, n, err = buf.readString()
 	case ERROR:
-		return nil, 0, nil
+		resp, n, err = buf.readError()
 	case INTEGER:
 		resp, n, err = buf.readInteger()
 	default:
@@ -46,7 +46,7 @@ func (buf *Buffer) readArray() (*RESP, int, error) {
 		return nil, n, err
 	}
 	if length == -1 {
-		return nil, n, nil
+		return NullArrayResp(), n, nil
 	}
 
 	values := make([]*RESP, length)
@@ -108,6 +108,21 @@ func (buf *Buffer) readString() (*RESP, int, error) {
 	}, n, nil
 }
 
+func (buf *Buffer) readError() (*RESP, int, error) {
+	data, err := buf.reader.ReadString('\n')
+	if err != nil {
+		return &RESP{}, 0, err
+	}
+
+	n := len(data)
+
+	data = strings.TrimSuffix(data, "\r\n")
+	return &RESP{
+		Type:  ERROR,
+		Value: data,
+	}, n, nil
+}
+
 func (buf *Buffer) readInteger() (*RESP, int, error) {
 	num, err := buf.reader.ReadString('\n')
 	if err != nil {
@@ -219,6 +234,8 @@ func (resp *RESP) Marshal() []byte {
 		return resp.marshalError()
 	case INTEGER:
 		return resp.marshalInteger()
+	case NULL_ARRAY:
+		return resp.marshalNullArray()
 	default:
 		return resp.marshalNull()
 	}
@@ -253,19 +270,13 @@ func (resp *RESP) marshalArray() (bytes []byte) {
 	return bytes
 }
 
+// marshallRDB returns an RDB as sent on full resyncs, like a bulk string
+// without the trailing CRLF
 func (resp *RESP) marshallRDB() (bytes []byte) {
 	bytes = append(bytes, BULK)
-
-	content := []byte{}
-	for i := 0; i < len(resp.Value); i += 2 {
-		tmp := resp.Value[i : i+2]
-		hex, _ := strconv.ParseUint(tmp, 16, 8)
-		content = append(content, byte(hex))
-	}
-
-	bytes = strconv.AppendInt(bytes, int64(len(content)), 10)
+	bytes = strconv.AppendInt(bytes, int64(len(resp.Value)), 10)
 	bytes = append(bytes, CRLF...)
-	bytes = append(bytes, content...)
+	bytes = append(bytes, resp.Value...)
 
 	return bytes
 }
@@ -290,4 +301,8 @@ func (resp *RESP) marshalNull() []byte {
 	return []byte("$-1\r\n")
 }
 
+func (resp *RESP) marshalNullArray() []byte {
+	return []byte("*-1\r\n")
+}
+
 // ----------------------------------------------------------------------------
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	listpack "github.com/elordeiro/redis-server/listpack"
+	zset "github.com/elordeiro/redis-server/zset"
+)
+
+// RDB commands ---------------------------------------------------------------
+func (s *Server) save(args []*RESP) *RESP {
+	if len(args) != 0 {
+		return ErrResp("ERR wrong number of arguments for 'save' command")
+	}
+
+	// Like Redis, every client waits until the snapshot is written
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+	if s.Saving {
+		return ErrResp("ERR Background save already in progress")
+	}
+	dirty := s.Dirty.Load()
+	s.LastSaveTry = time.Now()
+	if err := s.writeRDBFile(s.snapshot(false)); err != nil {
+		fmt.Println("Failed to save RDB:", err)
+		s.LastSaveOK = false
+		return ErrResp("ERR")
+	}
+	s.saved(dirty)
+	return OkResp()
+}
+
+func (s *Server) bgsave(args []*RESP) *RESP {
+	if len(args) != 0 {
+		return ErrResp("ERR syntax error")
+	}
+	if !s.startBgsave() {
+		return ErrResp("ERR Background save already in progress")
+	}
+	return &RESP{Type: STRING, Value: "Background saving started"}
+}
+
+func (s *Server) lastsave(args []*RESP) *RESP {
+	if len(args) != 0 {
+		return ErrResp("ERR wrong number of arguments for 'lastsave' command")
+	}
+	s.SETsMu.RLock()
+	defer s.SETsMu.RUnlock()
+	return Integer(s.LastSave.Unix())
+}
+
+// ----------------------------------------------------------------------------
+
+// RDB helpers ----------------------------------------------------------------
+const (
+	// Version of the RDB format written, the one of Redis 7.2
+	rdbVersion      = 11
+	rdbRedisVersion = "7.2.0"
+	// File written when no dbfilename is configured
+	defaultDbfilename = "dump.rdb"
+	// Time to wait after a failed background save before trying again
+	saveRetryDelay = 5 * time.Second
+	// Elements and bytes of each listpack of a list, like a quicklist node
+	rdbListNodeMaxEntries = 128
+	rdbListNodeMaxBytes   = 8192
+)
+
+// CRC-64 with the Jones polynomial, which Redis appends to RDB files
+var rdbCRCTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// Key of a snapshot with its value and expiry time, 0 if it has none
+type rdbKey struct {
+	key    string
+	value  any
+	expiry int64
+}
+
+// rdbEncoder writes an RDB, keeping the checksum of everything written and
+// the first error
+type rdbEncoder struct {
+	w   io.Writer
+	crc uint64
+	err error
+}
+
+// parseSaveParams parses save points given as "<seconds> <changes> ...". An
+// empty string disables snapshots.
+func parseSaveParams(value string) ([]SaveParam, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("invalid save parameters")
+	}
+	params := []SaveParam{}
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err1 := strconv.Atoi(fields[i])
+		changes, err2 := strconv.Atoi(fields[i+1])
+		if err1 != nil || err2 != nil || seconds < 1 || changes < 0 {
+			return nil, errors.New("invalid save parameters")
+		}
+		params = append(params, SaveParam{seconds, changes})
+	}
+	return params, nil
+}
+
+// saveParamsString returns save points as given to parseSaveParams
+func saveParamsString(params []SaveParam) string {
+	fields := make([]string, 0, 2*len(params))
+	for _, param := range params {
+		fields = append(fields, strconv.Itoa(param.Seconds), strconv.Itoa(param.Changes))
+	}
+	return strings.Join(fields, " ")
+}
+
+// saveLoop starts a background save whenever a save point is reached,
+// checking hz times per second
+func (s *Server) saveLoop() {
+	for {
+		s.SETsMu.RLock()
+		hz := s.Hz
+		s.SETsMu.RUnlock()
+
+		time.Sleep(time.Second / time.Duration(hz))
+		if s.savePointReached() {
+			s.startBgsave()
+		}
+	}
+}
+
+// savePointReached reports whether enough writes were made since the last
+// save for one of the save points. Failed saves are only retried after
+// saveRetryDelay.
+func (s *Server) savePointReached() bool {
+	s.SETsMu.RLock()
+	defer s.SETsMu.RUnlock()
+	if s.Saving || !s.LastSaveOK && time.Since(s.LastSaveTry) < saveRetryDelay {
+		return false
+	}
+	dirty := s.Dirty.Load()
+	for _, param := range s.SaveParams {
+		if dirty > 0 && dirty >= int64(param.Changes) && time.Since(s.LastSave) >= time.Duration(param.Seconds)*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+// startBgsave copies the databases and writes them on another goroutine,
+// unless a background save is already in progress. Reports whether it
+// started.
+func (s *Server) startBgsave() bool {
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+	if s.Saving {
+		return false
+	}
+	s.Saving = true
+	s.LastSaveTry = time.Now()
+	dirty := s.Dirty.Load()
+	dbs := s.snapshot(true)
+
+	go func() {
+		err := s.writeRDBFile(dbs)
+		s.SETsMu.Lock()
+		defer s.SETsMu.Unlock()
+		s.Saving = false
+		if err != nil {
+			fmt.Println("Failed to save RDB:", err)
+			s.LastSaveOK = false
+			return
+		}
+		s.saved(dirty)
+	}()
+	return true
+}
+
+// saved records a successful save of the databases as they were after dirty
+// writes. Caller must hold SETsMu.
+func (s *Server) saved(dirty int64) {
+	s.Dirty.Add(-dirty)
+	s.LastSave = time.Now()
+	s.LastSaveOK = true
+}
+
+// snapshot returns the keys of every database that haven't expired. Values
+// are copied if copied is set, otherwise they are shared and the caller must
+// hold SETsMu until they are written. Caller must hold SETsMu.
+func (s *Server) snapshot(copied bool) [][]rdbKey {
+	now := time.Now().UnixMilli()
+	dbs := make([][]rdbKey, len(s.DBs))
+	for i, db := range s.DBs {
+		for _, key := range db.allKeys() {
+			expiry, ok := db.EXPs[key]
+			if ok && expiry <= now {
+				continue
+			}
+			value := db.getValue(key)
+			if copied {
+				value = copyValue(value)
+			}
+			dbs[i] = append(dbs[i], rdbKey{key, value, expiry})
+		}
+	}
+	return dbs
+}
+
+// writeRDBFile writes a snapshot to a temporary file and renames it over the
+// RDB file, so the RDB file is always complete
+func (s *Server) writeRDBFile(dbs [][]rdbKey) error {
+	dir, name := s.Dir, s.Dbfilename
+	if dir == "" {
+		dir = "."
+	}
+	if name == "" {
+		name = defaultDbfilename
+	}
+
+	file, err := os.CreateTemp(dir, "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	w := bufio.NewWriter(file)
+	err = encodeRDB(w, dbs)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(dir, name))
+}
+
+// encodeRDB writes a snapshot of the databases to w in the RDB format
+func encodeRDB(w io.Writer, dbs [][]rdbKey) error {
+	e := &rdbEncoder{w: w}
+	e.write([]byte(fmt.Sprintf("REDIS%04d", rdbVersion)))
+	aux := [][2]string{
+		{"redis-ver", rdbRedisVersion},
+		{"redis-bits", "64"},
+		{"ctime", strconv.FormatInt(time.Now().Unix(), 10)},
+		{"aof-base", "0"},
+	}
+	for _, field := range aux {
+		e.writeByte(RDB_OPCODE_AUX)
+		e.writeString(field[0])
+		e.writeString(field[1])
+	}
+
+	for id, keys := range dbs {
+		if len(keys) == 0 {
+			continue
+		}
+		expires := 0
+		for _, key := range keys {
+			if key.expiry > 0 {
+				expires++
+			}
+		}
+		e.writeByte(RDB_OPCODE_SELECTDB)
+		e.writeLen(uint64(id))
+		e.writeByte(RDB_OPCODE_RESIZEDB)
+		e.writeLen(uint64(len(keys)))
+		e.writeLen(uint64(expires))
+
+		for _, key := range keys {
+			if key.expiry > 0 {
+				e.writeByte(RDB_OPCODE_EXPIRE_MS)
+				e.writeMillis(key.expiry)
+			}
+			e.writeValue(key.key, key.value)
+		}
+	}
+
+	e.writeByte(RDB_OPCODE_EOF)
+	var checksum [8]byte
+	binary.LittleEndian.PutUint64(checksum[:], e.crc)
+	e.write(checksum[:])
+	return e.err
+}
+
+// writeValue writes the type of value, key and value
+func (e *rdbEncoder) writeValue(key string, value any) {
+	switch value := value.(type) {
+	case []byte:
+		e.writeByte(RDB_STRING)
+		e.writeString(key)
+		e.writeString(string(value))
+	case *list.List:
+		e.writeByte(RDB_LIST_QUICKLIST_2)
+		e.writeString(key)
+		nodes := listNodes(value)
+		e.writeLen(uint64(len(nodes)))
+		for _, node := range nodes {
+			e.writeLen(RDB_QUICKLIST_NODE_PACKED)
+			e.writeString(string(node))
+		}
+	case map[string]string:
+		e.writeByte(RDB_HASH)
+		e.writeString(key)
+		e.writeLen(uint64(len(value)))
+		for field, v := range value {
+			e.writeString(field)
+			e.writeString(v)
+		}
+	case *Set:
+		e.writeByte(RDB_SET)
+		e.writeString(key)
+		e.writeLen(uint64(value.Len()))
+		for _, member := range value.Members() {
+			e.writeString(member)
+		}
+	case *zset.ZSet:
+		e.writeByte(RDB_ZSET_2)
+		e.writeString(key)
+		e.writeLen(uint64(value.Len()))
+		if value.Len() == 0 {
+			return
+		}
+		for _, element := range value.RangeByRank(0, value.Len()-1, false) {
+			e.writeString(element.Member)
+			e.writeDouble(element.Score)
+		}
+	case *Stream:
+		e.writeByte(RDB_STREAM_LISTPACKS_3)
+		e.writeString(key)
+		e.writeStream(value)
+	}
+}
+
+// writeStream writes the nodes of a stream as they are, followed by its
+// metadata and consumer groups
+func (e *rdbEncoder) writeStream(stream *Stream) {
+	e.writeLen(uint64(stream.Nodes.Keys()))
+	for it := stream.Nodes.Iter(); it.Next(); {
+		e.writeString(it.Key())
+		e.writeString(string(it.Value().([]byte)))
+	}
+
+	first := stream.firstID()
+	e.writeLen(uint64(stream.Length))
+	e.writeLen(stream.LastID.Time)
+	e.writeLen(stream.LastID.Seq)
+	e.writeLen(first.Time)
+	e.writeLen(first.Seq)
+	e.writeLen(stream.MaxDeletedID.Time)
+	e.writeLen(stream.MaxDeletedID.Seq)
+	e.writeLen(uint64(stream.EntriesAdded))
+
+	e.writeLen(uint64(len(stream.Groups)))
+	for _, name := range sortedGroups(stream) {
+		group := stream.Groups[name]
+		e.writeString(name)
+		e.writeLen(group.LastID.Time)
+		e.writeLen(group.LastID.Seq)
+		e.writeLen(uint64(group.EntriesRead))
+
+		// The group PEL holds the delivery details, the consumers only IDs
+		e.writeLen(uint64(len(group.PEL)))
+		for _, id := range sortedIDs(group.PEL) {
+			nack := group.PEL[id]
+			e.write([]byte(id.key()))
+			e.writeMillis(nack.DeliveryTime)
+			e.writeLen(uint64(nack.DeliveryCount))
+		}
+
+		e.writeLen(uint64(len(group.Consumers)))
+		for _, name := range sortedConsumers(group) {
+			consumer := group.Consumers[name]
+			e.writeString(name)
+			e.writeMillis(consumer.SeenTime)
+			e.writeMillis(consumer.ActiveTime)
+			e.writeLen(uint64(len(consumer.PEL)))
+			for _, id := range sortedIDs(consumer.PEL) {
+				e.write([]byte(id.key()))
+			}
+		}
+	}
+}
+
+func (e *rdbEncoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc = ^crc64.Update(^e.crc, rdbCRCTable, p)
+	_, e.err = e.w.Write(p)
+}
+
+func (e *rdbEncoder) writeByte(b byte) {
+	e.write([]byte{b})
+}
+
+// writeLen writes n in the length encoding read by decodeSize
+func (e *rdbEncoder) writeLen(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.write([]byte{byte(n)})
+	case n < 1<<14:
+		e.write([]byte{0x40 | byte(n>>8), byte(n)})
+	case n <= math.MaxUint32:
+		b := []byte{0x80, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		e.write(b)
+	default:
+		b := []byte{0x81, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(b[1:], n)
+		e.write(b)
+	}
+}
+
+func (e *rdbEncoder) writeString(s string) {
+	e.writeLen(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *rdbEncoder) writeMillis(ms int64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(ms))
+	e.write(b[:])
+}
+
+func (e *rdbEncoder) writeDouble(f float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+	e.write(b[:])
+}
+
+// listNodes packs the elements of a list into listpacks, like the nodes of a
+// Redis quicklist
+func listNodes(l *list.List) [][]byte {
+	nodes := [][]byte{}
+	count := 0
+	for e := l.Front(); e != nil; e = e.Next() {
+		last := len(nodes) - 1
+		if last < 0 || count == rdbListNodeMaxEntries || len(nodes[last]) >= rdbListNodeMaxBytes {
+			nodes = append(nodes, listpack.New())
+			last++
+			count = 0
+		}
+		nodes[last] = listpack.Append(nodes[last], e.Value.(string))
+		count++
+	}
+	return nodes
+}
+
+// ----------------------------------------------------------------------------
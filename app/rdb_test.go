@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRDBChecksum(t *testing.T) {
+	e := &rdbEncoder{w: io.Discard}
+	e.write([]byte("1234"))
+	e.write([]byte("56789"))
+	// Check value of the CRC-64 used by Redis
+	if e.crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("Expected 0xe9c6d914c4b8d9ca, got %#x", e.crc)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	server, err := NewServer(&Config{Port: "6393", Dir: dir, Dbfilename: "dump.rdb"})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Listener.Close()
+
+	conn := &ConnRW{RedirectRead: true}
+	commands := [][]string{
+		{"SET", "string", "value"},
+		{"SET", "expiring", "value", "PX", "100000"},
+		{"SET", "expired", "value", "PX", "1"},
+		{"RPUSH", "list", "a", "1", "b"},
+		{"HSET", "hash", "f", "v"},
+		{"SADD", "intset", "1", "2"},
+		{"SADD", "set", "a", "b"},
+		{"ZADD", "zset", "1.5", "a", "-inf", "b"},
+		{"PFADD", "hll", "a", "b"},
+		{"XADD", "stream", "1-1", "f", "v"},
+		{"XADD", "stream", "2-1", "f", "w"},
+		{"XADD", "stream", "3-1", "g", "x"},
+		{"XDEL", "stream", "2-1"},
+		{"XGROUP", "CREATE", "stream", "g", "0"},
+		{"XREADGROUP", "GROUP", "g", "c", "COUNT", "1", "STREAMS", "stream", ">"},
+		{"SELECT", "2"},
+		{"SET", "other", "db"},
+	}
+	for _, cmd := range commands {
+		server.Handler(ToResp(cmd...), conn)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if resp := server.save(nil); resp.Type != STRING || resp.Value != "OK" {
+		t.Fatalf("Expected OK, got %v", resp)
+	}
+	if server.Dirty.Load() != 0 {
+		t.Errorf("Expected no changes since the save, got %d", server.Dirty.Load())
+	}
+
+	rdb, err := os.ReadFile(filepath.Join(dir, "dump.rdb"))
+	if err != nil {
+		t.Fatalf("Failed to read rdb: %v", err)
+	}
+	if !bytes.HasPrefix(rdb, []byte("REDIS0011")) {
+		t.Errorf("Expected an RDB version 11 header, got %q", rdb[:9])
+	}
+	checksum := binary.LittleEndian.Uint64(rdb[len(rdb)-8:])
+	if crc := ^crc64.Update(^uint64(0), rdbCRCTable, rdb[:len(rdb)-8]); crc != checksum {
+		t.Errorf("Expected checksum %#x, got %#x", crc, checksum)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the rdb file in the directory, got %v", entries)
+	}
+
+	loaded, err := NewServer(&Config{Port: "6394", Dir: dir, Dbfilename: "dump.rdb"})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer loaded.Listener.Close()
+
+	conn = &ConnRW{RedirectRead: true}
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"GET", "string"}, []string{"value"}},
+		{[]string{"EXISTS", "expired"}, []string{"0"}},
+		{[]string{"LRANGE", "list", "0", "-1"}, []string{"a", "1", "b"}},
+		{[]string{"HGET", "hash", "f"}, []string{"v"}},
+		{[]string{"SISMEMBER", "intset", "2"}, []string{"1"}},
+		{[]string{"SISMEMBER", "set", "b"}, []string{"1"}},
+		{[]string{"ZRANGE", "zset", "0", "-1", "WITHSCORES"}, []string{"b", "-inf", "a", "1.5"}},
+		{[]string{"PFCOUNT", "hll"}, []string{"2"}},
+		{[]string{"XRANGE", "stream", "-", "+"}, []string{"1-1", "f", "v", "3-1", "g", "x"}},
+		{[]string{"XPENDING", "stream", "g", "-", "+", "10"}, []string{"1-1", "c"}},
+		{[]string{"XADD", "stream", "*", "f", "v"}, nil},
+		{[]string{"XLEN", "stream"}, []string{"3"}},
+		{[]string{"SELECT", "2"}, []string{"OK"}},
+		{[]string{"GET", "other"}, []string{"db"}},
+	}
+	for _, test := range tests {
+		resps := loaded.Handler(ToResp(test.args...), conn)
+		if test.expected == nil {
+			continue
+		}
+		values := flattenResp(resps)
+		if len(values) < len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, values)
+			continue
+		}
+		for i, v := range test.expected {
+			if values[i].Value != v {
+				t.Errorf("%v: expected %v, got %v", test.args, test.expected, values)
+				break
+			}
+		}
+	}
+	// Both servers expire keys in the background
+	server.SETsMu.RLock()
+	loaded.SETsMu.RLock()
+	if exp := loaded.DBs[0].EXPs["expiring"]; exp < time.Now().UnixMilli() {
+		t.Errorf("Expected expiring to keep its expiry, got %d", exp)
+	}
+	stream, saved := loaded.DBs[0].XADDs["stream"], server.DBs[0].XADDs["stream"]
+	if stream.MaxDeletedID.String() != "2-1" || stream.EntriesAdded != 4 || stream.Groups["g"].EntriesRead != saved.Groups["g"].EntriesRead {
+		t.Errorf("Expected the stream metadata to be loaded, got %+v", stream)
+	}
+	loaded.SETsMu.RUnlock()
+	server.SETsMu.RUnlock()
+
+	resp := loaded.lastsave(nil)
+	if resp.Type != INTEGER || resp.Value != intToStr(loaded.LastSave.Unix()) {
+		t.Errorf("Expected the last save time, got %v", resp)
+	}
+}
+
+func TestDirtyCountsChanges(t *testing.T) {
+	db := NewDatabase(0)
+	server := &Server{DBs: []*Database{db}}
+	conn := &ConnRW{RedirectRead: true}
+
+	tests := []struct {
+		args  []string
+		dirty int64
+	}{
+		{[]string{"SET", "string", "a"}, 1},
+		{[]string{"SET", "string", "b", "NX"}, 0},
+		{[]string{"LPOP", "string"}, 0},
+		{[]string{"LPOP", "missing"}, 0},
+		{[]string{"DEL", "missing"}, 0},
+		{[]string{"EXPIRE", "missing", "10"}, 0},
+		{[]string{"SADD", "set", "a", "b"}, 2},
+		{[]string{"SADD", "set", "a"}, 0},
+		{[]string{"RPUSH", "list", "a", "b", "c"}, 3},
+		{[]string{"DEL", "string", "list", "missing"}, 2},
+	}
+	for _, test := range tests {
+		before := server.Dirty.Load()
+		server.Handler(ToResp(test.args...), conn)
+		if dirty := server.Dirty.Load() - before; dirty != test.dirty {
+			t.Errorf("%v: expected %d changes, got %d", test.args, test.dirty, dirty)
+		}
+	}
+}
+
+func TestSavePoints(t *testing.T) {
+	dir := t.TempDir()
+	server, err := NewServer(&Config{Port: "6395", Dir: dir, Dbfilename: "dump.rdb", Save: "1 2"})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Listener.Close()
+
+	conn := &ConnRW{RedirectRead: true}
+	server.Handler(ToResp("SET", "a", "1"), conn)
+	time.Sleep(1200 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(dir, "dump.rdb")); err == nil {
+		t.Errorf("Expected no snapshot before enough writes")
+	}
+
+	server.Handler(ToResp("SET", "b", "2"), conn)
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join(dir, "dump.rdb")); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dump.rdb")); err != nil {
+		t.Errorf("Expected a snapshot once the save point was reached")
+	}
+
+	resps := server.Handler(ToResp("CONFIG", "GET", "save"), conn)
+	if values := flattenResp(resps); len(values) != 2 || values[1].Value != "1 2" {
+		t.Errorf("Expected the save points, got %v", values)
+	}
+	resps = server.Handler(ToResp("CONFIG", "SET", "save", "1"), conn)
+	if resps[0].Type != ERROR {
+		t.Errorf("Expected an error for invalid save points, got %v", resps[0])
+	}
+	resps = server.Handler(ToResp("BGSAVE"), conn)
+	if resps[0].Value != "Background saving started" && resps[0].Value != "ERR Background save already in progress" {
+		t.Errorf("Expected the background save to start, got %v", resps[0])
+	}
+
+	// The temporary directory is removed once the save is done
+	for saving := true; saving; {
+		time.Sleep(10 * time.Millisecond)
+		server.SETsMu.RLock()
+		saving = server.Saving
+		server.SETsMu.RUnlock()
+	}
+}
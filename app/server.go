@@ -13,7 +13,6 @@ import (
 	"math/rand/v2"
 
 	queue "github.com/elordeiro/redis-server/queue"
-	radix "github.com/elordeiro/redis-server/radix"
 )
 
 func (st ServerType) String() string {
@@ -35,13 +34,11 @@ func NewServer(config *Config) (*Server, error) {
 		Role:             MASTER,
 		Port:             config.Port,
 		MasterReplOffset: 0,
+		ReplDB:           -1,
 		Conns:            []*ConnRW{},
-		SETs:             map[string]string{},
 		SETsMu:           sync.RWMutex{},
-		EXPs:             map[string]int64{},
-		XADDs:            map[string]*radix.Radix{},
-		XADDsMu:          sync.RWMutex{},
-		XADDsCh:          make(chan bool, 1),
+		Hz:               defaultHz,
+		ExpireEffort:     defaultExpireEffort,
 	}
 
 	// Set server port number
@@ -59,6 +56,35 @@ func NewServer(config *Config) (*Server, error) {
 		server.MasterPort = config.MasterPort
 	}
 
+	// Create the databases
+	databases := defaultDatabases
+	if config.Databases > 0 {
+		databases = config.Databases
+	}
+	for i := range databases {
+		server.DBs = append(server.DBs, NewDatabase(i))
+	}
+	if server.Role == MASTER {
+		server.propagateExpiries()
+	}
+
+	// Set active expiry frequency and effort if given
+	if config.Hz > 0 {
+		server.Hz = min(config.Hz, maxHz)
+	}
+	if config.ExpireEffort > 0 {
+		server.ExpireEffort = min(config.ExpireEffort, maxExpireEffort)
+	}
+
+	// Set the save points, snapshots are only taken on demand without them
+	params, err := parseSaveParams(config.Save)
+	if err != nil {
+		return nil, err
+	}
+	server.SaveParams = params
+	server.LastSave = time.Now()
+	server.LastSaveOK = true
+
 	// Set server repl id and repl offset
 	server.MasterReplid = RandStringBytes(40)
 
@@ -70,6 +96,9 @@ func NewServer(config *Config) (*Server, error) {
 
 	}
 
+	go server.activeExpireLoop()
+	go server.saveLoop()
+
 	return server, nil
 }
 
@@ -148,7 +177,7 @@ func (s *Server) handShake() error {
 
 	resp := NewBuffer(conn)
 	writer := NewWriter(conn)
-	connRW := &ConnRW{MASTER, conn, resp, writer, nil, false, false, queue.NewQueue()}
+	connRW := &ConnRW{MASTER, conn, resp, writer, nil, false, false, queue.NewQueue(), make(chan struct{}), nil, 0, nil}
 
 	// Stage 1
 	Write(writer, PingResp())
@@ -185,6 +214,12 @@ func (s *Server) handShake() error {
 	if err != nil {
 		return err
 	}
+	// The snapshot replaces whatever the replica had
+	s.SETsMu.Lock()
+	for _, db := range s.DBs {
+		db.empty()
+	}
+	s.SETsMu.Unlock()
 	s.Handler(rdb, connRW)
 
 	s.MasterReplOffset = 0
@@ -206,20 +241,30 @@ func (s *Server) handleClientConnAsMaster(conn net.Conn) {
 	resp := NewBuffer(conn)
 	writer := NewWriter(conn)
 	ch := make(chan *RESP)
-	connRW := &ConnRW{CLIENT, conn, resp, writer, ch, false, false, queue.NewQueue()}
+	connRW := &ConnRW{CLIENT, conn, resp, writer, ch, false, false, queue.NewQueue(), make(chan struct{}), nil, 0, nil}
 	s.Conns = append(s.Conns, connRW)
+	cmds := readCommands(connRW)
+	var pending []ClientCommand
 	for {
-		parsedResp, _, err := resp.Read()
-		if err != nil {
-			fmt.Println(err)
-			fmt.Println("Closing")
-			return
+		select {
+		case cmd, ok := <-cmds:
+			if !ok {
+				return
+			}
+			pending = append(pending, cmd)
+		case <-connRW.Blocked:
+			connRW.Blocked = nil
 		}
 
-		if s.RedirectRead || connRW.RedirectRead {
-			fmt.Println("Handling client connection on redirect", parsedResp)
-			connRW.Chan <- parsedResp
-		} else {
+		// Pipelined commands wait for a blocked command to reply first
+		for len(pending) > 0 && connRW.Blocked == nil {
+			parsedResp := pending[0].Resp
+			pending = pending[1:]
+			if s.RedirectRead || connRW.RedirectRead {
+				fmt.Println("Handling client connection on redirect", parsedResp)
+				connRW.Chan <- parsedResp
+				continue
+			}
 			fmt.Println("Handling client connection on main loop", parsedResp)
 			results := s.Handler(parsedResp, connRW)
 
@@ -234,28 +279,58 @@ func (s *Server) handleClientConnAsMaster(conn net.Conn) {
 func (s *Server) handleClientConnAsReplica(conn net.Conn) {
 	resp := NewBuffer(conn)
 	writer := NewWriter(conn)
-	connRW := &ConnRW{CLIENT, conn, resp, writer, nil, false, false, queue.NewQueue()}
+	connRW := &ConnRW{CLIENT, conn, resp, writer, nil, false, false, queue.NewQueue(), make(chan struct{}), nil, 0, nil}
 	s.Conns = append(s.Conns, connRW)
+	cmds := readCommands(connRW)
+	var pending []ClientCommand
 	for {
-		parsedResp, n, err := resp.Read()
-		var results []*RESP
-		if err != nil {
-			if err.Error() == "EOF" {
-				fmt.Println("Closing")
+		select {
+		case cmd, ok := <-cmds:
+			if !ok {
 				return
 			}
-			fmt.Println(err)
-		} else {
-			results = s.Handler(parsedResp, connRW)
-			s.MasterReplOffset += n
+			pending = append(pending, cmd)
+		case <-connRW.Blocked:
+			connRW.Blocked = nil
 		}
 
-		for _, result := range results {
-			Write(writer, result)
+		for len(pending) > 0 && connRW.Blocked == nil {
+			cmd := pending[0]
+			pending = pending[1:]
+			results := s.Handler(cmd.Resp, connRW)
+			s.MasterReplOffset += cmd.Size
+
+			for _, result := range results {
+				Write(writer, result)
+			}
 		}
 	}
 }
 
+// readCommands reads commands from a client connection on its own goroutine
+// until the connection closes, then closes connRW.Closed and the returned
+// channel. Reading goes on while a command is blocked, so a client that
+// disconnects with commands pipelined behind it is still unblocked.
+func readCommands(connRW *ConnRW) <-chan ClientCommand {
+	cmds := make(chan ClientCommand)
+	go func() {
+		defer close(cmds)
+		for {
+			parsedResp, n, err := connRW.Reader.Read()
+			if err != nil {
+				if err.Error() != "EOF" {
+					fmt.Println(err)
+				}
+				fmt.Println("Closing")
+				close(connRW.Closed)
+				return
+			}
+			cmds <- ClientCommand{parsedResp, n}
+		}
+	}()
+	return cmds
+}
+
 func (s *Server) handleMasterConnAsReplica(connRW *ConnRW) {
 	s.Conns = append(s.Conns, connRW)
 	for {
@@ -285,6 +360,10 @@ func parseFlags() (*Config, error) {
 	flag.StringVar(&repl, "replicaof", "", "Master connection <address port> to replicate")
 	flag.StringVar(&config.Dir, "dir", "", "directory to rdb file")
 	flag.StringVar(&config.Dbfilename, "dbfilename", "", "rdb file name")
+	flag.IntVar(&config.Hz, "hz", defaultHz, "background task frequency per second")
+	flag.IntVar(&config.Databases, "databases", defaultDatabases, "number of databases")
+	flag.IntVar(&config.ExpireEffort, "active-expire-effort", defaultExpireEffort, "active expiry effort from 1 to 10")
+	flag.StringVar(&config.Save, "save", "", "save points as \"<seconds> <changes> ...\"")
 
 	flag.Parse()
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"net"
+	"sync"
 	"testing"
 	"time"
 )
@@ -29,7 +30,26 @@ func connectToServer(port string) *ReadWriter {
 	return nil
 }
 
+// Servers are shared between tests, so each port is only started once
+var (
+	startedMu sync.Mutex
+	started   = map[string]bool{}
+)
+
+func startOnce(port string) bool {
+	startedMu.Lock()
+	defer startedMu.Unlock()
+	if started[port] {
+		return false
+	}
+	started[port] = true
+	return true
+}
+
 func createMasterServer(port string) {
+	if !startOnce(port) {
+		return
+	}
 	go func() {
 		server, err := NewServer(&Config{Port: port})
 		if err != nil {
@@ -40,6 +60,9 @@ func createMasterServer(port string) {
 }
 
 func createReplicaServer(port, masterPort string) {
+	if !startOnce(port) {
+		return
+	}
 	go func() {
 		server, err := NewServer(&Config{
 			Port:       port,
@@ -135,3 +158,136 @@ func TestNewReplica(t *testing.T) {
 		t.Errorf("Expected bar, got %v", parsedResp)
 	}
 }
+
+func TestReplicaSelect(t *testing.T) {
+	createMasterServer("6379")
+	masterConn := connectToServer("6379")
+	defer masterConn.Conn.Close()
+	createReplicaServer("6380", "6379")
+	replConn := connectToServer("6380")
+	defer replConn.Conn.Close()
+
+	// Writes to another database are applied to the same one on the replica
+	Write(masterConn.Writer, ToResp("SELECT", "6"))
+	masterConn.Buffer.Read()
+	Write(masterConn.Writer, ToResp("SET", "replica:select", "six"))
+	masterConn.Buffer.Read()
+	Write(masterConn.Writer, ToResp("WAIT", "1", "2000"))
+	masterConn.Buffer.Read()
+
+	Write(replConn.Writer, ToResp("GET", "replica:select"))
+	parsedResp, _, _ := replConn.Buffer.Read()
+	if parsedResp.Type != 0 {
+		t.Errorf("Expected nil in database 0, got %v", parsedResp)
+	}
+
+	Write(replConn.Writer, ToResp("SELECT", "6"))
+	replConn.Buffer.Read()
+	Write(replConn.Writer, ToResp("GET", "replica:select"))
+	parsedResp, _, _ = replConn.Buffer.Read()
+	if parsedResp.Value != "six" {
+		t.Errorf("Expected six, got %v", parsedResp)
+	}
+}
+
+func TestReplicaIncrbyfloat(t *testing.T) {
+	createMasterServer("6379")
+	masterConn := connectToServer("6379")
+	defer masterConn.Conn.Close()
+	createReplicaServer("6380", "6379")
+	replConn := connectToServer("6380")
+	defer replConn.Conn.Close()
+
+	// The result is propagated as a SET that keeps the expiry
+	Write(masterConn.Writer, ToResp("SET", "replica:float", "1.5", "EX", "100"))
+	masterConn.Buffer.Read()
+	Write(masterConn.Writer, ToResp("INCRBYFLOAT", "replica:float", "0.25"))
+	masterConn.Buffer.Read()
+	Write(masterConn.Writer, ToResp("WAIT", "1", "2000"))
+	masterConn.Buffer.Read()
+
+	Write(replConn.Writer, ToResp("GET", "replica:float"))
+	parsedResp, _, _ := replConn.Buffer.Read()
+	if parsedResp.Value != "1.75" {
+		t.Errorf("Expected 1.75, got %v", parsedResp)
+	}
+	Write(replConn.Writer, ToResp("TTL", "replica:float"))
+	parsedResp, _, _ = replConn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "100" {
+		t.Errorf("Expected 100, got %v", parsedResp)
+	}
+}
+
+func TestReplicaFullResync(t *testing.T) {
+	createMasterServer("6379")
+	masterConn := connectToServer("6379")
+	defer masterConn.Conn.Close()
+
+	for _, cmd := range [][]string{
+		{"SET", "resync:string", "a"},
+		{"RPUSH", "resync:list", "a", "b"},
+		{"XADD", "resync:stream", "1-1", "f", "v"},
+		{"SELECT", "3"},
+		{"SET", "resync:db", "three"},
+		{"SELECT", "0"},
+	} {
+		Write(masterConn.Writer, ToResp(cmd...))
+		masterConn.Buffer.Read()
+	}
+
+	// Writes made while the replica syncs reach it after the snapshot
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writer := connectToServer("6379")
+		defer writer.Conn.Close()
+		for range 200 {
+			Write(writer.Writer, ToResp("INCR", "resync:counter"))
+			writer.Buffer.Read()
+		}
+	}()
+	createReplicaServer("6381", "6379")
+	replConn := connectToServer("6381")
+	defer replConn.Conn.Close()
+	<-done
+
+	deadline := time.Now().Add(2 * time.Second)
+	var parsedResp *RESP
+	for time.Now().Before(deadline) {
+		Write(replConn.Writer, ToResp("GET", "resync:counter"))
+		parsedResp, _, _ = replConn.Buffer.Read()
+		if parsedResp.Value == "200" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if parsedResp.Value != "200" {
+		t.Errorf("Expected 200, got %v", parsedResp)
+	}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"GET", "resync:string"}, []string{"a"}},
+		{[]string{"LRANGE", "resync:list", "0", "-1"}, []string{"a", "b"}},
+		{[]string{"XRANGE", "resync:stream", "-", "+"}, []string{"1-1", "f", "v"}},
+		{[]string{"SELECT", "3"}, []string{"OK"}},
+		{[]string{"GET", "resync:db"}, []string{"three"}},
+	}
+	for _, test := range tests {
+		Write(replConn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := replConn.Buffer.Read()
+		values := flattenResp([]*RESP{parsedResp})
+		if len(values) != len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, parsedResp)
+			continue
+		}
+		for i, v := range test.expected {
+			if values[i].Value != v {
+				t.Errorf("%v: expected %v, got %v", test.args, test.expected, parsedResp)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// Set commands ---------------------------------------------------------------
+func (s *Server) sadd(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'sadd' command")
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	set, errResp := db.getSet(key)
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		set = NewSet()
+		db.setValue(key, set)
+	}
+
+	added := 0
+	for _, member := range args[1:] {
+		if set.Add(member.Value) {
+			added++
+		}
+	}
+	s.Dirty.Add(int64(added))
+	return Integer(added)
+}
+
+func (s *Server) srem(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'srem' command")
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	set, errResp := db.getSet(key)
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		return Integer(0)
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if set.Remove(member.Value) {
+			removed++
+		}
+	}
+	if set.Len() == 0 {
+		db.deleteKey(key)
+	}
+	s.Dirty.Add(int64(removed))
+	return Integer(removed)
+}
+
+func (s *Server) smembers(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'smembers' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	set, errResp := db.getSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		return ToResp()
+	}
+	return ToResp(set.Members()...)
+}
+
+func (s *Server) sismember(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'sismember' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	set, errResp := db.getSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if set != nil && set.Contains(args[1].Value) {
+		return Integer(1)
+	}
+	return Integer(0)
+}
+
+func (s *Server) scard(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'scard' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	set, errResp := db.getSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if set == nil {
+		return Integer(0)
+	}
+	return Integer(set.Len())
+}
+
+func (s *Server) sinter(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'sinter' command")
+	}
+	return s.setOperation(db, args, SET_INTER, "")
+}
+
+func (s *Server) sunion(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'sunion' command")
+	}
+	return s.setOperation(db, args, SET_UNION, "")
+}
+
+func (s *Server) sdiff(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'sdiff' command")
+	}
+	return s.setOperation(db, args, SET_DIFF, "")
+}
+
+func (s *Server) sinterstore(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'sinterstore' command")
+	}
+	return s.setOperation(db, args[1:], SET_INTER, args[0].Value)
+}
+
+func (s *Server) sunionstore(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'sunionstore' command")
+	}
+	return s.setOperation(db, args[1:], SET_UNION, args[0].Value)
+}
+
+func (s *Server) sdiffstore(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'sdiffstore' command")
+	}
+	return s.setOperation(db, args[1:], SET_DIFF, args[0].Value)
+}
+
+// ----------------------------------------------------------------------------
+
+// Set helpers ----------------------------------------------------------------
+// Set operations
+const (
+	SET_INTER = iota
+	SET_UNION
+	SET_DIFF
+)
+
+// Sets with more integer members than this switch to the hash table encoding
+const setMaxIntsetEntries = 512
+
+// NewSet returns an empty set using the integer set encoding
+func NewSet() *Set {
+	return &Set{ints: []int64{}}
+}
+
+// IsIntset reports whether the set is using the integer set encoding
+func (set *Set) IsIntset() bool {
+	return set.members == nil
+}
+
+// Add adds member to the set and reports whether it was not already present
+func (set *Set) Add(member string) bool {
+	if set.IsIntset() {
+		n, ok := toSetInt(member)
+		if ok {
+			i, found := slices.BinarySearch(set.ints, n)
+			if found {
+				return false
+			}
+			if len(set.ints) < setMaxIntsetEntries {
+				set.ints = slices.Insert(set.ints, i, n)
+				return true
+			}
+		}
+		set.convert()
+	}
+
+	if _, ok := set.members[member]; ok {
+		return false
+	}
+	set.members[member] = struct{}{}
+	return true
+}
+
+// Remove removes member from the set and reports whether it was present
+func (set *Set) Remove(member string) bool {
+	if set.IsIntset() {
+		n, ok := toSetInt(member)
+		if !ok {
+			return false
+		}
+		i, found := slices.BinarySearch(set.ints, n)
+		if found {
+			set.ints = slices.Delete(set.ints, i, i+1)
+		}
+		return found
+	}
+
+	if _, ok := set.members[member]; !ok {
+		return false
+	}
+	delete(set.members, member)
+	return true
+}
+
+// Contains reports whether member is in the set
+func (set *Set) Contains(member string) bool {
+	if set.IsIntset() {
+		n, ok := toSetInt(member)
+		if !ok {
+			return false
+		}
+		_, found := slices.BinarySearch(set.ints, n)
+		return found
+	}
+	_, ok := set.members[member]
+	return ok
+}
+
+// Len returns the number of members in the set
+func (set *Set) Len() int {
+	if set.IsIntset() {
+		return len(set.ints)
+	}
+	return len(set.members)
+}
+
+// Members returns every member of the set. Integer sets are returned in
+// ascending order.
+func (set *Set) Members() []string {
+	members := make([]string, 0, set.Len())
+	if set.IsIntset() {
+		for _, n := range set.ints {
+			members = append(members, strconv.FormatInt(n, 10))
+		}
+		return members
+	}
+	for member := range set.members {
+		members = append(members, member)
+	}
+	return members
+}
+
+// Clone returns a copy of the set
+func (set *Set) Clone() *Set {
+	return &Set{ints: slices.Clone(set.ints), members: maps.Clone(set.members)}
+}
+
+// convert switches the set to the hash table encoding
+func (set *Set) convert() {
+	set.members = make(map[string]struct{}, len(set.ints))
+	for _, n := range set.ints {
+		set.members[strconv.FormatInt(n, 10)] = struct{}{}
+	}
+	set.ints = nil
+}
+
+// toSetInt parses member as an integer if it is in canonical form, so that
+// members like "01" or "+1" keep their original spelling
+func toSetInt(member string) (int64, bool) {
+	n, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != member {
+		return 0, false
+	}
+	return n, true
+}
+
+// getSet returns the set stored at key, nil if the key does not exist, or a
+// WRONGTYPE error if the key holds another type. Caller must hold SETsMu.
+func (db *Database) getSet(key string) (*Set, *RESP) {
+	db.expireIfNeeded(key)
+	set, ok := db.SADDs[key]
+	if !ok && db.typeOf(key) != "none" {
+		return nil, WrongTypeResp()
+	}
+	return set, nil
+}
+
+// setOperation computes the intersection, union or difference of the sets at
+// keys. Missing keys count as empty sets. The result is returned, or stored
+// at dst when given, replying with its size.
+func (s *Server) setOperation(db *Database, keys []*RESP, op int, dst string) *RESP {
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	sets := make([]*Set, len(keys))
+	for i, key := range keys {
+		set, errResp := db.getSet(key.Value)
+		if errResp != nil {
+			return errResp
+		}
+		if set == nil {
+			set = NewSet()
+		}
+		sets[i] = set
+	}
+
+	result := NewSet()
+	switch op {
+	case SET_INTER:
+		// Iterate over the smallest set and check the others
+		slices.SortFunc(sets, func(a, b *Set) int { return a.Len() - b.Len() })
+		for _, member := range sets[0].Members() {
+			inAll := true
+			for _, set := range sets[1:] {
+				if !set.Contains(member) {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result.Add(member)
+			}
+		}
+	case SET_UNION:
+		for _, set := range sets {
+			for _, member := range set.Members() {
+				result.Add(member)
+			}
+		}
+	case SET_DIFF:
+		for _, member := range sets[0].Members() {
+			inOther := false
+			for _, set := range sets[1:] {
+				if set.Contains(member) {
+					inOther = true
+					break
+				}
+			}
+			if !inOther {
+				result.Add(member)
+			}
+		}
+	}
+
+	if dst == "" {
+		return ToResp(result.Members()...)
+	}
+
+	if db.typeOf(dst) != "none" || result.Len() > 0 {
+		s.Dirty.Add(1)
+	}
+	db.deleteKey(dst)
+	if result.Len() > 0 {
+		db.setValue(dst, result)
+	}
+	return Integer(result.Len())
+}
+
+// ----------------------------------------------------------------------------
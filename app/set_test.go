@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestSetEncoding(t *testing.T) {
+	set := NewSet()
+
+	// Test integer members keep the integer set encoding
+	set.Add("3")
+	set.Add("1")
+	set.Add("2")
+	if !set.IsIntset() {
+		t.Error("Expected integer set encoding")
+	}
+	if !slices.Equal(set.Members(), []string{"1", "2", "3"}) {
+		t.Errorf("Expected sorted members, got %v", set.Members())
+	}
+
+	// Test non-canonical integers are not treated as integers
+	if set.Contains("01") {
+		t.Error("Expected 01 not to match 1")
+	}
+
+	// Test adding a string converts the set
+	set.Add("a")
+	if set.IsIntset() {
+		t.Error("Expected hash table encoding after adding a string")
+	}
+	if set.Len() != 4 || !set.Contains("2") || !set.Contains("a") {
+		t.Errorf("Expected members to survive conversion, got %v", set.Members())
+	}
+
+	// Test growing past the integer set limit converts the set
+	set = NewSet()
+	for i := 0; i <= setMaxIntsetEntries; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+	if set.IsIntset() {
+		t.Error("Expected hash table encoding after growing past the limit")
+	}
+	if set.Len() != setMaxIntsetEntries+1 {
+		t.Errorf("Expected %d members, got %d", setMaxIntsetEntries+1, set.Len())
+	}
+}
+
+func TestSaddAndSrem(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("SADD", "set:tags", "go", "redis", "go"))
+	parsedResp, _, err := conn.Buffer.Read()
+	if err != nil {
+		t.Errorf("Failed to read response: %v", err)
+	}
+	if parsedResp.Type != INTEGER || parsedResp.Value != "2" {
+		t.Errorf("Expected 2, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("SISMEMBER", "set:tags", "redis"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "1" {
+		t.Errorf("Expected 1, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("SREM", "set:tags", "redis", "missing"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "1" {
+		t.Errorf("Expected 1, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("SCARD", "set:tags"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "1" {
+		t.Errorf("Expected 1, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("TYPE", "set:tags"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Value != "set" {
+		t.Errorf("Expected set, got %v", parsedResp)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("SADD", "set:a", "1", "2", "3", "x"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SADD", "set:b", "2", "3", "4"))
+	conn.Buffer.Read()
+
+	members := func(resp *RESP) []string {
+		values := []string{}
+		for _, v := range resp.Values {
+			values = append(values, v.Value)
+		}
+		slices.Sort(values)
+		return values
+	}
+
+	Write(conn.Writer, ToResp("SINTER", "set:a", "set:b"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if got := members(parsedResp); !slices.Equal(got, []string{"2", "3"}) {
+		t.Errorf("Expected [2 3], got %v", got)
+	}
+
+	Write(conn.Writer, ToResp("SUNION", "set:a", "set:b"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if got := members(parsedResp); !slices.Equal(got, []string{"1", "2", "3", "4", "x"}) {
+		t.Errorf("Expected [1 2 3 4 x], got %v", got)
+	}
+
+	Write(conn.Writer, ToResp("SDIFF", "set:a", "set:b", "set:missing"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if got := members(parsedResp); !slices.Equal(got, []string{"1", "x"}) {
+		t.Errorf("Expected [1 x], got %v", got)
+	}
+
+	Write(conn.Writer, ToResp("SINTERSTORE", "set:dst", "set:a", "set:b"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "2" {
+		t.Errorf("Expected 2, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("SMEMBERS", "set:dst"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if got := members(parsedResp); !slices.Equal(got, []string{"2", "3"}) {
+		t.Errorf("Expected [2 3], got %v", got)
+	}
+}
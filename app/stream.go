@@ -0,0 +1,2049 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	listpack "github.com/elordeiro/redis-server/listpack"
+	radix "github.com/elordeiro/redis-server/radix"
+)
+
+// Stream commands ------------------------------------------------------------
+func (s *Server) xadd(db *Database, args []*RESP) *RESP {
+	if len(args) < 4 {
+		return ErrResp("ERR wrong number of arguments for 'xadd' command")
+	}
+
+	key := args[0].Value
+	noMkStream := false
+	var trim *streamTrim
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "NOMKSTREAM":
+			noMkStream = true
+		case "MAXLEN", "MINID":
+			var n int
+			var errResp *RESP
+			if trim, n, errResp = parseStreamTrim(args[i:]); errResp != nil {
+				return errResp
+			}
+			i += n - 1
+		default:
+			break options
+		}
+	}
+	if rest := len(args) - i; rest < 3 || rest%2 == 0 {
+		return ErrResp("ERR wrong number of arguments for 'xadd' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(key)
+	if errResp != nil {
+		return errResp
+	}
+	created := stream == nil
+	if created {
+		if noMkStream {
+			return NullResp()
+		}
+		stream = NewStream()
+	}
+
+	id, errResp := stream.nextID(args[i].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if created {
+		db.setValue(key, stream)
+	}
+
+	fields := make([]string, 0, len(args)-i-1)
+	for _, arg := range args[i+1:] {
+		fields = append(fields, arg.Value)
+	}
+	stream.insert(id, fields)
+	stream.Length++
+	stream.EntriesAdded++
+	stream.LastID = id
+	if trim != nil {
+		stream.trim(trim)
+	}
+
+	// Replicas add the entry with the same ID
+	cmd := make([]string, 0, len(args)+1)
+	cmd = append(cmd, "XADD")
+	for j, arg := range args {
+		if j == i {
+			cmd = append(cmd, id.String())
+		} else {
+			cmd = append(cmd, arg.Value)
+		}
+	}
+	s.propagateCommand(db, ToResp(cmd...))
+	s.Dirty.Add(1)
+
+	s.signalKeyReady(db, key)
+	return BulkString(id.String())
+}
+
+func (s *Server) xrange(db *Database, args []*RESP) *RESP {
+	return s.rangeStream(db, args, "xrange", false)
+}
+
+func (s *Server) xrevrange(db *Database, args []*RESP) *RESP {
+	return s.rangeStream(db, args, "xrevrange", true)
+}
+
+func (s *Server) xread(db *Database, args []*RESP, conn *ConnRW) *RESP {
+	count := 0
+	timeout := time.Duration(-1)
+	streams := -1
+	for i := 0; i < len(args) && streams == -1; i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			n, errResp := parseInt(args[i+1].Value)
+			if errResp != nil {
+				return errResp
+			}
+			count = max(n, 0)
+			i++
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			ms, err := strconv.ParseInt(args[i+1].Value, 10, 64)
+			if err != nil {
+				return ErrResp("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return ErrResp("ERR timeout is negative")
+			}
+			timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case "STREAMS":
+			streams = i + 1
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+	if streams == -1 {
+		return ErrResp("ERR syntax error")
+	}
+	rest := args[streams:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return ErrResp("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+
+	n := len(rest) / 2
+	keys := make([]string, n)
+	starts := make([]StreamID, n)
+	for i := range n {
+		keys[i] = rest[i].Value
+		if rest[n+i].Value == "$" {
+			continue
+		}
+		var errResp *RESP
+		if starts[i], errResp = parseStreamID(rest[n+i].Value, 0, true); errResp != nil {
+			return errResp
+		}
+	}
+
+	s.SETsMu.Lock()
+	for i, key := range keys {
+		stream, errResp := db.getStream(key)
+		if errResp != nil {
+			s.SETsMu.Unlock()
+			return errResp
+		}
+		// $ only reads entries added after the call
+		if rest[n+i].Value == "$" && stream != nil {
+			starts[i] = stream.LastID
+		}
+	}
+
+	resp := s.readStreams(db, keys, starts, count)
+	if resp != nil || timeout < 0 || conn.RedirectRead {
+		s.SETsMu.Unlock()
+		if resp == nil {
+			return NullResp()
+		}
+		return resp
+	}
+
+	client := &BlockedClient{DB: db, Keys: keys, Ch: make(chan *RESP, 1)}
+	client.Serve = func(key string) *RESP {
+		return s.readStreams(db, keys, starts, count)
+	}
+	s.blockOn(client)
+	s.SETsMu.Unlock()
+
+	resp = s.waitForKeys(client, timeout, conn)
+	if resp == nil {
+		return NullResp()
+	}
+	return resp
+}
+
+func (s *Server) xlen(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'xlen' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return Integer(0)
+	}
+	return Integer(stream.Length)
+}
+
+func (s *Server) xdel(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'xdel' command")
+	}
+
+	ids, errResp := parseStreamIDs(args[1:])
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return Integer(0)
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if stream.delete(id) {
+			deleted++
+		}
+	}
+	s.Dirty.Add(int64(deleted))
+	return Integer(deleted)
+}
+
+func (s *Server) xtrim(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 {
+		return ErrResp("ERR wrong number of arguments for 'xtrim' command")
+	}
+
+	strategy := strings.ToUpper(args[1].Value)
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return ErrResp("ERR syntax error")
+	}
+	trim, n, errResp := parseStreamTrim(args[1:])
+	if errResp != nil {
+		return errResp
+	}
+	if 1+n != len(args) {
+		return ErrResp("ERR syntax error")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return Integer(0)
+	}
+	trimmed := stream.trim(trim)
+	s.Dirty.Add(int64(trimmed))
+	return Integer(trimmed)
+}
+
+func (s *Server) xsetid(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 && len(args) != 4 && len(args) != 6 {
+		return ErrResp("ERR wrong number of arguments for 'xsetid' command")
+	}
+
+	id, errResp := parseStreamID(args[1].Value, 0, true)
+	if errResp != nil {
+		return errResp
+	}
+	entriesAdded := int64(-1)
+	var maxDeletedID *StreamID
+	for i := 2; i < len(args); i += 2 {
+		switch strings.ToUpper(args[i].Value) {
+		case "ENTRIESADDED":
+			n, ok := parseInt64(args[i+1].Value)
+			if !ok {
+				return ErrResp("ERR value is not an integer or out of range")
+			}
+			if n < 0 {
+				return ErrResp("ERR entries_added must be positive")
+			}
+			entriesAdded = n
+		case "MAXDELETEDID":
+			deleted, errResp := parseStreamID(args[i+1].Value, 0, true)
+			if errResp != nil {
+				return errResp
+			}
+			if id.Compare(deleted) < 0 {
+				return ErrResp("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+			}
+			maxDeletedID = &deleted
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return ErrResp("ERR no such key")
+	}
+
+	// The ID may only go back as far as the last entry still in the stream
+	if stream.Length > 0 {
+		if records := stream.rangeEntries(StreamID{}, maxStreamID, 1, true); id.Compare(records[0].id) < 0 {
+			return ErrResp("ERR The ID specified in XSETID is smaller than the target stream top item")
+		}
+	}
+	if entriesAdded != -1 && int64(stream.Length) > entriesAdded {
+		return ErrResp("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+
+	stream.LastID = id
+	if entriesAdded != -1 {
+		stream.EntriesAdded = entriesAdded
+	}
+	if maxDeletedID != nil {
+		stream.MaxDeletedID = *maxDeletedID
+	}
+	s.Dirty.Add(1)
+	return OkResp()
+}
+
+func (s *Server) xgroup(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'xgroup' command")
+	}
+
+	sub := strings.ToUpper(args[0].Value)
+	var minArgs, maxArgs int
+	switch sub {
+	case "CREATE":
+		minArgs, maxArgs = 4, 7
+	case "SETID":
+		minArgs, maxArgs = 4, 6
+	case "CREATECONSUMER", "DELCONSUMER":
+		minArgs, maxArgs = 4, 4
+	case "DESTROY":
+		minArgs, maxArgs = 3, 3
+	default:
+		return ErrResp(fmt.Sprintf("ERR unknown subcommand '%s'. Try XGROUP HELP.", args[0].Value))
+	}
+	if len(args) < minArgs || len(args) > maxArgs {
+		return ErrResp(fmt.Sprintf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(sub)))
+	}
+
+	key, groupName := args[1].Value, args[2].Value
+	mkstream := false
+	entriesRead := int64(streamEntriesReadInvalid)
+	for i := 4; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "MKSTREAM":
+			if sub != "CREATE" {
+				return ErrResp("ERR syntax error")
+			}
+			mkstream = true
+		case "ENTRIESREAD":
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			n, ok := parseInt64(args[i+1].Value)
+			if !ok {
+				return ErrResp("ERR value is not an integer or out of range")
+			}
+			if n < streamEntriesReadInvalid {
+				return ErrResp("ERR value for ENTRIESREAD must be positive or -1")
+			}
+			entriesRead = n
+			i++
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil && !mkstream {
+		return ErrResp("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+
+	var group *StreamGroup
+	if stream != nil && sub != "CREATE" {
+		if group = stream.Groups[groupName]; group == nil {
+			return ErrResp(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", groupName, key))
+		}
+	}
+
+	switch sub {
+	case "CREATE", "SETID":
+		created := stream == nil
+		if created {
+			stream = NewStream()
+		}
+		id := stream.LastID
+		if args[3].Value != "$" {
+			if id, errResp = parseStreamID(args[3].Value, 0, true); errResp != nil {
+				return errResp
+			}
+		}
+		if sub == "SETID" {
+			group.LastID = id
+			group.EntriesRead = entriesRead
+			s.Dirty.Add(1)
+			return OkResp()
+		}
+		if _, ok := stream.Groups[groupName]; ok {
+			return ErrResp("BUSYGROUP Consumer Group name already exists")
+		}
+		if created {
+			db.setValue(key, stream)
+		}
+		stream.Groups[groupName] = NewStreamGroup(id, entriesRead)
+		s.Dirty.Add(1)
+		return OkResp()
+	case "DESTROY":
+		if group == nil {
+			return Integer(0)
+		}
+		delete(stream.Groups, groupName)
+		s.Dirty.Add(1)
+		// Clients blocked reading the group get an error
+		s.signalKeyReady(db, key)
+		return Integer(1)
+	case "CREATECONSUMER":
+		if _, ok := group.Consumers[args[3].Value]; ok {
+			return Integer(0)
+		}
+		group.consumer(args[3].Value, time.Now().UnixMilli())
+		s.Dirty.Add(1)
+		return Integer(1)
+	default:
+		consumer, ok := group.Consumers[args[3].Value]
+		if !ok {
+			return Integer(0)
+		}
+		for id := range consumer.PEL {
+			delete(group.PEL, id)
+		}
+		delete(group.Consumers, consumer.Name)
+		s.Dirty.Add(1)
+		return Integer(len(consumer.PEL))
+	}
+}
+
+func (s *Server) xreadgroup(db *Database, args []*RESP, conn *ConnRW) *RESP {
+	query := &xreadgroupQuery{}
+	timeout := time.Duration(-1)
+	streams := -1
+	for i := 0; i < len(args) && streams == -1; i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "GROUP":
+			if i+2 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			query.group, query.consumer = args[i+1].Value, args[i+2].Value
+			i += 2
+		case "COUNT":
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			count, errResp := parseInt(args[i+1].Value)
+			if errResp != nil {
+				return errResp
+			}
+			query.count = max(count, 0)
+			i++
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			ms, err := strconv.ParseInt(args[i+1].Value, 10, 64)
+			if err != nil {
+				return ErrResp("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return ErrResp("ERR timeout is negative")
+			}
+			timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case "NOACK":
+			query.noack = true
+		case "STREAMS":
+			streams = i + 1
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+	if streams == -1 {
+		return ErrResp("ERR syntax error")
+	}
+	if query.group == "" {
+		return ErrResp("ERR Missing GROUP option for XREADGROUP")
+	}
+	rest := args[streams:]
+	if len(rest) == 0 || len(rest)%2 != 0 {
+		return ErrResp("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+	}
+
+	n := len(rest) / 2
+	query.keys = make([]string, n)
+	query.ids = make([]string, n)
+	for i := range n {
+		query.keys[i], query.ids[i] = rest[i].Value, rest[n+i].Value
+		switch query.ids[i] {
+		case ">":
+		case "$":
+			return ErrResp("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		default:
+			if _, errResp := parseStreamID(query.ids[i], 0, true); errResp != nil {
+				return errResp
+			}
+		}
+	}
+
+	s.SETsMu.Lock()
+	for _, key := range query.keys {
+		stream, errResp := db.getStream(key)
+		if errResp != nil {
+			s.SETsMu.Unlock()
+			return errResp
+		}
+		if stream == nil || stream.Groups[query.group] == nil {
+			s.SETsMu.Unlock()
+			return ErrResp(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, query.group))
+		}
+	}
+
+	resp := s.readGroup(db, query)
+	if resp != nil || timeout < 0 || conn.RedirectRead {
+		s.SETsMu.Unlock()
+		if resp == nil {
+			return NullResp()
+		}
+		return resp
+	}
+
+	// Only new entries are waited for, history reads always reply at once
+	client := &BlockedClient{DB: db, Keys: query.keys, Ch: make(chan *RESP, 1)}
+	client.Serve = func(key string) *RESP {
+		stream, ok := db.XADDs[key]
+		if !ok || stream.Groups[query.group] == nil {
+			return ErrResp("NOGROUP the consumer group this client was blocked on no longer exists")
+		}
+		return s.readGroup(db, query)
+	}
+	s.blockOn(client)
+	s.SETsMu.Unlock()
+
+	resp = s.waitForKeys(client, timeout, conn)
+	if resp == nil {
+		return NullResp()
+	}
+	return resp
+}
+
+func (s *Server) xack(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 {
+		return ErrResp("ERR wrong number of arguments for 'xack' command")
+	}
+
+	ids, errResp := parseStreamIDs(args[2:])
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil || stream.Groups[args[1].Value] == nil {
+		return Integer(0)
+	}
+
+	group := stream.Groups[args[1].Value]
+	acked := 0
+	for _, id := range ids {
+		if nack, ok := group.PEL[id]; ok {
+			delete(group.PEL, id)
+			delete(nack.Consumer.PEL, id)
+			acked++
+		}
+	}
+	s.Dirty.Add(int64(acked))
+	return Integer(acked)
+}
+
+func (s *Server) xpending(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'xpending' command")
+	}
+
+	key, groupName := args[0].Value, args[1].Value
+	extended := len(args) > 2
+	var minIdle int64
+	var start, end StreamID
+	var count int
+	var consumerName string
+	if extended {
+		opts := args[2:]
+		if strings.ToUpper(opts[0].Value) == "IDLE" && len(opts) > 1 {
+			idle, err := strconv.ParseInt(opts[1].Value, 10, 64)
+			if err != nil {
+				return ErrResp("ERR value is not an integer or out of range")
+			}
+			minIdle = idle
+			opts = opts[2:]
+		}
+		if len(opts) != 3 && len(opts) != 4 {
+			return ErrResp("ERR syntax error")
+		}
+		var errResp *RESP
+		if start, errResp = parseRangeID(opts[0].Value, 0, true); errResp != nil {
+			return errResp
+		}
+		if end, errResp = parseRangeID(opts[1].Value, math.MaxUint64, false); errResp != nil {
+			return errResp
+		}
+		if count, errResp = parseInt(opts[2].Value); errResp != nil {
+			return errResp
+		}
+		count = max(count, 0)
+		if len(opts) == 4 {
+			consumerName = opts[3].Value
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil || stream.Groups[groupName] == nil {
+		return noGroupResp(key, groupName)
+	}
+	group := stream.Groups[groupName]
+
+	if !extended {
+		if len(group.PEL) == 0 {
+			return &RESP{Type: ARRAY, Values: []*RESP{Integer(0), NullResp(), NullResp(), NullResp()}}
+		}
+		ids := sortedIDs(group.PEL)
+		consumers := []*RESP{}
+		names := make([]string, 0, len(group.Consumers))
+		for name, consumer := range group.Consumers {
+			if len(consumer.PEL) > 0 {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			consumers = append(consumers, ToResp(name, strconv.Itoa(len(group.Consumers[name].PEL))))
+		}
+		return &RESP{Type: ARRAY, Values: []*RESP{
+			Integer(len(ids)),
+			BulkString(ids[0].String()),
+			BulkString(ids[len(ids)-1].String()),
+			{Type: ARRAY, Values: consumers},
+		}}
+	}
+
+	pel := group.PEL
+	if consumerName != "" {
+		consumer, ok := group.Consumers[consumerName]
+		if !ok {
+			return ToResp()
+		}
+		pel = consumer.PEL
+	}
+	now := time.Now().UnixMilli()
+	values := []*RESP{}
+	for _, id := range sortedIDs(pel) {
+		if len(values) >= count {
+			break
+		}
+		if id.Compare(start) < 0 || id.Compare(end) > 0 {
+			continue
+		}
+		nack := pel[id]
+		idle := max(now-nack.DeliveryTime, 0)
+		if idle < minIdle {
+			continue
+		}
+		values = append(values, &RESP{Type: ARRAY, Values: []*RESP{
+			BulkString(id.String()),
+			BulkString(nack.Consumer.Name),
+			Integer(idle),
+			Integer(nack.DeliveryCount),
+		}})
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+func (s *Server) xclaim(db *Database, args []*RESP) *RESP {
+	if len(args) < 5 {
+		return ErrResp("ERR wrong number of arguments for 'xclaim' command")
+	}
+
+	key, groupName, consumerName := args[0].Value, args[1].Value, args[2].Value
+	minIdle, err := strconv.ParseInt(args[3].Value, 10, 64)
+	if err != nil {
+		return ErrResp("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	minIdle = max(minIdle, 0)
+
+	// IDs are read until the first argument that isn't one
+	ids := []StreamID{}
+	i := 4
+	for ; i < len(args); i++ {
+		id, errResp := parseStreamID(args[i].Value, 0, true)
+		if errResp != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	claim := &streamClaim{deliveryTime: -1, retryCount: -1}
+	var lastID *StreamID
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Value)
+		hasValue := i+1 < len(args)
+		switch {
+		case opt == "FORCE":
+			claim.force = true
+		case opt == "JUSTID":
+			claim.justID = true
+		case opt == "IDLE" && hasValue:
+			idle, err := strconv.ParseInt(args[i+1].Value, 10, 64)
+			if err != nil {
+				return ErrResp("ERR Invalid IDLE option argument for XCLAIM")
+			}
+			claim.deliveryTime = time.Now().UnixMilli() - idle
+			i++
+		case opt == "TIME" && hasValue:
+			t, err := strconv.ParseInt(args[i+1].Value, 10, 64)
+			if err != nil {
+				return ErrResp("ERR Invalid TIME option argument for XCLAIM")
+			}
+			claim.deliveryTime = t
+			i++
+		case opt == "RETRYCOUNT" && hasValue:
+			retryCount, err := strconv.ParseInt(args[i+1].Value, 10, 64)
+			if err != nil {
+				return ErrResp("ERR Invalid RETRYCOUNT option argument for XCLAIM")
+			}
+			claim.retryCount = retryCount
+			i++
+		case opt == "LASTID" && hasValue:
+			id, errResp := parseStreamID(args[i+1].Value, 0, true)
+			if errResp != nil {
+				return errResp
+			}
+			lastID = &id
+			i++
+		default:
+			return ErrResp(fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", args[i].Value))
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil || stream.Groups[groupName] == nil {
+		return noGroupResp(key, groupName)
+	}
+	group := stream.Groups[groupName]
+	if lastID != nil && lastID.Compare(group.LastID) > 0 {
+		group.LastID = *lastID
+		s.propagateCommand(db, ToResp("XGROUP", "SETID", key, groupName, lastID.String()))
+		s.Dirty.Add(1)
+	}
+
+	now := time.Now().UnixMilli()
+	if claim.deliveryTime < 0 || claim.deliveryTime > now {
+		claim.deliveryTime = now
+	}
+	claim.consumer = group.consumer(consumerName, now)
+	claim.consumer.SeenTime = now
+
+	values := []*RESP{}
+	for _, id := range ids {
+		nack, pending := group.PEL[id]
+		entry, exists := stream.lookup(id)
+		if !exists {
+			// Entries deleted from the stream can't be claimed anymore
+			if pending {
+				s.propagateClaim(db, key, groupName, id, nack, group.LastID)
+				delete(group.PEL, id)
+				delete(nack.Consumer.PEL, id)
+			}
+			continue
+		}
+		if !pending {
+			if !claim.force {
+				continue
+			}
+			nack = &StreamNACK{DeliveryTime: now, DeliveryCount: 1}
+			group.PEL[id] = nack
+		}
+		if nack.Consumer != nil && now-nack.DeliveryTime < minIdle {
+			continue
+		}
+
+		claim.claim(group, id, nack)
+		s.propagateClaim(db, key, groupName, id, nack, group.LastID)
+		if claim.justID {
+			values = append(values, BulkString(id.String()))
+		} else {
+			values = append(values, entryResp(id, entry))
+		}
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+func (s *Server) xautoclaim(db *Database, args []*RESP) *RESP {
+	if len(args) < 5 {
+		return ErrResp("ERR wrong number of arguments for 'xautoclaim' command")
+	}
+
+	key, groupName, consumerName := args[0].Value, args[1].Value, args[2].Value
+	minIdle, err := strconv.ParseInt(args[3].Value, 10, 64)
+	if err != nil {
+		return ErrResp("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	minIdle = max(minIdle, 0)
+	start, errResp := parseRangeID(args[4].Value, 0, true)
+	if errResp != nil {
+		return errResp
+	}
+
+	count := 100
+	claim := &streamClaim{retryCount: -1}
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			n, err := strconv.Atoi(args[i+1].Value)
+			if err != nil {
+				return ErrResp("ERR value is not an integer or out of range")
+			}
+			if n < 1 || n > math.MaxInt64/streamClaimAttempts {
+				return ErrResp("ERR COUNT must be > 0")
+			}
+			count = n
+			i++
+		case "JUSTID":
+			claim.justID = true
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil || stream.Groups[groupName] == nil {
+		return noGroupResp(key, groupName)
+	}
+	group := stream.Groups[groupName]
+
+	now := time.Now().UnixMilli()
+	claim.deliveryTime = now
+	claim.consumer = group.consumer(consumerName, now)
+	claim.consumer.SeenTime = now
+
+	// Scans at most a few entries per claim so stale groups stay fast
+	attempts := count * streamClaimAttempts
+	ids := sortedIDs(group.PEL)
+	i := slices.IndexFunc(ids, func(id StreamID) bool { return id.Compare(start) >= 0 })
+	if i == -1 {
+		i = len(ids)
+	}
+	claimed, deleted := []*RESP{}, []string{}
+	for ; i < len(ids) && attempts > 0 && count > 0; i++ {
+		attempts--
+		id := ids[i]
+		nack := group.PEL[id]
+		entry, exists := stream.lookup(id)
+		if !exists {
+			s.propagateClaim(db, key, groupName, id, nack, group.LastID)
+			delete(group.PEL, id)
+			delete(nack.Consumer.PEL, id)
+			deleted = append(deleted, id.String())
+			count--
+			continue
+		}
+		if now-nack.DeliveryTime < minIdle {
+			continue
+		}
+
+		claim.claim(group, id, nack)
+		s.propagateClaim(db, key, groupName, id, nack, group.LastID)
+		if claim.justID {
+			claimed = append(claimed, BulkString(id.String()))
+		} else {
+			claimed = append(claimed, entryResp(id, entry))
+		}
+		count--
+	}
+
+	// The next call continues from the first entry not scanned
+	cursor := StreamID{}
+	if i < len(ids) {
+		cursor = ids[i]
+	}
+	return &RESP{Type: ARRAY, Values: []*RESP{
+		BulkString(cursor.String()),
+		{Type: ARRAY, Values: claimed},
+		ToResp(deleted...),
+	}}
+}
+
+func (s *Server) xinfo(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'xinfo' command")
+	}
+
+	sub := strings.ToUpper(args[0].Value)
+	switch sub {
+	case "STREAM":
+		if len(args) < 2 {
+			return ErrResp("ERR wrong number of arguments for 'xinfo|stream' command")
+		}
+	case "GROUPS":
+		if len(args) != 2 {
+			return ErrResp("ERR wrong number of arguments for 'xinfo|groups' command")
+		}
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return ErrResp("ERR wrong number of arguments for 'xinfo|consumers' command")
+		}
+	default:
+		return ErrResp(fmt.Sprintf("ERR unknown subcommand '%s'. Try XINFO HELP.", args[0].Value))
+	}
+
+	full, count := false, streamInfoCount
+	if sub == "STREAM" && len(args) > 2 {
+		if strings.ToUpper(args[2].Value) != "FULL" {
+			return ErrResp("ERR syntax error")
+		}
+		full = true
+		if len(args) > 3 {
+			if len(args) != 5 || strings.ToUpper(args[3].Value) != "COUNT" {
+				return ErrResp("ERR syntax error")
+			}
+			var errResp *RESP
+			if count, errResp = parseInt(args[4].Value); errResp != nil {
+				return errResp
+			}
+			count = max(count, 0)
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[1].Value
+	stream, errResp := db.getStream(key)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil {
+		return ErrResp("ERR no such key")
+	}
+
+	now := time.Now().UnixMilli()
+	switch sub {
+	case "STREAM":
+		return stream.info(full, count, now)
+	case "GROUPS":
+		groups := []*RESP{}
+		for _, name := range sortedGroups(stream) {
+			group := stream.Groups[name]
+			groups = append(groups, &RESP{Type: ARRAY, Values: []*RESP{
+				BulkString("name"), BulkString(name),
+				BulkString("consumers"), Integer(len(group.Consumers)),
+				BulkString("pending"), Integer(len(group.PEL)),
+				BulkString("last-delivered-id"), BulkString(group.LastID.String()),
+				BulkString("entries-read"), entriesReadResp(group.EntriesRead),
+				BulkString("lag"), lagResp(group, stream),
+			}})
+		}
+		return &RESP{Type: ARRAY, Values: groups}
+	default:
+		group, ok := stream.Groups[args[2].Value]
+		if !ok {
+			return ErrResp(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", args[2].Value, key))
+		}
+		consumers := []*RESP{}
+		for _, name := range sortedConsumers(group) {
+			consumer := group.Consumers[name]
+			inactive := int64(-1)
+			if consumer.ActiveTime != -1 {
+				inactive = max(now-consumer.ActiveTime, 0)
+			}
+			consumers = append(consumers, &RESP{Type: ARRAY, Values: []*RESP{
+				BulkString("name"), BulkString(name),
+				BulkString("pending"), Integer(len(consumer.PEL)),
+				BulkString("idle"), Integer(max(now-consumer.SeenTime, 0)),
+				BulkString("inactive"), Integer(inactive),
+			}})
+		}
+		return &RESP{Type: ARRAY, Values: consumers}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+// Stream helpers -------------------------------------------------------------
+const (
+	// Pending entries XAUTOCLAIM may scan for each entry it can claim
+	streamClaimAttempts = 10
+	// Entries read by a group whose position in the stream isn't known
+	streamEntriesReadInvalid = -1
+	// Entries and pending entries listed by XINFO STREAM FULL by default
+	streamInfoCount = 10
+	// Entries and bytes of a node before entries are added to a new one
+	streamNodeMaxEntries = 100
+	streamNodeMaxBytes   = 4096
+	// Nodes an approximate trim may remove by default
+	streamTrimLimit = 100
+)
+
+var maxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+
+type xreadgroupQuery struct {
+	group    string
+	consumer string
+	count    int
+	noack    bool
+	keys     []string
+	ids      []string
+}
+
+// Options of XCLAIM and XAUTOCLAIM
+type streamClaim struct {
+	consumer     *StreamConsumer
+	deliveryTime int64
+	retryCount   int64
+	force        bool
+	justID       bool
+}
+
+// Trimming options of XADD and XTRIM. A limit of 0 removes any number of
+// entries.
+type streamTrim struct {
+	minID  bool
+	maxLen int
+	id     StreamID
+	approx bool
+	limit  int
+}
+
+// streamRecord is an entry of a stream along with its ID
+type streamRecord struct {
+	id     StreamID
+	fields []string
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Time, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// key returns the ID as 16 big-endian bytes, which sort like the IDs
+func (id StreamID) key() string {
+	var key [16]byte
+	binary.BigEndian.PutUint64(key[:8], id.Time)
+	binary.BigEndian.PutUint64(key[8:], id.Seq)
+	return string(key[:])
+}
+
+func streamIDFromKey(key string) StreamID {
+	return StreamID{
+		Time: binary.BigEndian.Uint64([]byte(key[:8])),
+		Seq:  binary.BigEndian.Uint64([]byte(key[8:])),
+	}
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	if c := cmp.Compare(id.Time, other.Time); c != 0 {
+		return c
+	}
+	return cmp.Compare(id.Seq, other.Seq)
+}
+
+// next returns the smallest ID greater than id, false if id is the largest
+func (id StreamID) next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Time, id.Seq + 1}, true
+	case id.Time < math.MaxUint64:
+		return StreamID{id.Time + 1, 0}, true
+	}
+	return id, false
+}
+
+// prev returns the largest ID smaller than id, false if id is 0-0
+func (id StreamID) prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Time, id.Seq - 1}, true
+	case id.Time > 0:
+		return StreamID{id.Time - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// parseStreamID parses an ID given as <ms>-<seq>, or <ms> in which case the
+// sequence is missingSeq. Unless strict, "-" and "+" are the smallest and
+// largest IDs.
+func parseStreamID(value string, missingSeq uint64, strict bool) (StreamID, *RESP) {
+	errResp := ErrResp("ERR Invalid stream ID specified as stream command argument")
+	if !strict && value == "-" {
+		return StreamID{}, nil
+	}
+	if !strict && value == "+" {
+		return maxStreamID, nil
+	}
+	ms, seq, found := strings.Cut(value, "-")
+	id := StreamID{Seq: missingSeq}
+	var err error
+	if id.Time, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return StreamID{}, errResp
+	}
+	if found {
+		if id.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return StreamID{}, errResp
+		}
+	}
+	return id, nil
+}
+
+// parseStreamIDs parses a list of strict IDs
+func parseStreamIDs(args []*RESP) ([]StreamID, *RESP) {
+	ids := make([]StreamID, len(args))
+	for i, arg := range args {
+		id, errResp := parseStreamID(arg.Value, 0, true)
+		if errResp != nil {
+			return nil, errResp
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// parseRangeID parses the start or end of an interval of IDs, where a leading
+// "(" excludes the ID itself
+func parseRangeID(value string, missingSeq uint64, start bool) (StreamID, *RESP) {
+	exclusive, found := strings.CutPrefix(value, "(")
+	if !found {
+		return parseStreamID(value, missingSeq, false)
+	}
+	id, errResp := parseStreamID(exclusive, missingSeq, true)
+	if errResp != nil {
+		return id, errResp
+	}
+	ok := false
+	if start {
+		if id, ok = id.next(); !ok {
+			return id, ErrResp("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = id.prev(); !ok {
+		return id, ErrResp("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// readStreams replies to XREAD with up to count entries after the start of
+// each stream, or returns nil if no stream has any. Keys that no longer hold
+// a stream are skipped. Caller must hold SETsMu.
+func (s *Server) readStreams(db *Database, keys []string, starts []StreamID, count int) *RESP {
+	values := []*RESP{}
+	for i, key := range keys {
+		stream, ok := db.XADDs[key]
+		if !ok {
+			continue
+		}
+		// Only entries after the given ID are read
+		start, ok := starts[i].next()
+		if !ok {
+			continue
+		}
+		entries := []*RESP{}
+		for _, record := range stream.rangeEntries(start, maxStreamID, count, false) {
+			entries = append(entries, entryResp(record.id, record.fields))
+		}
+		if len(entries) > 0 {
+			values = append(values, &RESP{Type: ARRAY, Values: []*RESP{BulkString(key), {Type: ARRAY, Values: entries}}})
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+// rangeStream replies to XRANGE and XREVRANGE, which take the end of the
+// range first
+func (s *Server) rangeStream(db *Database, args []*RESP, cmd string, rev bool) *RESP {
+	if len(args) < 3 {
+		return ErrResp(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd))
+	}
+
+	startArg, endArg := args[1].Value, args[2].Value
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, errResp := parseRangeID(startArg, 0, true)
+	if errResp != nil {
+		return errResp
+	}
+	end, errResp := parseRangeID(endArg, math.MaxUint64, false)
+	if errResp != nil {
+		return errResp
+	}
+
+	count := 0
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(args[3].Value) != "COUNT" {
+			return ErrResp("ERR syntax error")
+		}
+		n, errResp := parseInt(args[4].Value)
+		if errResp != nil {
+			return errResp
+		}
+		if n <= 0 {
+			return ToResp()
+		}
+		count = n
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	stream, errResp := db.getStream(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if stream == nil || start.Compare(end) > 0 {
+		return ToResp()
+	}
+
+	values := []*RESP{}
+	for _, record := range stream.rangeEntries(start, end, count, rev) {
+		values = append(values, entryResp(record.id, record.fields))
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+// parseStreamTrim parses MAXLEN|MINID [=|~] threshold [LIMIT count] and
+// returns the number of arguments read
+func parseStreamTrim(args []*RESP) (*streamTrim, int, *RESP) {
+	trim := &streamTrim{minID: strings.ToUpper(args[0].Value) == "MINID"}
+	i := 1
+	if i < len(args) && (args[i].Value == "=" || args[i].Value == "~") {
+		trim.approx = args[i].Value == "~"
+		i++
+	}
+	if i >= len(args) {
+		return nil, 0, ErrResp("ERR syntax error")
+	}
+	if trim.minID {
+		id, errResp := parseStreamID(args[i].Value, 0, true)
+		if errResp != nil {
+			return nil, 0, errResp
+		}
+		trim.id = id
+	} else {
+		maxLen, errResp := parseInt(args[i].Value)
+		if errResp != nil {
+			return nil, 0, errResp
+		}
+		if maxLen < 0 {
+			return nil, 0, ErrResp("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = maxLen
+	}
+	i++
+
+	if trim.approx {
+		trim.limit = streamTrimLimit * streamNodeMaxEntries
+	}
+	if i+1 < len(args) && strings.ToUpper(args[i].Value) == "LIMIT" {
+		limit, errResp := parseInt(args[i+1].Value)
+		if errResp != nil {
+			return nil, 0, errResp
+		}
+		if limit < 0 {
+			return nil, 0, ErrResp("ERR The LIMIT argument must be >= 0.")
+		}
+		if !trim.approx {
+			return nil, 0, ErrResp("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		trim.limit = limit
+		i += 2
+	}
+	return trim, i, nil
+}
+
+// trim removes the oldest entries of the stream as asked and returns how
+// many were removed. Whole nodes are removed first, then approximate trims
+// stop while exact ones mark the remaining entries deleted, so approximate
+// trims may keep more entries than asked.
+func (stream *Stream) trim(trim *streamTrim) int {
+	removed := 0
+	for stream.Length > 0 {
+		it := stream.Nodes.Iter()
+		it.Next()
+		master, node := streamIDFromKey(it.Key()), it.Value().([]byte)
+		count, _, entries := decodeStreamNode(master, node)
+		if trim.limit > 0 && removed+count > trim.limit {
+			break
+		}
+
+		var removeNode bool
+		if trim.minID {
+			removeNode = entries[len(entries)-1].id.Compare(trim.id) < 0
+		} else {
+			removeNode = stream.Length-count >= trim.maxLen
+		}
+		if removeNode {
+			stream.Nodes.Delete(master.key())
+			stream.Length -= count
+			removed += count
+			continue
+		}
+		if trim.approx {
+			break
+		}
+
+		deleted := []streamNodeEntry{}
+		for _, entry := range entries {
+			if entry.flags&streamItemDeleted != 0 {
+				continue
+			}
+			if trim.minID && entry.id.Compare(trim.id) >= 0 || !trim.minID && stream.Length-len(deleted) <= trim.maxLen {
+				break
+			}
+			deleted = append(deleted, entry)
+		}
+		stream.deleteNodeEntries(master, node, deleted)
+		stream.Length -= len(deleted)
+		removed += len(deleted)
+		break
+	}
+	return removed
+}
+
+// info replies to XINFO STREAM. The full form lists up to count entries, and
+// pending entries of each group and consumer, or all of them if count is 0.
+func (stream *Stream) info(full bool, count int, now int64) *RESP {
+	values := []*RESP{
+		BulkString("length"), Integer(stream.Length),
+		BulkString("radix-tree-keys"), Integer(stream.Nodes.Keys()),
+		BulkString("radix-tree-nodes"), Integer(stream.Nodes.Nodes()),
+		BulkString("last-generated-id"), BulkString(stream.LastID.String()),
+		BulkString("max-deleted-entry-id"), BulkString(stream.MaxDeletedID.String()),
+		BulkString("entries-added"), Integer(stream.EntriesAdded),
+		BulkString("recorded-first-entry-id"), BulkString(stream.firstID().String()),
+	}
+
+	if !full {
+		first, last := NullResp(), NullResp()
+		if records := stream.rangeEntries(StreamID{}, maxStreamID, 1, false); len(records) > 0 {
+			first = entryResp(records[0].id, records[0].fields)
+		}
+		if records := stream.rangeEntries(StreamID{}, maxStreamID, 1, true); len(records) > 0 {
+			last = entryResp(records[0].id, records[0].fields)
+		}
+		return &RESP{Type: ARRAY, Values: append(values,
+			BulkString("groups"), Integer(len(stream.Groups)),
+			BulkString("first-entry"), first,
+			BulkString("last-entry"), last,
+		)}
+	}
+
+	entries := []*RESP{}
+	for _, record := range stream.rangeEntries(StreamID{}, maxStreamID, count, false) {
+		entries = append(entries, entryResp(record.id, record.fields))
+	}
+
+	groups := []*RESP{}
+	for _, name := range sortedGroups(stream) {
+		group := stream.Groups[name]
+		pending := []*RESP{}
+		for _, id := range limitIDs(sortedIDs(group.PEL), count) {
+			nack := group.PEL[id]
+			pending = append(pending, &RESP{Type: ARRAY, Values: []*RESP{
+				BulkString(id.String()),
+				BulkString(nack.Consumer.Name),
+				Integer(nack.DeliveryTime),
+				Integer(nack.DeliveryCount),
+			}})
+		}
+
+		consumers := []*RESP{}
+		for _, consumerName := range sortedConsumers(group) {
+			consumer := group.Consumers[consumerName]
+			consumerPending := []*RESP{}
+			for _, id := range limitIDs(sortedIDs(consumer.PEL), count) {
+				nack := consumer.PEL[id]
+				consumerPending = append(consumerPending, &RESP{Type: ARRAY, Values: []*RESP{
+					BulkString(id.String()),
+					Integer(nack.DeliveryTime),
+					Integer(nack.DeliveryCount),
+				}})
+			}
+			consumers = append(consumers, &RESP{Type: ARRAY, Values: []*RESP{
+				BulkString("name"), BulkString(consumerName),
+				BulkString("seen-time"), Integer(consumer.SeenTime),
+				BulkString("active-time"), Integer(consumer.ActiveTime),
+				BulkString("pel-count"), Integer(len(consumer.PEL)),
+				BulkString("pending"), {Type: ARRAY, Values: consumerPending},
+			}})
+		}
+
+		groups = append(groups, &RESP{Type: ARRAY, Values: []*RESP{
+			BulkString("name"), BulkString(name),
+			BulkString("last-delivered-id"), BulkString(group.LastID.String()),
+			BulkString("entries-read"), entriesReadResp(group.EntriesRead),
+			BulkString("lag"), lagResp(group, stream),
+			BulkString("pel-count"), Integer(len(group.PEL)),
+			BulkString("pending"), {Type: ARRAY, Values: pending},
+			BulkString("consumers"), {Type: ARRAY, Values: consumers},
+		}})
+	}
+
+	return &RESP{Type: ARRAY, Values: append(values,
+		BulkString("entries"), &RESP{Type: ARRAY, Values: entries},
+		BulkString("groups"), &RESP{Type: ARRAY, Values: groups},
+	)}
+}
+
+// firstID returns the ID of the first entry, 0-0 if the stream is empty
+func (stream *Stream) firstID() StreamID {
+	records := stream.rangeEntries(StreamID{}, maxStreamID, 1, false)
+	if len(records) == 0 {
+		return StreamID{}
+	}
+	return records[0].id
+}
+
+// hasTombstones reports whether entries from start to end may have been
+// deleted with XDEL
+func (stream *Stream) hasTombstones(start, end StreamID) bool {
+	if stream.Length == 0 || stream.MaxDeletedID == (StreamID{}) {
+		return false
+	}
+	if stream.firstID().Compare(stream.MaxDeletedID) > 0 {
+		return false
+	}
+	return start.Compare(stream.MaxDeletedID) <= 0 && end.Compare(stream.MaxDeletedID) >= 0
+}
+
+// entriesBefore estimates how many entries were ever added to the stream up
+// to id, or returns -1 if deleted entries make it unknown
+func (stream *Stream) entriesBefore(id StreamID) int64 {
+	if stream.EntriesAdded == 0 {
+		return 0
+	}
+	cmpLast := id.Compare(stream.LastID)
+	if stream.Length == 0 && cmpLast <= 0 || cmpLast == 0 {
+		return stream.EntriesAdded
+	}
+	if cmpLast > 0 {
+		return streamEntriesReadInvalid
+	}
+
+	firstID := stream.firstID()
+	if stream.MaxDeletedID == (StreamID{}) || stream.MaxDeletedID.Compare(firstID) < 0 {
+		switch id.Compare(firstID) {
+		case -1:
+			return stream.EntriesAdded - int64(stream.Length)
+		case 0:
+			return stream.EntriesAdded - int64(stream.Length) + 1
+		}
+	}
+	return streamEntriesReadInvalid
+}
+
+// delete removes an entry from the stream. Pending entries of groups are kept
+// until they are acknowledged or claimed.
+func (stream *Stream) delete(id StreamID) bool {
+	it := stream.Nodes.SeekReverse(id.key())
+	if !it.Next() {
+		return false
+	}
+	master, node := streamIDFromKey(it.Key()), it.Value().([]byte)
+	_, _, entries := decodeStreamNode(master, node)
+	i := slices.IndexFunc(entries, func(entry streamNodeEntry) bool {
+		return entry.id == id && entry.flags&streamItemDeleted == 0
+	})
+	if i < 0 {
+		return false
+	}
+	stream.deleteNodeEntries(master, node, entries[i:i+1])
+	stream.Length--
+	if id.Compare(stream.MaxDeletedID) > 0 {
+		stream.MaxDeletedID = id
+	}
+	return true
+}
+
+// nextID returns the ID of an entry added with an XADD ID, "*" to generate
+// it from the current time, "<ms>-*" to generate the sequence, or an explicit
+// ID greater than the last one.
+func (stream *Stream) nextID(value string) (StreamID, *RESP) {
+	last := stream.LastID
+	if value == "*" {
+		if last == maxStreamID {
+			return StreamID{}, ErrResp("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		id := StreamID{Time: uint64(time.Now().UnixMilli())}
+		if id.Time <= last.Time {
+			id, _ = last.next()
+		}
+		return id, nil
+	}
+
+	var id StreamID
+	if ms, found := strings.CutSuffix(value, "-*"); found {
+		t, err := strconv.ParseUint(ms, 10, 64)
+		if err != nil {
+			return StreamID{}, ErrResp("ERR Invalid stream ID specified as stream command argument")
+		}
+		id.Time = t
+		if t == last.Time && last.Seq < math.MaxUint64 {
+			id.Seq = last.Seq + 1
+		} else if t == last.Time {
+			return StreamID{}, ErrResp("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	} else {
+		var errResp *RESP
+		if id, errResp = parseStreamID(value, 0, true); errResp != nil {
+			return StreamID{}, errResp
+		}
+	}
+
+	if id == (StreamID{}) {
+		return StreamID{}, ErrResp("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if id.Compare(last) <= 0 {
+		return StreamID{}, ErrResp("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	return id, nil
+}
+
+// lookup returns the fields of the entry with the given ID
+func (stream *Stream) lookup(id StreamID) ([]string, bool) {
+	records := stream.rangeEntries(id, id, 1, false)
+	if len(records) == 0 {
+		return nil, false
+	}
+	return records[0].fields, true
+}
+
+// rangeEntries returns up to count entries with IDs from start to end, or all
+// of them if count is 0, from the last one if rev
+func (stream *Stream) rangeEntries(start, end StreamID, count int, rev bool) []streamRecord {
+	records := []streamRecord{}
+	if start.Compare(end) > 0 {
+		return records
+	}
+
+	var it *radix.Iterator
+	if rev {
+		it = stream.Nodes.SeekReverse(end.key())
+	} else {
+		// The node holding start is keyed by an earlier ID
+		first := start.key()
+		if it = stream.Nodes.SeekReverse(first); it.Next() {
+			first = it.Key()
+		}
+		it = stream.Nodes.Seek(first)
+	}
+	for it.Next() {
+		_, _, entries := decodeStreamNode(streamIDFromKey(it.Key()), it.Value().([]byte))
+		if rev {
+			slices.Reverse(entries)
+		}
+		for _, entry := range entries {
+			if entry.flags&streamItemDeleted != 0 {
+				continue
+			}
+			if !rev && entry.id.Compare(start) < 0 || rev && entry.id.Compare(end) > 0 {
+				continue
+			}
+			if !rev && entry.id.Compare(end) > 0 || rev && entry.id.Compare(start) < 0 {
+				return records
+			}
+			records = append(records, streamRecord{entry.id, entry.fields})
+			if count > 0 && len(records) == count {
+				return records
+			}
+		}
+	}
+	return records
+}
+
+// Clone returns a copy of the stream and its groups
+func (stream *Stream) Clone() *Stream {
+	clone := &Stream{
+		Nodes:        radix.NewRadix(),
+		Length:       stream.Length,
+		LastID:       stream.LastID,
+		MaxDeletedID: stream.MaxDeletedID,
+		EntriesAdded: stream.EntriesAdded,
+		Groups:       map[string]*StreamGroup{},
+	}
+	stream.Nodes.Walk(func(master string, node any) {
+		clone.Nodes.Insert(master, bytes.Clone(node.([]byte)))
+	})
+	for name, group := range stream.Groups {
+		groupClone := NewStreamGroup(group.LastID, group.EntriesRead)
+		for name, consumer := range group.Consumers {
+			groupClone.Consumers[name] = &StreamConsumer{
+				Name:       name,
+				SeenTime:   consumer.SeenTime,
+				ActiveTime: consumer.ActiveTime,
+				PEL:        map[StreamID]*StreamNACK{},
+			}
+		}
+		for id, nack := range group.PEL {
+			consumer := groupClone.Consumers[nack.Consumer.Name]
+			nackClone := &StreamNACK{consumer, nack.DeliveryTime, nack.DeliveryCount}
+			groupClone.PEL[id] = nackClone
+			consumer.PEL[id] = nackClone
+		}
+		clone.Groups[name] = groupClone
+	}
+	return clone
+}
+
+// consumer returns the consumer of the group with the given name, creating it
+// if needed.
+func (group *StreamGroup) consumer(name string, now int64) *StreamConsumer {
+	consumer, ok := group.Consumers[name]
+	if !ok {
+		consumer = &StreamConsumer{Name: name, SeenTime: now, ActiveTime: -1, PEL: map[StreamID]*StreamNACK{}}
+		group.Consumers[name] = consumer
+	}
+	return consumer
+}
+
+// advance moves the last delivered ID of the group to an entry after it,
+// counting the entries read while no deleted entries are ahead
+func (group *StreamGroup) advance(stream *Stream, id StreamID) {
+	if group.EntriesRead != streamEntriesReadInvalid && !stream.hasTombstones(id, maxStreamID) {
+		group.EntriesRead++
+	} else if stream.EntriesAdded > 0 {
+		group.EntriesRead = stream.entriesBefore(id)
+	}
+	group.LastID = id
+}
+
+// lag returns the number of entries the group has yet to read, false if it
+// can't be known because entries ahead of it were deleted
+func (group *StreamGroup) lag(stream *Stream) (int64, bool) {
+	if stream.EntriesAdded == 0 {
+		return 0, true
+	}
+	if group.EntriesRead != streamEntriesReadInvalid && !stream.hasTombstones(group.LastID, maxStreamID) {
+		return stream.EntriesAdded - group.EntriesRead, true
+	}
+	entriesRead := stream.entriesBefore(group.LastID)
+	if entriesRead == streamEntriesReadInvalid {
+		return 0, false
+	}
+	return stream.EntriesAdded - entriesRead, true
+}
+
+// claim moves a pending entry to the consumer of the claim
+func (claim *streamClaim) claim(group *StreamGroup, id StreamID, nack *StreamNACK) {
+	if nack.Consumer != nil && nack.Consumer != claim.consumer {
+		delete(nack.Consumer.PEL, id)
+	}
+	nack.DeliveryTime = claim.deliveryTime
+	if claim.retryCount >= 0 {
+		nack.DeliveryCount = claim.retryCount
+	} else if !claim.justID {
+		nack.DeliveryCount++
+	}
+	nack.Consumer = claim.consumer
+	claim.consumer.PEL[id] = nack
+	claim.consumer.ActiveTime = nack.DeliveryTime
+}
+
+// readGroup reads the streams of an XREADGROUP query. New entries are added
+// to the pending entries of the consumer, while history reads deliver its
+// pending entries again. Returns nil if there is nothing to read, or a
+// NOGROUP error if any of the streams or its group is gone, e.g. deleted
+// while the client was blocked on another stream. Caller must hold SETsMu.
+func (s *Server) readGroup(db *Database, query *xreadgroupQuery) *RESP {
+	for _, key := range query.keys {
+		if stream, ok := db.XADDs[key]; !ok || stream.Groups[query.group] == nil {
+			return ErrResp(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, query.group))
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	values := []*RESP{}
+	for i, key := range query.keys {
+		stream := db.XADDs[key]
+		group := stream.Groups[query.group]
+		consumer := group.consumer(query.consumer, now)
+		consumer.SeenTime = now
+
+		entries := []*RESP{}
+		if query.ids[i] == ">" {
+			start, ok := group.LastID.next()
+			if !ok {
+				continue
+			}
+			for _, record := range stream.rangeEntries(start, maxStreamID, query.count, false) {
+				group.advance(stream, record.id)
+				if !query.noack {
+					if nack, ok := group.PEL[record.id]; ok {
+						delete(nack.Consumer.PEL, record.id)
+					}
+					nack := &StreamNACK{consumer, now, 1}
+					group.PEL[record.id] = nack
+					consumer.PEL[record.id] = nack
+				}
+				entries = append(entries, entryResp(record.id, record.fields))
+			}
+			if len(entries) == 0 {
+				continue
+			}
+			consumer.ActiveTime = now
+		} else {
+			start, _ := parseStreamID(query.ids[i], 0, true)
+			for _, id := range sortedIDs(consumer.PEL) {
+				if query.count > 0 && len(entries) >= query.count {
+					break
+				}
+				if id.Compare(start) <= 0 {
+					continue
+				}
+				entry, ok := stream.lookup(id)
+				if !ok {
+					entries = append(entries, &RESP{Type: ARRAY, Values: []*RESP{BulkString(id.String()), NullResp()}})
+					continue
+				}
+				nack := consumer.PEL[id]
+				nack.DeliveryTime = now
+				nack.DeliveryCount++
+				entries = append(entries, entryResp(id, entry))
+			}
+		}
+
+		// Replicas read the same entries without blocking
+		cmd := []string{"XREADGROUP", "GROUP", query.group, query.consumer}
+		if query.count > 0 {
+			cmd = append(cmd, "COUNT", strconv.Itoa(query.count))
+		}
+		if query.noack {
+			cmd = append(cmd, "NOACK")
+		}
+		s.propagateCommand(db, ToResp(append(cmd, "STREAMS", key, query.ids[i])...))
+		s.Dirty.Add(int64(len(entries)))
+
+		values = append(values, &RESP{Type: ARRAY, Values: []*RESP{BulkString(key), {Type: ARRAY, Values: entries}}})
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+// propagateClaim sends replicas the state of a pending entry as an XCLAIM
+// that forces it, or deletes it if the entry is gone from the stream
+func (s *Server) propagateClaim(db *Database, key, group string, id StreamID, nack *StreamNACK, lastID StreamID) {
+	s.Dirty.Add(1)
+	s.propagateCommand(db, ToResp(
+		"XCLAIM", key, group, nack.Consumer.Name, "0", id.String(),
+		"TIME", strconv.FormatInt(nack.DeliveryTime, 10),
+		"RETRYCOUNT", strconv.FormatInt(nack.DeliveryCount, 10),
+		"FORCE", "JUSTID", "LASTID", lastID.String(),
+	))
+}
+
+// getStream returns the stream stored at key, nil if the key does not exist,
+// or a WRONGTYPE error if the key holds another type.
+// Caller must hold SETsMu.
+func (db *Database) getStream(key string) (*Stream, *RESP) {
+	db.expireIfNeeded(key)
+	db.XADDsMu.RLock()
+	stream, ok := db.XADDs[key]
+	db.XADDsMu.RUnlock()
+	if !ok && db.typeOf(key) != "none" {
+		return nil, WrongTypeResp()
+	}
+	return stream, nil
+}
+
+// entryResp returns an entry as its ID followed by its fields and values
+func entryResp(id StreamID, fields []string) *RESP {
+	return &RESP{Type: ARRAY, Values: []*RESP{BulkString(id.String()), ToResp(fields...)}}
+}
+
+// sortedIDs returns the IDs of a pending entries list in order
+func sortedIDs(pel map[StreamID]*StreamNACK) []StreamID {
+	ids := make([]StreamID, 0, len(pel))
+	for id := range pel {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, StreamID.Compare)
+	return ids
+}
+
+// sortedGroups returns the names of the groups of a stream in order
+func sortedGroups(stream *Stream) []string {
+	names := make([]string, 0, len(stream.Groups))
+	for name := range stream.Groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// sortedConsumers returns the names of the consumers of a group in order
+func sortedConsumers(group *StreamGroup) []string {
+	names := make([]string, 0, len(group.Consumers))
+	for name := range group.Consumers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// limitIDs returns the first count IDs, or all of them if count is 0
+func limitIDs(ids []StreamID, count int) []StreamID {
+	if count > 0 && len(ids) > count {
+		return ids[:count]
+	}
+	return ids
+}
+
+func entriesReadResp(entriesRead int64) *RESP {
+	if entriesRead == streamEntriesReadInvalid {
+		return NullResp()
+	}
+	return Integer(entriesRead)
+}
+
+func lagResp(group *StreamGroup, stream *Stream) *RESP {
+	lag, ok := group.lag(stream)
+	if !ok {
+		return NullResp()
+	}
+	return Integer(lag)
+}
+
+func noGroupResp(key, group string) *RESP {
+	return ErrResp(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group))
+}
+
+// ----------------------------------------------------------------------------
+
+// Stream nodes ---------------------------------------------------------------
+// Entries are packed in listpacks of up to streamNodeMaxEntries entries, keyed
+// in the radix tree by the ID of their first entry, the master ID, like the
+// nodes of Redis. A node starts with the counts of its valid and deleted
+// entries and the fields of the master entry, followed by the entries:
+//
+//	<count> <deleted> <num-fields> <field> ... 0
+//	<flags> <ms-diff> <seq-diff> <num-fields> <field> <value> ... <lp-count>
+//
+// IDs are stored as the difference from the master ID, and entries with the
+// same fields as the master entry only store their values.
+
+const (
+	streamItemDeleted    = 1
+	streamItemSameFields = 2
+)
+
+// streamNodeEntry is an entry decoded from a node, along with the index of
+// its flags in the listpack
+type streamNodeEntry struct {
+	id     StreamID
+	fields []string
+	flags  int
+	index  int
+}
+
+// insert appends an entry to the last node, or to a new one if it is full.
+// Caller must add the entry to Length.
+func (stream *Stream) insert(id StreamID, fields []string) {
+	size := 0
+	for _, field := range fields {
+		size += len(field)
+	}
+
+	var master StreamID
+	var node []byte
+	if it := stream.Nodes.ReverseIter(); it.Next() {
+		master, node = streamIDFromKey(it.Key()), it.Value().([]byte)
+		count, deleted := streamNodeInt(node, 0), streamNodeInt(node, 1)
+		if count+deleted >= streamNodeMaxEntries || len(node)+size >= streamNodeMaxBytes {
+			node = nil
+		}
+	}
+	if node == nil {
+		master = id
+		node = listpack.New()
+		node = listpack.AppendInt(node, 0)
+		node = listpack.AppendInt(node, 0)
+		node = listpack.AppendInt(node, int64(len(fields)/2))
+		for i := 0; i < len(fields); i += 2 {
+			node = listpack.Append(node, fields[i])
+		}
+		node = listpack.AppendInt(node, 0)
+	}
+
+	sameFields := streamNodeInt(node, 2) == len(fields)/2
+	for i := 0; sameFields && i < len(fields); i += 2 {
+		field, _ := listpack.Get(node, 3+i/2)
+		sameFields = field == fields[i]
+	}
+
+	if sameFields {
+		node = listpack.AppendInt(node, streamItemSameFields)
+	} else {
+		node = listpack.AppendInt(node, 0)
+	}
+	node = listpack.AppendInt(node, int64(id.Time-master.Time))
+	node = listpack.AppendInt(node, int64(id.Seq-master.Seq))
+	if sameFields {
+		for i := 1; i < len(fields); i += 2 {
+			node = listpack.Append(node, fields[i])
+		}
+		node = listpack.AppendInt(node, int64(len(fields)/2+3))
+	} else {
+		node = listpack.AppendInt(node, int64(len(fields)/2))
+		for _, field := range fields {
+			node = listpack.Append(node, field)
+		}
+		node = listpack.AppendInt(node, int64(len(fields)+4))
+	}
+	node, _ = listpack.Replace(node, 0, strconv.Itoa(streamNodeInt(node, 0)+1))
+	stream.Nodes.Insert(master.key(), node)
+}
+
+// deleteNodeEntries marks entries of a node deleted, removing the node once
+// all of its entries are. Caller must remove the entries from Length.
+func (stream *Stream) deleteNodeEntries(master StreamID, node []byte, entries []streamNodeEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	count, deleted := streamNodeInt(node, 0)-len(entries), streamNodeInt(node, 1)+len(entries)
+	if count == 0 {
+		stream.Nodes.Delete(master.key())
+		return
+	}
+	for _, entry := range entries {
+		node, _ = listpack.Replace(node, entry.index, strconv.Itoa(entry.flags|streamItemDeleted))
+	}
+	node, _ = listpack.Replace(node, 0, strconv.Itoa(count))
+	node, _ = listpack.Replace(node, 1, strconv.Itoa(deleted))
+	stream.Nodes.Insert(master.key(), node)
+}
+
+// decodeStreamNode returns the counts of valid and deleted entries of a node,
+// and all of its entries including the deleted ones
+func decodeStreamNode(master StreamID, node []byte) (int, int, []streamNodeEntry) {
+	values, _ := listpack.Decode(node)
+	count, _ := strconv.Atoi(values[0])
+	deleted, _ := strconv.Atoi(values[1])
+	numFields, _ := strconv.Atoi(values[2])
+	masterFields := values[3 : 3+numFields]
+
+	entries := make([]streamNodeEntry, 0, count+deleted)
+	for i := 4 + numFields; i < len(values); i++ {
+		entry := streamNodeEntry{index: i}
+		entry.flags, _ = strconv.Atoi(values[i])
+		msDiff, _ := strconv.ParseInt(values[i+1], 10, 64)
+		seqDiff, _ := strconv.ParseInt(values[i+2], 10, 64)
+		entry.id = StreamID{master.Time + uint64(msDiff), master.Seq + uint64(seqDiff)}
+		i += 3
+
+		if entry.flags&streamItemSameFields != 0 {
+			entry.fields = make([]string, 0, 2*numFields)
+			for j, field := range masterFields {
+				entry.fields = append(entry.fields, field, values[i+j])
+			}
+			i += numFields
+		} else {
+			n, _ := strconv.Atoi(values[i])
+			entry.fields = values[i+1 : i+1+2*n]
+			i += 1 + 2*n
+		}
+		entries = append(entries, entry)
+	}
+	return count, deleted, entries
+}
+
+// streamNodeInt returns the integer at index of a node's header
+func streamNodeInt(node []byte, index int) int {
+	value, _ := listpack.Get(node, index)
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+// ----------------------------------------------------------------------------
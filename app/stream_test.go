@@ -0,0 +1,579 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamGroups(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	for _, args := range [][]string{
+		{"XADD", "group:s", "1-1", "a", "1"},
+		{"XADD", "group:s", "2-1", "b", "2"},
+		{"XADD", "group:s", "3-1", "c", "3"},
+		{"RPUSH", "group:list", "a"},
+	} {
+		Write(conn.Writer, ToResp(args...))
+		conn.Buffer.Read()
+	}
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"XGROUP", "CREATE", "group:missing", "g", "$"}, ERROR, "ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."},
+		{[]string{"XGROUP", "CREATE", "group:list", "g", "$"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"XGROUP", "CREATE", "group:s", "g", "0"}, STRING, "OK"},
+		{[]string{"XGROUP", "CREATE", "group:s", "g", "0"}, ERROR, "BUSYGROUP Consumer Group name already exists"},
+		{[]string{"XGROUP", "CREATE", "group:s", "g2", "x"}, ERROR, "ERR Invalid stream ID specified as stream command argument"},
+		{[]string{"XGROUP", "CREATE", "group:s"}, ERROR, "ERR wrong number of arguments for 'xgroup|create' command"},
+		{[]string{"XGROUP", "FOO", "group:s"}, ERROR, "ERR unknown subcommand 'FOO'. Try XGROUP HELP."},
+		{[]string{"XGROUP", "CREATE", "group:new", "g", "$", "MKSTREAM"}, STRING, "OK"},
+		{[]string{"TYPE", "group:new"}, STRING, "stream"},
+		{[]string{"XGROUP", "SETID", "group:s", "nope", "0"}, ERROR, "NOGROUP No such consumer group 'nope' for key name 'group:s'"},
+		{[]string{"XGROUP", "CREATECONSUMER", "group:s", "g", "alice"}, INTEGER, "1"},
+		{[]string{"XGROUP", "CREATECONSUMER", "group:s", "g", "alice"}, INTEGER, "0"},
+		{[]string{"XREADGROUP", "COUNT", "1", "STREAMS", "group:s", ">"}, ERROR, "ERR Missing GROUP option for XREADGROUP"},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "group:s"}, ERROR, "ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified."},
+		{[]string{"XREADGROUP", "GROUP", "nope", "alice", "STREAMS", "group:s", ">"}, ERROR, "NOGROUP No such key 'group:s' or consumer group 'nope' in XREADGROUP with GROUP option"},
+		{[]string{"XACK", "group:s", "g", "x"}, ERROR, "ERR Invalid stream ID specified as stream command argument"},
+		{[]string{"XACK", "group:s", "nope", "1-1"}, INTEGER, "0"},
+		{[]string{"XPENDING", "group:s", "nope"}, ERROR, "NOGROUP No such key 'group:s' or consumer group 'nope'"},
+		{[]string{"XCLAIM", "group:s", "g", "bob", "x", "1-1"}, ERROR, "ERR Invalid min-idle-time argument for XCLAIM"},
+		{[]string{"XCLAIM", "group:s", "g", "bob", "0", "1-1", "FOO"}, ERROR, "ERR Unrecognized XCLAIM option 'FOO'"},
+		{[]string{"XAUTOCLAIM", "group:s", "g", "bob", "0", "0", "COUNT", "0"}, ERROR, "ERR COUNT must be > 0"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+
+	// Each reply depends on the ones before it. Replies that aren't arrays are
+	// compared as a single value
+	replies := []struct {
+		args     []string
+		expected []string // nested arrays are flattened, "nil" for a nil reply
+	}{
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "group:s", ">"}, []string{"group:s", "1-1", "a", "1", "2-1", "b", "2"}},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "group:s", ">"}, []string{"group:s", "3-1", "c", "3"}},
+		{[]string{"XPENDING", "group:s", "g"}, []string{"3", "1-1", "3-1", "alice", "2", "bob", "1"}},
+		{[]string{"XPENDING", "group:s", "g", "-", "+", "10", "alice"}, []string{"1-1", "alice", "*", "1", "2-1", "alice", "*", "1"}},
+		{[]string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "group:s", "0"}, []string{"group:s", "1-1", "a", "1", "2-1", "b", "2"}},
+		{[]string{"XPENDING", "group:s", "g", "(1-1", "+", "1"}, []string{"2-1", "alice", "*", "2"}},
+		{[]string{"XACK", "group:s", "g", "1-1", "1-1", "9-9"}, []string{"1"}},
+		{[]string{"XCLAIM", "group:s", "g", "bob", "0", "2-1", "JUSTID"}, []string{"2-1"}},
+		{[]string{"XPENDING", "group:s", "g", "-", "+", "10", "bob"}, []string{"2-1", "bob", "*", "2", "3-1", "bob", "*", "1"}},
+		{[]string{"XCLAIM", "group:s", "g", "carol", "0", "3-1", "RETRYCOUNT", "7"}, []string{"3-1", "c", "3"}},
+		{[]string{"XCLAIM", "group:s", "g", "carol", "3600000", "3-1"}, []string{}},
+		{[]string{"XAUTOCLAIM", "group:s", "g", "alice", "0", "0", "COUNT", "1"}, []string{"3-1", "2-1", "b", "2"}},
+		{[]string{"XAUTOCLAIM", "group:s", "g", "alice", "0", "3-1", "JUSTID"}, []string{"0-0", "3-1"}},
+		{[]string{"XPENDING", "group:s", "g", "-", "+", "10"}, []string{"2-1", "alice", "*", "3", "3-1", "alice", "*", "7"}},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "group:s", "0"}, []string{"group:s"}},
+		{[]string{"XGROUP", "DELCONSUMER", "group:s", "g", "alice"}, []string{"2"}},
+		{[]string{"XPENDING", "group:s", "g"}, []string{"0", "nil", "nil", "nil"}},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "group:s", ">"}, []string{"nil"}},
+		{[]string{"XREADGROUP", "GROUP", "g", "bob", "NOACK", "STREAMS", "group:new", ">"}, []string{"nil"}},
+	}
+	for _, test := range replies {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		values := []*RESP{parsedResp}
+		if parsedResp.Type == ARRAY {
+			values = flattenResp(parsedResp.Values)
+		}
+		if len(values) != len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, values)
+			continue
+		}
+		for i, v := range test.expected {
+			// Idle times depend on timing
+			if v == "*" {
+				continue
+			}
+			if v == "nil" && values[i].Type != 0 || v != "nil" && values[i].Value != v {
+				t.Errorf("%v: expected %s at index %d, got %v", test.args, v, i, values[i])
+			}
+		}
+	}
+}
+
+func TestXreadgroupBlock(t *testing.T) {
+	createMasterServer("6379")
+	reader := connectToServer("6379")
+	defer reader.Conn.Close()
+	other := connectToServer("6379")
+	defer other.Conn.Close()
+	writer := connectToServer("6379")
+	defer writer.Conn.Close()
+
+	Write(writer.Writer, ToResp("XGROUP", "CREATE", "group:block", "g", "$", "MKSTREAM"))
+	writer.Buffer.Read()
+	Write(writer.Writer, ToResp("XGROUP", "CREATE", "group:block", "h", "$"))
+	writer.Buffer.Read()
+
+	start := time.Now()
+	Write(reader.Writer, ToResp("XREADGROUP", "GROUP", "g", "c", "BLOCK", "100", "STREAMS", "group:block", ">"))
+	parsedResp, _, _ := reader.Buffer.Read()
+	if parsedResp.Type != 0 {
+		t.Errorf("Expected nil, got %v", parsedResp)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Errorf("Expected XREADGROUP to block for the timeout")
+	}
+
+	// Readers of different groups all get the new entry
+	Write(reader.Writer, ToResp("XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "group:block", ">"))
+	Write(other.Writer, ToResp("XREADGROUP", "GROUP", "h", "c", "BLOCK", "0", "STREAMS", "group:block", ">"))
+	time.Sleep(50 * time.Millisecond)
+	Write(writer.Writer, ToResp("XADD", "group:block", "5-1", "f", "v"))
+	writer.Buffer.Read()
+
+	for _, conn := range []*ReadWriter{reader, other} {
+		parsedResp, _, _ := conn.Buffer.Read()
+		values := flattenResp([]*RESP{parsedResp})
+		if len(values) != 4 || values[0].Value != "group:block" || values[1].Value != "5-1" {
+			t.Errorf("Expected [group:block [5-1 [f v]]], got %v", parsedResp)
+		}
+	}
+
+	// Destroying the group wakes its readers with an error
+	Write(reader.Writer, ToResp("XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "group:block", ">"))
+	time.Sleep(50 * time.Millisecond)
+	Write(writer.Writer, ToResp("XGROUP", "DESTROY", "group:block", "g"))
+	writer.Buffer.Read()
+	parsedResp, _, _ = reader.Buffer.Read()
+	if parsedResp.Type != ERROR {
+		t.Errorf("Expected a NOGROUP error, got %v", parsedResp)
+	}
+}
+
+func TestXreadgroupBlockDeletedStream(t *testing.T) {
+	createMasterServer("6379")
+	reader := connectToServer("6379")
+	defer reader.Conn.Close()
+	writer := connectToServer("6379")
+	defer writer.Conn.Close()
+
+	for _, key := range []string{"group:first", "group:second"} {
+		Write(writer.Writer, ToResp("XGROUP", "CREATE", key, "g", "$", "MKSTREAM"))
+		writer.Buffer.Read()
+	}
+
+	// A stream deleted while the client is blocked on another one is reported
+	// once the client is woken
+	Write(reader.Writer, ToResp("XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "group:first", "group:second", ">", ">"))
+	time.Sleep(50 * time.Millisecond)
+	Write(writer.Writer, ToResp("DEL", "group:second"))
+	writer.Buffer.Read()
+	Write(writer.Writer, ToResp("XADD", "group:first", "1-1", "f", "v"))
+	writer.Buffer.Read()
+
+	parsedResp, _, _ := reader.Buffer.Read()
+	if parsedResp.Type != ERROR || !strings.HasPrefix(parsedResp.Value, "NOGROUP") {
+		t.Errorf("Expected a NOGROUP error, got %v", parsedResp)
+	}
+	Write(writer.Writer, PingResp())
+	parsedResp, _, _ = writer.Buffer.Read()
+	if !parsedResp.IsPong() {
+		t.Errorf("Expected PONG, got %v", parsedResp)
+	}
+}
+
+func TestXreadBlock(t *testing.T) {
+	createMasterServer("6379")
+	reader := connectToServer("6379")
+	defer reader.Conn.Close()
+	other := connectToServer("6379")
+	defer other.Conn.Close()
+	writer := connectToServer("6379")
+	defer writer.Conn.Close()
+
+	Write(writer.Writer, ToResp("XADD", "block:s", "1-1", "f", "v"))
+	writer.Buffer.Read()
+
+	start := time.Now()
+	Write(reader.Writer, ToResp("XREAD", "BLOCK", "100", "STREAMS", "block:s", "$"))
+	parsedResp, _, _ := reader.Buffer.Read()
+	if parsedResp.Type != 0 {
+		t.Errorf("Expected nil, got %v", parsedResp)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Errorf("Expected XREAD to block for the timeout")
+	}
+
+	// Every reader wakes as soon as an entry is added to one of its streams,
+	// and $ only reads entries added after the call
+	start = time.Now()
+	Write(reader.Writer, ToResp("XREAD", "BLOCK", "0", "STREAMS", "block:s", "$"))
+	Write(other.Writer, ToResp("XREAD", "BLOCK", "5000", "STREAMS", "block:other", "block:s", "0-0", "$"))
+	time.Sleep(50 * time.Millisecond)
+	Write(writer.Writer, ToResp("XADD", "block:unrelated", "1-1", "f", "v"))
+	writer.Buffer.Read()
+	Write(writer.Writer, ToResp("XADD", "block:s", "2-1", "f", "v"))
+	writer.Buffer.Read()
+
+	for _, conn := range []*ReadWriter{reader, other} {
+		parsedResp, _, _ := conn.Buffer.Read()
+		values := flattenResp([]*RESP{parsedResp})
+		if len(values) != 4 || values[0].Value != "block:s" || values[1].Value != "2-1" {
+			t.Errorf("Expected [block:s [2-1 [f v]]], got %v", parsedResp)
+		}
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Expected XREAD to return once the entry was added")
+	}
+}
+
+func TestXreadDisconnect(t *testing.T) {
+	db := NewDatabase(0)
+	s := &Server{DBs: []*Database{db}}
+	conn := &ConnRW{Closed: make(chan struct{})}
+	close(conn.Closed)
+
+	// Closing the connection removes the reader from the stream
+	resp := s.xread(db, []*RESP{BulkString("BLOCK"), BulkString("0"), BulkString("STREAMS"), BulkString("s"), BulkString("$")}, conn)
+	if resp.Type != NULL {
+		t.Errorf("Expected nil, got %v", resp)
+	}
+	if _, ok := db.BLOCKs["s"]; ok {
+		t.Errorf("Expected the reader to be removed from the stream")
+	}
+}
+
+func TestStreamTrim(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "trim:list", "a"))
+	conn.Buffer.Read()
+	for i := 1; i <= 250; i++ {
+		Write(conn.Writer, ToResp("XADD", "trim:big", strconv.Itoa(i)+"-1", "f", "v"))
+		conn.Buffer.Read()
+	}
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"XADD", "trim:s", "0-0", "f", "v"}, ERROR, "ERR The ID specified in XADD must be greater than 0-0"},
+		{[]string{"XADD", "trim:s", "0-*", "f", "v"}, BULK, "0-1"},
+		{[]string{"XADD", "trim:s", "1-*", "f", "v"}, BULK, "1-0"},
+		{[]string{"XADD", "trim:s", "1-*", "f", "v"}, BULK, "1-1"},
+		{[]string{"XADD", "trim:s", "1", "f", "v"}, ERROR, "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		{[]string{"XADD", "trim:s", "x-1", "f", "v"}, ERROR, "ERR Invalid stream ID specified as stream command argument"},
+		{[]string{"XADD", "trim:s", "2-1", "f"}, ERROR, "ERR wrong number of arguments for 'xadd' command"},
+		{[]string{"XADD", "trim:list", "*", "f", "v"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"XADD", "trim:none", "NOMKSTREAM", "*", "f", "v"}, 0, ""},
+		{[]string{"EXISTS", "trim:none"}, INTEGER, "0"},
+		{[]string{"XADD", "trim:s", "MAXLEN", "-1", "*", "f", "v"}, ERROR, "ERR The MAXLEN argument must be >= 0."},
+		{[]string{"XADD", "trim:s", "MAXLEN", "1", "LIMIT", "10", "*", "f", "v"}, ERROR, "ERR syntax error, LIMIT cannot be used without the special ~ option"},
+		{[]string{"XADD", "trim:s", "MAXLEN", "2", "5-1", "f", "v"}, BULK, "5-1"},
+		{[]string{"XLEN", "trim:s"}, INTEGER, "2"},
+		{[]string{"XLEN", "trim:none"}, INTEGER, "0"},
+		{[]string{"XLEN", "trim:list"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"XDEL", "trim:s", "1-1", "1-1", "3-3"}, INTEGER, "1"},
+		{[]string{"XDEL", "trim:s", "x"}, ERROR, "ERR Invalid stream ID specified as stream command argument"},
+		{[]string{"XLEN", "trim:s"}, INTEGER, "1"},
+		{[]string{"XTRIM", "trim:s", "MINID", "6"}, INTEGER, "1"},
+		{[]string{"XLEN", "trim:s"}, INTEGER, "0"},
+		{[]string{"XADD", "trim:s", "5-1", "f", "v"}, ERROR, "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		{[]string{"XTRIM", "trim:big", "MAXLEN", "~", "120"}, INTEGER, "100"},
+		{[]string{"XTRIM", "trim:big", "MAXLEN", "~", "120"}, INTEGER, "0"},
+		{[]string{"XTRIM", "trim:big", "MINID", "~", "220", "LIMIT", "50"}, INTEGER, "0"},
+		{[]string{"XTRIM", "trim:big", "MAXLEN", "=", "120"}, INTEGER, "30"},
+		{[]string{"XTRIM", "trim:big", "MINID", "200"}, INTEGER, "69"},
+		{[]string{"XLEN", "trim:big"}, INTEGER, "51"},
+		{[]string{"XTRIM", "trim:big", "LEN", "1"}, ERROR, "ERR syntax error"},
+		{[]string{"XSETID", "trim:missing", "1-1"}, ERROR, "ERR no such key"},
+		{[]string{"XSETID", "trim:big", "249-1"}, ERROR, "ERR The ID specified in XSETID is smaller than the target stream top item"},
+		{[]string{"XSETID", "trim:big", "300-1", "ENTRIESADDED", "10"}, ERROR, "ERR The entries_added specified in XSETID is smaller than the target stream length"},
+		{[]string{"XSETID", "trim:big", "300-1", "MAXDELETEDID", "301-1"}, ERROR, "ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id"},
+		{[]string{"XSETID", "trim:big", "300-1"}, STRING, "OK"},
+		{[]string{"XADD", "trim:big", "300-*", "f", "v"}, BULK, "300-2"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+
+	ranges := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"XRANGE", "trim:big", "-", "+", "COUNT", "2"}, []string{"200-1", "f", "v", "201-1", "f", "v"}},
+		{[]string{"XRANGE", "trim:big", "(248-1", "249"}, []string{"249-1", "f", "v"}},
+		{[]string{"XREVRANGE", "trim:big", "+", "-", "COUNT", "2"}, []string{"300-2", "f", "v", "250-1", "f", "v"}},
+		{[]string{"XREVRANGE", "trim:big", "250", "(249-1"}, []string{"250-1", "f", "v"}},
+		{[]string{"XREVRANGE", "trim:big", "-", "+"}, []string{}},
+		{[]string{"XRANGE", "trim:big", "-", "+", "COUNT", "0"}, []string{}},
+		{[]string{"XRANGE", "trim:s", "-", "+"}, []string{}},
+		{[]string{"XRANGE", "trim:missing", "-", "+"}, []string{}},
+	}
+	for _, test := range ranges {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != ARRAY {
+			t.Errorf("%v: expected an array, got %v", test.args, parsedResp)
+			continue
+		}
+		values := flattenResp(parsedResp.Values)
+		if len(values) != len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, values)
+			continue
+		}
+		for i, v := range test.expected {
+			if values[i].Value != v {
+				t.Errorf("%v: expected %s at index %d, got %v", test.args, v, i, values[i])
+			}
+		}
+	}
+}
+
+func TestXinfo(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	for _, args := range [][]string{
+		{"XADD", "info:s", "1-1", "a", "1"},
+		{"XADD", "info:s", "2-1", "b", "2"},
+		{"XADD", "info:s", "3-1", "c", "3"},
+		{"XGROUP", "CREATE", "info:s", "g", "0"},
+	} {
+		Write(conn.Writer, ToResp(args...))
+		conn.Buffer.Read()
+	}
+
+	// query returns the fields of a reply given as names followed by values
+	query := func(args ...string) map[string]*RESP {
+		Write(conn.Writer, ToResp(args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type == ARRAY && len(parsedResp.Values) == 1 {
+			parsedResp = parsedResp.Values[0]
+		}
+		fields := map[string]*RESP{}
+		for i := 0; i+1 < len(parsedResp.Values); i += 2 {
+			fields[parsedResp.Values[i].Value] = parsedResp.Values[i+1]
+		}
+		return fields
+	}
+	expect := func(fields map[string]*RESP, name string, expected string) {
+		t.Helper()
+		field, ok := fields[name]
+		if !ok {
+			t.Errorf("Expected field %s, got %v", name, fields)
+		} else if expected == "nil" && field.Type != 0 || expected != "nil" && field.Value != expected {
+			t.Errorf("Expected %s to be %s, got %v", name, expected, field)
+		}
+	}
+
+	groups := query("XINFO", "GROUPS", "info:s")
+	expect(groups, "entries-read", "nil")
+	expect(groups, "lag", "3")
+
+	Write(conn.Writer, ToResp("XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "info:s", ">"))
+	conn.Buffer.Read()
+	groups = query("XINFO", "GROUPS", "info:s")
+	expect(groups, "name", "g")
+	expect(groups, "consumers", "1")
+	expect(groups, "pending", "1")
+	expect(groups, "last-delivered-id", "1-1")
+	expect(groups, "entries-read", "1")
+	expect(groups, "lag", "2")
+
+	// Deleted entries ahead of the group make its lag unknown
+	Write(conn.Writer, ToResp("XDEL", "info:s", "2-1"))
+	conn.Buffer.Read()
+	expect(query("XINFO", "GROUPS", "info:s"), "lag", "nil")
+
+	info := query("XINFO", "STREAM", "info:s")
+	expect(info, "length", "2")
+	expect(info, "last-generated-id", "3-1")
+	expect(info, "max-deleted-entry-id", "2-1")
+	expect(info, "entries-added", "3")
+	expect(info, "recorded-first-entry-id", "1-1")
+	expect(info, "groups", "1")
+	if first := flattenResp([]*RESP{info["first-entry"]}); len(first) != 3 || first[0].Value != "1-1" {
+		t.Errorf("Expected first entry 1-1, got %v", info["first-entry"])
+	}
+	if last := flattenResp([]*RESP{info["last-entry"]}); len(last) != 3 || last[0].Value != "3-1" {
+		t.Errorf("Expected last entry 3-1, got %v", info["last-entry"])
+	}
+
+	full := query("XINFO", "STREAM", "info:s", "FULL", "COUNT", "1")
+	expect(full, "length", "2")
+	if entries := full["entries"]; entries == nil || len(entries.Values) != 1 {
+		t.Errorf("Expected a single entry, got %v", entries)
+	}
+	if groups := full["groups"]; groups == nil || len(groups.Values) != 1 {
+		t.Errorf("Expected a single group, got %v", groups)
+	}
+
+	consumers := query("XINFO", "CONSUMERS", "info:s", "g")
+	expect(consumers, "name", "alice")
+	expect(consumers, "pending", "1")
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"XINFO", "STREAM", "info:missing"}, ERROR, "ERR no such key"},
+		{[]string{"XINFO", "FOO", "info:s"}, ERROR, "ERR unknown subcommand 'FOO'. Try XINFO HELP."},
+		{[]string{"XINFO", "CONSUMERS", "info:s", "nope"}, ERROR, "NOGROUP No such consumer group 'nope' for key name 'info:s'"},
+		{[]string{"XINFO", "STREAM", "info:s", "FULL", "COUNT"}, ERROR, "ERR syntax error"},
+		{[]string{"XGROUP", "CREATE", "info:s", "g2", "$", "ENTRIESREAD", "3"}, STRING, "OK"},
+		{[]string{"XGROUP", "SETID", "info:s", "g2", "0", "ENTRIESREAD", "-2"}, ERROR, "ERR value for ENTRIESREAD must be positive or -1"},
+		{[]string{"XGROUP", "SETID", "info:s", "g2", "0", "MKSTREAM"}, ERROR, "ERR syntax error"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
+
+func TestXread(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	for _, args := range [][]string{
+		{"XADD", "read:a", "1-1", "a", "1"},
+		{"XADD", "read:a", "2-1", "a", "2"},
+		{"XADD", "read:a", "3-1", "a", "3"},
+		{"XADD", "read:b", "5-1", "b", "5"},
+		{"XADD", "read:order", "9-0", "f", "v"},
+		{"XADD", "read:order", "10-0", "f", "v"},
+		{"RPUSH", "read:list", "a"},
+	} {
+		Write(conn.Writer, ToResp(args...))
+		conn.Buffer.Read()
+	}
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"XREAD", "STREAMS", "read:a"}, ERROR, "ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified."},
+		{[]string{"XREAD", "COUNT", "1", "read:a", "0"}, ERROR, "ERR syntax error"},
+		{[]string{"XREAD", "STREAMS", "read:a", "x"}, ERROR, "ERR Invalid stream ID specified as stream command argument"},
+		{[]string{"XREAD", "STREAMS", "read:list", "0"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"XREAD", "STREAMS", "read:a", "3-1"}, 0, ""},
+		{[]string{"XREAD", "STREAMS", "read:a", "read:missing", "$", "0"}, 0, ""},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+
+	reads := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"XREAD", "COUNT", "2", "STREAMS", "read:a", "0"}, []string{"read:a", "1-1", "a", "1", "2-1", "a", "2"}},
+		{[]string{"xread", "count", "1", "streams", "read:a", "read:b", "1-1", "0"}, []string{"read:a", "2-1", "a", "2", "read:b", "5-1", "b", "5"}},
+		{[]string{"XREAD", "STREAMS", "read:missing", "read:a", "read:b", "0", "2", "5-1"}, []string{"read:a", "2-1", "a", "2", "3-1", "a", "3"}},
+		{[]string{"XREAD", "STREAMS", "read:order", "0"}, []string{"read:order", "9-0", "f", "v", "10-0", "f", "v"}},
+		{[]string{"XREAD", "STREAMS", "read:order", "9"}, []string{"read:order", "10-0", "f", "v"}},
+	}
+	for _, test := range reads {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != ARRAY {
+			t.Errorf("%v: expected an array, got %v", test.args, parsedResp)
+			continue
+		}
+		// Each stream is replied as its key followed by its entries
+		for _, stream := range parsedResp.Values {
+			if len(stream.Values) != 2 {
+				t.Errorf("%v: expected [key entries], got %v", test.args, stream)
+			}
+		}
+		values := flattenResp(parsedResp.Values)
+		if len(values) != len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, values)
+			continue
+		}
+		for i, v := range test.expected {
+			if values[i].Value != v {
+				t.Errorf("%v: expected %s at index %d, got %v", test.args, v, i, values[i])
+			}
+		}
+	}
+}
+
+func TestStreamNodes(t *testing.T) {
+	stream := NewStream()
+	for i := 1; i <= 250; i++ {
+		fields := []string{"sensor", strconv.Itoa(i % 7), "temperature", strconv.Itoa(20 + i%10)}
+		if i == 150 {
+			fields = []string{"other", "x"}
+		}
+		stream.insert(StreamID{1700000000000 + uint64(i/3), uint64(i % 3)}, fields)
+		stream.Length++
+	}
+
+	if n := stream.Nodes.Keys(); n != 3 {
+		t.Errorf("Expected 3 nodes, got %d", n)
+	}
+	size := 0
+	stream.Nodes.Walk(func(_ string, node any) {
+		size += len(node.([]byte))
+	})
+	if size > 250*16 {
+		t.Errorf("Expected at most 16 bytes per entry, got %d bytes", size)
+	}
+
+	id := StreamID{1700000000050, 0}
+	if fields, ok := stream.lookup(id); !ok || fields[0] != "other" || fields[1] != "x" {
+		t.Errorf("Expected the entry with other fields, got %v", fields)
+	}
+	if !stream.delete(id) || stream.delete(id) {
+		t.Errorf("Expected %s to be deleted once", id)
+	}
+	stream.Length--
+	if _, ok := stream.lookup(id); ok {
+		t.Errorf("Expected %s to be deleted", id)
+	}
+
+	records := stream.rangeEntries(StreamID{1700000000049, 2}, StreamID{1700000000050, 1}, 0, false)
+	if len(records) != 2 || records[0].id.String() != "1700000000049-2" || records[1].id.String() != "1700000000050-1" {
+		t.Errorf("Expected the entries around the deleted one, got %v", records)
+	}
+	records = stream.rangeEntries(StreamID{}, maxStreamID, 3, true)
+	if len(records) != 3 || records[0].id.String() != "1700000000083-1" || records[0].fields[3] != "20" {
+		t.Errorf("Expected the last entries, got %v", records)
+	}
+	if records := stream.rangeEntries(StreamID{}, maxStreamID, 0, false); len(records) != 249 {
+		t.Errorf("Expected 249 entries, got %d", len(records))
+	}
+
+	// Deleting every entry of a node removes it
+	for _, record := range stream.rangeEntries(StreamID{}, maxStreamID, streamNodeMaxEntries, false) {
+		stream.delete(record.id)
+	}
+	if n := stream.Nodes.Keys(); n != 2 {
+		t.Errorf("Expected 2 nodes, got %d", n)
+	}
+}
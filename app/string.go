@@ -0,0 +1,473 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Strings can't grow past this many bytes, like proto-max-bulk-len in Redis
+const maxStringSize = 512 * 1024 * 1024
+
+// String commands ------------------------------------------------------------
+func (s *Server) mget(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'mget' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	// Keys holding other types are returned as nil instead of an error
+	values := make([]*RESP, 0, len(args))
+	for _, key := range args {
+		db.expireIfNeeded(key.Value)
+		if value, ok := db.SETs[key.Value]; ok {
+			values = append(values, BulkString(string(value)))
+		} else {
+			values = append(values, NullResp())
+		}
+	}
+	return &RESP{Type: ARRAY, Values: values}
+}
+
+func (s *Server) mset(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return ErrResp("ERR wrong number of arguments for 'mset' command")
+	}
+
+	// Every key is set under one lock so readers see all or none of them
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	for i := 0; i < len(args); i += 2 {
+		db.setString(args[i].Value, args[i+1].Value)
+	}
+	s.Dirty.Add(int64(len(args) / 2))
+	return OkResp()
+}
+
+func (s *Server) msetnx(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return ErrResp("ERR wrong number of arguments for 'msetnx' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	for i := 0; i < len(args); i += 2 {
+		db.expireIfNeeded(args[i].Value)
+		if db.typeOf(args[i].Value) != "none" {
+			return Integer(0)
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		db.setString(args[i].Value, args[i+1].Value)
+	}
+	s.Dirty.Add(int64(len(args) / 2))
+	return Integer(1)
+}
+
+func (s *Server) setnx(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'setnx' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	db.expireIfNeeded(key)
+	if db.typeOf(key) != "none" {
+		return Integer(0)
+	}
+	db.setString(key, args[1].Value)
+	s.Dirty.Add(1)
+	return Integer(1)
+}
+
+func (s *Server) appendcmd(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'append' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	value, _, errResp := db.getBytes(key)
+	if errResp != nil {
+		return errResp
+	}
+	if len(value)+len(args[1].Value) > maxStringSize {
+		return ErrResp("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+
+	// The expiry is kept
+	value = append(value, args[1].Value...)
+	db.setValue(key, value)
+	s.Dirty.Add(1)
+	return Integer(len(value))
+}
+
+func (s *Server) strlen(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'strlen' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	value, _, errResp := db.getString(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	return Integer(len(value))
+}
+
+func (s *Server) getrange(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'getrange' command")
+	}
+	start, errResp := parseInt(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+	end, errResp := parseInt(args[2].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	value, _, errResp := db.getString(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	// Negative offsets count from the end, and the range is clamped to the
+	// string
+	if start < 0 && end < 0 && start > end {
+		return BulkString("")
+	}
+	n := len(value)
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	start, end = max(start, 0), min(max(end, 0), n-1)
+	if start > end || n == 0 {
+		return BulkString("")
+	}
+	return BulkString(value[start : end+1])
+}
+
+func (s *Server) setrange(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'setrange' command")
+	}
+	offset, errResp := parseInt(args[1].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if offset < 0 {
+		return ErrResp("ERR offset is out of range")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key, patch := args[0].Value, args[2].Value
+	value, _, errResp := db.getBytes(key)
+	if errResp != nil {
+		return errResp
+	}
+
+	// An empty patch never creates or grows the string
+	if len(patch) == 0 {
+		return Integer(len(value))
+	}
+	if offset+len(patch) > maxStringSize {
+		return ErrResp("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+
+	value = growBytes(value, offset+len(patch))
+	copy(value[offset:], patch)
+	db.setValue(key, value)
+	s.Dirty.Add(1)
+	return Integer(len(value))
+}
+
+func (s *Server) getset(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'getset' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	old, exists, errResp := db.getString(key)
+	if errResp != nil {
+		return errResp
+	}
+	db.setString(key, args[1].Value)
+	s.Dirty.Add(1)
+	if !exists {
+		return NullResp()
+	}
+	return BulkString(old)
+}
+
+func (s *Server) getdel(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'getdel' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	value, exists, errResp := db.getString(key)
+	if errResp != nil {
+		return errResp
+	}
+	if !exists {
+		return NullResp()
+	}
+	db.deleteKey(key)
+	s.Dirty.Add(1)
+	return BulkString(value)
+}
+
+func (s *Server) getex(db *Database, args []*RESP) *RESP {
+	if len(args) < 1 {
+		return ErrResp("ERR wrong number of arguments for 'getex' command")
+	}
+
+	var expireAt int64
+	expireOpt := ""
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToUpper(args[i].Value)
+		switch opt {
+		case "PERSIST":
+			if expireOpt != "" {
+				return ErrResp("ERR syntax error")
+			}
+			expireOpt = opt
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireOpt != "" || i+1 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			expireOpt = opt
+			i++
+			at, errResp := parseExpireTime(opt, args[i].Value, "getex")
+			if errResp != nil {
+				return errResp
+			}
+			expireAt = at
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	value, exists, errResp := db.getString(key)
+	if errResp != nil {
+		return errResp
+	}
+	if !exists {
+		return NullResp()
+	}
+
+	// Replicas get the expiry as a unix time, so one that applies the command
+	// late doesn't keep the key longer than the master
+	switch expireOpt {
+	case "":
+	case "PERSIST":
+		if _, ok := db.EXPs[key]; ok {
+			delete(db.EXPs, key)
+			s.propagateCommand(db, ToResp("PERSIST", key))
+			s.Dirty.Add(1)
+		}
+	default:
+		db.EXPs[key] = expireAt
+		s.propagateCommand(db, ToResp("PEXPIREAT", key, strconv.FormatInt(expireAt, 10)))
+		s.Dirty.Add(1)
+	}
+	return BulkString(value)
+}
+
+func (s *Server) incr(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'incr' command")
+	}
+	return s.incrGeneric(db, args[0].Value, 1)
+}
+
+func (s *Server) decr(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'decr' command")
+	}
+	return s.incrGeneric(db, args[0].Value, -1)
+}
+
+func (s *Server) incrby(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'incrby' command")
+	}
+	incr, ok := parseInt64(args[1].Value)
+	if !ok {
+		return ErrResp("ERR value is not an integer or out of range")
+	}
+	return s.incrGeneric(db, args[0].Value, incr)
+}
+
+func (s *Server) decrby(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'decrby' command")
+	}
+	decr, ok := parseInt64(args[1].Value)
+	if !ok {
+		return ErrResp("ERR value is not an integer or out of range")
+	}
+	if decr == math.MinInt64 {
+		return ErrResp("ERR decrement would overflow")
+	}
+	return s.incrGeneric(db, args[0].Value, -decr)
+}
+
+func (s *Server) incrbyfloat(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'incrbyfloat' command")
+	}
+	incr, ok := parseFloat(args[1].Value)
+	if !ok {
+		return ErrResp("ERR value is not a valid float")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	key := args[0].Value
+	value, exists, errResp := db.getString(key)
+	if errResp != nil {
+		return errResp
+	}
+	current := 0.0
+	if exists {
+		if current, ok = parseFloat(value); !ok {
+			return ErrResp("ERR value is not a valid float")
+		}
+	}
+	result := current + incr
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return ErrResp("ERR increment would produce NaN or Infinity")
+	}
+
+	// Replicas set the result rather than add the increment again, so float
+	// rounding can't make them drift apart
+	value = strconv.FormatFloat(result, 'f', -1, 64)
+	db.setValue(key, value)
+	s.propagateCommand(db, ToResp("SET", key, value, "KEEPTTL"))
+	s.Dirty.Add(1)
+	return BulkString(value)
+}
+
+// ----------------------------------------------------------------------------
+
+// String helpers -------------------------------------------------------------
+// getString returns a copy of the string stored at key and whether it
+// exists, or a WRONGTYPE error if the key holds another type. Caller must hold
+// SETsMu.
+func (db *Database) getString(key string) (string, bool, *RESP) {
+	value, ok, errResp := db.getBytes(key)
+	return string(value), ok, errResp
+}
+
+// getBytes is like getString but returns the stored bytes themselves, which
+// may be modified in place. Caller must hold SETsMu.
+func (db *Database) getBytes(key string) ([]byte, bool, *RESP) {
+	db.expireIfNeeded(key)
+	value, ok := db.SETs[key]
+	if !ok && db.typeOf(key) != "none" {
+		return nil, false, WrongTypeResp()
+	}
+	return value, ok, nil
+}
+
+// growBytes extends b with zero bytes to at least n bytes, reusing its spare
+// capacity when there is enough.
+func growBytes(b []byte, n int) []byte {
+	if n <= len(b) {
+		return b
+	}
+	return append(b, make([]byte, n-len(b))...)
+}
+
+// incrGeneric adds incr to the integer stored at key, which is 0 if the key
+// is missing, keeping its expiry.
+func (s *Server) incrGeneric(db *Database, key string, incr int64) *RESP {
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	value, exists, errResp := db.getString(key)
+	if errResp != nil {
+		return errResp
+	}
+	var current int64
+	if exists {
+		var ok bool
+		if current, ok = parseInt64(value); !ok {
+			return ErrResp("ERR value is not an integer or out of range")
+		}
+	}
+	if (incr > 0 && current > math.MaxInt64-incr) || (incr < 0 && current < math.MinInt64-incr) {
+		return ErrResp("ERR increment or decrement would overflow")
+	}
+
+	db.setValue(key, strconv.FormatInt(current+incr, 10))
+	s.Dirty.Add(1)
+	return Integer(current + incr)
+}
+
+// parseInt64 parses an integer the way Redis does, rejecting signs, spaces and
+// leading zeros that wouldn't be printed back.
+func parseInt64(value string) (int64, bool) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != value {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseFloat parses a float the way Redis does, rejecting spaces and NaN.
+func parseFloat(value string) (float64, bool) {
+	if value == "" || strings.TrimSpace(value) != value {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+// setString stores value at key, replacing a value of any type and its
+// expiry. Caller must hold SETsMu.
+func (db *Database) setString(key, value string) {
+	db.expireIfNeeded(key)
+	if t := db.typeOf(key); t != "none" && t != "string" {
+		db.deleteKey(key)
+	}
+	db.setValue(key, value)
+	delete(db.EXPs, key)
+}
+
+// ----------------------------------------------------------------------------
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestStringCommands(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("RPUSH", "string:list", "a"))
+	conn.Buffer.Read()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"MSET", "string:a", "1", "string:b"}, ERROR, "ERR wrong number of arguments for 'mset' command"},
+		{[]string{"MSET", "string:a", "1", "string:b", "2"}, STRING, "OK"},
+		{[]string{"MSETNX", "string:b", "3", "string:c", "3"}, INTEGER, "0"},
+		{[]string{"EXISTS", "string:c"}, INTEGER, "0"},
+		{[]string{"MSETNX", "string:c", "3", "string:d", "4"}, INTEGER, "1"},
+		{[]string{"SETNX", "string:c", "x"}, INTEGER, "0"},
+		{[]string{"SETNX", "string:e", "hello"}, INTEGER, "1"},
+		{[]string{"APPEND", "string:e", " world"}, INTEGER, "11"},
+		{[]string{"APPEND", "string:list", "x"}, ERROR, "WRONGTYPE Operation against a key holding the wrong kind of value"},
+		{[]string{"STRLEN", "string:e"}, INTEGER, "11"},
+		{[]string{"STRLEN", "string:missing"}, INTEGER, "0"},
+		{[]string{"GETRANGE", "string:e", "0", "4"}, BULK, "hello"},
+		{[]string{"GETRANGE", "string:e", "-5", "-1"}, BULK, "world"},
+		{[]string{"GETRANGE", "string:e", "-1", "-5"}, BULK, ""},
+		{[]string{"GETRANGE", "string:e", "6", "100"}, BULK, "world"},
+		{[]string{"GETRANGE", "string:missing", "0", "-1"}, BULK, ""},
+		{[]string{"SETRANGE", "string:e", "6", "Redis"}, INTEGER, "11"},
+		{[]string{"GET", "string:e"}, BULK, "hello Redis"},
+		{[]string{"SETRANGE", "string:pad", "3", "x"}, INTEGER, "4"},
+		{[]string{"GET", "string:pad"}, BULK, "\x00\x00\x00x"},
+		{[]string{"SETRANGE", "string:crlf", "0", "a\r\nb"}, INTEGER, "4"},
+		{[]string{"GET", "string:crlf"}, BULK, "a\r\nb"},
+		{[]string{"STRLEN", "string:crlf"}, INTEGER, "4"},
+		{[]string{"SETRANGE", "string:empty", "5", ""}, INTEGER, "0"},
+		{[]string{"EXISTS", "string:empty"}, INTEGER, "0"},
+		{[]string{"SETRANGE", "string:e", "-1", "x"}, ERROR, "ERR offset is out of range"},
+		{[]string{"SETRANGE", "string:e", "536870912", "x"}, ERROR, "ERR string exceeds maximum allowed size (proto-max-bulk-len)"},
+		{[]string{"GETSET", "string:a", "10"}, BULK, "1"},
+		{[]string{"GETSET", "string:new", "v"}, 0, ""},
+		{[]string{"GETDEL", "string:new"}, BULK, "v"},
+		{[]string{"GETDEL", "string:new"}, 0, ""},
+		{[]string{"GETEX", "string:a", "EX", "100"}, BULK, "10"},
+		{[]string{"TTL", "string:a"}, INTEGER, "100"},
+		{[]string{"GETEX", "string:a", "PERSIST"}, BULK, "10"},
+		{[]string{"TTL", "string:a"}, INTEGER, "-1"},
+		{[]string{"GETEX", "string:a", "EX", "0"}, ERROR, "ERR invalid expire time in 'getex' command"},
+		{[]string{"GETEX", "string:a", "PERSIST", "EX", "10"}, ERROR, "ERR syntax error"},
+		{[]string{"GETEX", "string:missing", "EX", "10"}, 0, ""},
+		{[]string{"MSET", "string:list", "v"}, STRING, "OK"},
+		{[]string{"TYPE", "string:list"}, STRING, "string"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+
+	Write(conn.Writer, ToResp("MGET", "string:a", "string:missing", "string:list"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 3 ||
+		parsedResp.Values[0].Value != "10" || parsedResp.Values[1].Type != 0 || parsedResp.Values[2].Value != "v" {
+		t.Errorf("Expected [10 nil v], got %v", parsedResp)
+	}
+}
+
+func TestMsetIsAtomic(t *testing.T) {
+	createMasterServer("6379")
+	writer := connectToServer("6379")
+	defer writer.Conn.Close()
+	reader := connectToServer("6379")
+	defer reader.Conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			v := string(rune('a' + i%26))
+			Write(writer.Writer, ToResp("MSET", "string:x", v, "string:y", v))
+			writer.Buffer.Read()
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		Write(reader.Writer, ToResp("MGET", "string:x", "string:y"))
+		parsedResp, _, _ := reader.Buffer.Read()
+		if parsedResp.Values[0].Value != parsedResp.Values[1].Value {
+			t.Fatalf("Expected both keys to match, got %v", parsedResp)
+		}
+	}
+}
+
+func TestIncrCommands(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("SET", "incr:max", "9223372036854775806"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SET", "incr:padded", "007"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("SET", "incr:float", "10.50", "EX", "100"))
+	conn.Buffer.Read()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"INCR", "incr:counter"}, INTEGER, "1"},
+		{[]string{"INCRBY", "incr:counter", "41"}, INTEGER, "42"},
+		{[]string{"DECR", "incr:counter"}, INTEGER, "41"},
+		{[]string{"DECRBY", "incr:counter", "-9"}, INTEGER, "50"},
+		{[]string{"INCRBY", "incr:counter", "+1"}, ERROR, "ERR value is not an integer or out of range"},
+		{[]string{"INCRBY", "incr:counter", "9223372036854775808"}, ERROR, "ERR value is not an integer or out of range"},
+		{[]string{"DECRBY", "incr:counter", "-9223372036854775808"}, ERROR, "ERR decrement would overflow"},
+		{[]string{"INCR", "incr:max"}, INTEGER, "9223372036854775807"},
+		{[]string{"INCR", "incr:max"}, ERROR, "ERR increment or decrement would overflow"},
+		{[]string{"DECRBY", "incr:max", "9223372036854775807"}, INTEGER, "0"},
+		{[]string{"DECRBY", "incr:max", "9223372036854775807"}, INTEGER, "-9223372036854775807"},
+		{[]string{"DECR", "incr:max"}, INTEGER, "-9223372036854775808"},
+		{[]string{"DECR", "incr:max"}, ERROR, "ERR increment or decrement would overflow"},
+		{[]string{"INCR", "incr:padded"}, ERROR, "ERR value is not an integer or out of range"},
+		{[]string{"INCRBYFLOAT", "incr:float", "0.1"}, BULK, "10.6"},
+		{[]string{"INCRBYFLOAT", "incr:float", "-5.6"}, BULK, "5"},
+		{[]string{"INCRBYFLOAT", "incr:float", "5.0e3"}, BULK, "5005"},
+		{[]string{"TTL", "incr:float"}, INTEGER, "100"},
+		{[]string{"INCRBYFLOAT", "incr:float", "inf"}, ERROR, "ERR increment would produce NaN or Infinity"},
+		{[]string{"INCRBYFLOAT", "incr:float", "abc"}, ERROR, "ERR value is not a valid float"},
+		{[]string{"INCRBYFLOAT", "incr:new", " 1"}, ERROR, "ERR value is not a valid float"},
+		{[]string{"INCRBYFLOAT", "incr:new", "1.5"}, BULK, "1.5"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %q, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
+
+func TestGetexPropagatesAbsoluteExpiry(t *testing.T) {
+	db := NewDatabase(0)
+	replica := &ConnRW{Type: REPLICA, ReplBuffer: [][]byte{}}
+	server := &Server{DBs: []*Database{db}, Conns: []*ConnRW{replica}}
+	conn := &ConnRW{RedirectRead: true}
+	server.Handler(ToResp("SET", "getex:key", "a"), conn)
+
+	// Expiries reach replicas as the unix time set on the master, and a plain
+	// GETEX changes nothing
+	tests := []struct {
+		args     []string
+		expected func() []string
+	}{
+		{[]string{"GETEX", "getex:key", "EX", "100"}, func() []string {
+			return []string{"PEXPIREAT", "getex:key", strconv.FormatInt(db.EXPs["getex:key"], 10)}
+		}},
+		{[]string{"GETEX", "getex:key", "PX", "100000"}, func() []string {
+			return []string{"PEXPIREAT", "getex:key", strconv.FormatInt(db.EXPs["getex:key"], 10)}
+		}},
+		{[]string{"GETEX", "getex:key"}, nil},
+		{[]string{"GETEX", "getex:key", "PERSIST"}, func() []string {
+			return []string{"PERSIST", "getex:key"}
+		}},
+		{[]string{"GETEX", "getex:key", "PERSIST"}, nil},
+		{[]string{"GETEX", "getex:missing", "EX", "100"}, nil},
+	}
+	for _, test := range tests {
+		propagated := len(replica.ReplBuffer)
+		server.Handler(ToResp(test.args...), conn)
+		if test.expected == nil {
+			if len(replica.ReplBuffer) != propagated {
+				t.Errorf("%v: expected nothing propagated, got %q", test.args, replica.ReplBuffer[propagated:])
+			}
+			continue
+		}
+		expected := string(ToResp(test.expected()...).Marshal())
+		if len(replica.ReplBuffer) != propagated+1 || string(replica.ReplBuffer[propagated]) != expected {
+			t.Errorf("%v: expected %q, got %q", test.args, expected, replica.ReplBuffer[propagated:])
+		}
+	}
+}
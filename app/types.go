@@ -2,12 +2,16 @@ package main
 
 import (
 	"bufio"
+	"container/list"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	queue "github.com/elordeiro/redis-server/queue"
 	radix "github.com/elordeiro/redis-server/radix"
+	zset "github.com/elordeiro/redis-server/zset"
 )
 
 // Constants ------------------------------------------------------------------
@@ -20,10 +24,44 @@ const (
 	ARRAY   = '*'
 	NULL    = '_'
 	RDB     = '@'
+
+	// Sent as a nil array, where NULL is sent as a nil bulk string
+	NULL_ARRAY = '^'
 )
 
 var CRLF = []byte("\r\n")
 
+// RDB value types
+const (
+	RDB_STRING                = 0
+	RDB_SET                   = 2
+	RDB_HASH                  = 4
+	RDB_ZSET_2                = 5
+	RDB_SET_INTSET            = 11
+	RDB_HASH_ZIPLIST          = 13
+	RDB_HASH_LISTPACK         = 16
+	RDB_ZSET_LISTPACK         = 17
+	RDB_LIST_QUICKLIST_2      = 18
+	RDB_STREAM_LISTPACKS_2    = 19
+	RDB_SET_LISTPACK          = 20
+	RDB_STREAM_LISTPACKS_3    = 21
+	RDB_QUICKLIST_NODE_PLAIN  = 1
+	RDB_QUICKLIST_NODE_PACKED = 2
+)
+
+// RDB opcodes
+const (
+	RDB_OPCODE_AUX       = 0xFA
+	RDB_OPCODE_RESIZEDB  = 0xFB
+	RDB_OPCODE_EXPIRE_MS = 0xFC
+	RDB_OPCODE_EXPIRE    = 0xFD
+	RDB_OPCODE_SELECTDB  = 0xFE
+	RDB_OPCODE_EOF       = 0xFF
+)
+
+// Number of databases when not configured
+const defaultDatabases = 16
+
 // Server roles
 const (
 	MASTER = iota
@@ -50,31 +88,99 @@ type Writer struct {
 
 // Config flags
 type Config struct {
-	Port       string
-	IsReplica  bool
-	MasterHost string
-	MasterPort string
-	Dir        string
-	Dbfilename string
+	Port         string
+	IsReplica    bool
+	MasterHost   string
+	MasterPort   string
+	Dir          string
+	Dbfilename   string
+	Hz           int
+	ExpireEffort int
+	Databases    int
+	Save         string
 }
 
-type StreamEntry struct {
-	Seq     int64
-	Entries []*StreamKV
+// Save point, a snapshot is taken once Changes writes were made in the last
+// Seconds seconds
+type SaveParam struct {
+	Seconds int
+	Changes int
 }
 
-type StreamKV struct {
-	Key   string
-	Value string
+// Stream of entries packed in listpack nodes keyed by the ID of their first
+// entry, and the consumer groups reading it by name. LastID is the ID of the
+// last entry ever added, which may have been deleted since.
+type Stream struct {
+	Nodes        *radix.Radix
+	Length       int
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded int64
+	Groups       map[string]*StreamGroup
 }
 
-type StreamTop struct {
-	Time int64
-	Seq  int64
+type StreamID struct {
+	Time uint64
+	Seq  uint64
+}
+
+// Consumer group of a stream. Every entry delivered to one of its consumers
+// stays in the pending entries list, PEL, until it is acknowledged. Consumers
+// share the entries of the group PEL, each one owned by a single consumer.
+type StreamGroup struct {
+	LastID      StreamID
+	EntriesRead int64 // entries delivered to the group, -1 if unknown
+	PEL         map[StreamID]*StreamNACK
+	Consumers   map[string]*StreamConsumer
+}
+
+type StreamConsumer struct {
+	Name       string
+	SeenTime   int64 // last attempted interaction, unix milliseconds
+	ActiveTime int64 // last successful interaction, -1 if none
+	PEL        map[StreamID]*StreamNACK
+}
+
+// Entry delivered to a consumer but not acknowledged yet
+type StreamNACK struct {
+	Consumer      *StreamConsumer
+	DeliveryTime  int64
+	DeliveryCount int64
 }
 
 type ServerType int
 
+// Set of unique strings. Sets of integers are kept sorted in ints, like the
+// Redis intset encoding, until a non-integer member is added or they grow too
+// large, at which point members is used instead.
+type Set struct {
+	ints    []int64
+	members map[string]struct{}
+}
+
+// Client waiting on one or more keys of DB. Serve is called with SETsMu held
+// once one of the keys may be ready and returns nil if the client can't be
+// served.
+type BlockedClient struct {
+	DB    *Database
+	Keys  []string
+	Serve func(key string) *RESP
+	Ch    chan *RESP
+	Done  bool
+}
+
+// Key that may be ready to serve blocked clients
+type ReadyKey struct {
+	DB  *Database
+	Key string
+}
+
+// Command read from a client connection and its size in bytes
+type ClientCommand struct {
+	Resp *RESP
+	Size int
+}
+
 // Connection reader and writer
 type ConnRW struct {
 	Type              ServerType
@@ -85,6 +191,27 @@ type ConnRW struct {
 	RedirectRead      bool
 	RedirectWrite     bool
 	TransactionsQueue *queue.Queue
+	Closed            chan struct{}
+	Blocked           chan struct{}
+	DB                int
+	ReplBuffer        [][]byte // writes held until a replica has its snapshot, guarded by ReplMu
+}
+
+// Logical database selected with SELECT. Everything is guarded by the
+// server's SETsMu, except XADDs which is guarded by XADDsMu.
+type Database struct {
+	ID      int
+	SETs    map[string][]byte // modified in place, never shared
+	EXPs    map[string]int64
+	LISTs   map[string]*list.List
+	HSETs   map[string]map[string]string
+	SADDs   map[string]*Set
+	ZADDs   map[string]*zset.ZSet
+	KEYs    *zset.ZSet // every key by scan hash
+	BLOCKs  map[string]*queue.Queue
+	XADDs   map[string]*Stream
+	XADDsMu sync.RWMutex
+	Expired func(key string) // called for each key deleted lazily by expiry
 }
 
 type Server struct {
@@ -101,15 +228,22 @@ type Server struct {
 	Dbfilename       string
 	MasterReplOffset int
 	ReplicaCount     int
+	ReplDB           int
 	MasterConn       net.Conn
 	Conns            []*ConnRW
-	SETs             map[string]string
+	DBs              []*Database
 	SETsMu           sync.RWMutex
-	EXPs             map[string]int64
-	XADDs            map[string]*radix.Radix
-	XADDsMu          sync.RWMutex
-	XADDsCh          chan bool
-	XREADsBlock      bool
+	SyncMu           sync.RWMutex // read locked by commands, locked for replica snapshots
+	ReplMu           sync.Mutex   // guards writes to replicas
+	Hz               int          // guarded by SETsMu
+	ExpireEffort     int          // guarded by SETsMu
+	READYs           []ReadyKey   // guarded by SETsMu
+	SaveParams       []SaveParam  // guarded by SETsMu
+	Dirty            atomic.Int64 // changes to the dataset since the last save
+	LastSave         time.Time    // guarded by SETsMu
+	LastSaveTry      time.Time    // guarded by SETsMu
+	LastSaveOK       bool         // guarded by SETsMu
+	Saving           bool         // BGSAVE in progress, guarded by SETsMu
 }
 
 // ----------------------------------------------------------------------------
@@ -127,4 +261,32 @@ func NewWriter(wr io.Writer) *Writer {
 	}
 }
 
+func NewDatabase(id int) *Database {
+	return &Database{
+		ID:     id,
+		SETs:   map[string][]byte{},
+		EXPs:   map[string]int64{},
+		LISTs:  map[string]*list.List{},
+		HSETs:  map[string]map[string]string{},
+		SADDs:  map[string]*Set{},
+		ZADDs:  map[string]*zset.ZSet{},
+		KEYs:   zset.NewZSet(),
+		BLOCKs: map[string]*queue.Queue{},
+		XADDs:  map[string]*Stream{},
+	}
+}
+
+func NewStream() *Stream {
+	return &Stream{Nodes: radix.NewRadix(), Groups: map[string]*StreamGroup{}}
+}
+
+func NewStreamGroup(lastID StreamID, entriesRead int64) *StreamGroup {
+	return &StreamGroup{
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		PEL:         map[StreamID]*StreamNACK{},
+		Consumers:   map[string]*StreamConsumer{},
+	}
+}
+
 // ----------------------------------------------------------------------------
@@ -2,14 +2,20 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
 	"errors"
+	"hash/fnv"
 	"io"
+	"maps"
 	"math"
 	"strconv"
 	"strings"
 	"time"
 
-	radix "github.com/elordeiro/redis-server/radix"
+	listpack "github.com/elordeiro/redis-server/listpack"
+	zset "github.com/elordeiro/redis-server/zset"
 	"golang.org/x/exp/constraints"
 )
 
@@ -63,6 +69,16 @@ func ToResp(values ...string) *RESP {
 	return resp
 }
 
+// parseInt parses an integer argument, returning the standard error response
+// if it is not a valid integer
+func parseInt(value string) (int, *RESP) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, ErrResp("ERR value is not an integer or out of range")
+	}
+	return n, nil
+}
+
 // ----------------------------------------------------------------------------
 
 // Predefined responses -------------------------------------------------------
@@ -74,10 +90,21 @@ func NullResp() *RESP {
 	return &RESP{Type: NULL}
 }
 
+func NullArrayResp() *RESP {
+	return &RESP{Type: NULL_ARRAY}
+}
+
 func ErrResp(err string) *RESP {
 	return &RESP{Type: ERROR, Value: err}
 }
 
+func WrongTypeResp() *RESP {
+	return &RESP{
+		Type:  ERROR,
+		Value: "WRONGTYPE Operation against a key holding the wrong kind of value",
+	}
+}
+
 func QueuedResp() *RESP {
 	return &RESP{
 		Type:  STRING,
@@ -117,6 +144,338 @@ func Integer[T constraints.Signed](i T) *RESP {
 	}
 }
 
+// parseExpireTime parses the value of an EX, PX, EXAT or PXAT option into an
+// absolute unix time in milliseconds
+func parseExpireTime(opt, value, cmd string) (int64, *RESP) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, ErrResp("ERR value is not an integer or out of range")
+	}
+	if n <= 0 {
+		return 0, ErrResp("ERR invalid expire time in '" + cmd + "' command")
+	}
+	n, ok := toUnixMilli(n, opt == "EX" || opt == "EXAT", opt == "EX" || opt == "PX")
+	if !ok {
+		return 0, ErrResp("ERR invalid expire time in '" + cmd + "' command")
+	}
+	return n, nil
+}
+
+// toUnixMilli converts an expiry given in seconds or milliseconds, either
+// relative to now or absolute, to a unix time in milliseconds. Reports false
+// if the result overflows.
+func toUnixMilli(n int64, seconds, relative bool) (int64, bool) {
+	if seconds {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return 0, false
+		}
+		n *= 1000
+	}
+	if relative {
+		now := time.Now().UnixMilli()
+		if n > math.MaxInt64-now {
+			return 0, false
+		}
+		n += now
+	}
+	return n, true
+}
+
+// formatFloat formats a float the way Redis replies with scores: integral
+// values without a fraction and infinities as "inf" and "-inf"
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f == math.Trunc(f) && math.Abs(f) < 1<<53:
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// ----------------------------------------------------------------------------
+
+// Keyspace helpers -----------------------------------------------------------
+// typeOf returns the type name of the value stored at key.
+// Caller must hold SETsMu.
+func (db *Database) typeOf(key string) string {
+	if _, ok := db.SETs[key]; ok {
+		return "string"
+	}
+	if _, ok := db.LISTs[key]; ok {
+		return "list"
+	}
+	if _, ok := db.HSETs[key]; ok {
+		return "hash"
+	}
+	if _, ok := db.SADDs[key]; ok {
+		return "set"
+	}
+	if _, ok := db.ZADDs[key]; ok {
+		return "zset"
+	}
+	db.XADDsMu.RLock()
+	_, ok := db.XADDs[key]
+	db.XADDsMu.RUnlock()
+	if ok {
+		return "stream"
+	}
+	return "none"
+}
+
+// allKeys returns the keys of every keyspace. Caller must hold SETsMu.
+func (db *Database) allKeys() []string {
+	keys := make([]string, 0, len(db.SETs)+len(db.LISTs)+len(db.HSETs)+len(db.SADDs)+len(db.ZADDs))
+	for k := range db.SETs {
+		keys = append(keys, k)
+	}
+	for k := range db.LISTs {
+		keys = append(keys, k)
+	}
+	for k := range db.HSETs {
+		keys = append(keys, k)
+	}
+	for k := range db.SADDs {
+		keys = append(keys, k)
+	}
+	for k := range db.ZADDs {
+		keys = append(keys, k)
+	}
+	db.XADDsMu.RLock()
+	for k := range db.XADDs {
+		keys = append(keys, k)
+	}
+	db.XADDsMu.RUnlock()
+	return keys
+}
+
+// getValue returns the value stored at key whatever its type, or nil if the
+// key does not exist. Caller must hold SETsMu.
+func (db *Database) getValue(key string) any {
+	if value, ok := db.SETs[key]; ok {
+		return value
+	}
+	if value, ok := db.LISTs[key]; ok {
+		return value
+	}
+	if value, ok := db.HSETs[key]; ok {
+		return value
+	}
+	if value, ok := db.SADDs[key]; ok {
+		return value
+	}
+	if value, ok := db.ZADDs[key]; ok {
+		return value
+	}
+	db.XADDsMu.RLock()
+	defer db.XADDsMu.RUnlock()
+	if value, ok := db.XADDs[key]; ok {
+		return value
+	}
+	return nil
+}
+
+// setValue stores value at key in the keyspace of its type. Strings may be
+// given as a string or as a []byte, which is stored without copying. The key
+// must not exist or must hold a value of the same type. Caller must hold
+// SETsMu.
+func (db *Database) setValue(key string, value any) {
+	db.KEYs.Add(key, scanHash(key))
+	switch value := value.(type) {
+	case string:
+		db.SETs[key] = []byte(value)
+	case []byte:
+		db.SETs[key] = value
+	case *list.List:
+		db.LISTs[key] = value
+	case map[string]string:
+		db.HSETs[key] = value
+	case *Set:
+		db.SADDs[key] = value
+	case *zset.ZSet:
+		db.ZADDs[key] = value
+	case *Stream:
+		db.XADDsMu.Lock()
+		db.XADDs[key] = value
+		db.XADDsMu.Unlock()
+	}
+}
+
+// copyValue returns a deep copy of a value returned by getValue
+func copyValue(value any) any {
+	switch value := value.(type) {
+	case []byte:
+		return bytes.Clone(value)
+	case *list.List:
+		l := list.New()
+		l.PushBackList(value)
+		return l
+	case map[string]string:
+		return maps.Clone(value)
+	case *Set:
+		return value.Clone()
+	case *zset.ZSet:
+		return value.Clone()
+	case *Stream:
+		return value.Clone()
+	}
+	return value
+}
+
+// freeValue releases the contents of a value returned by getValue. The
+// garbage collector reclaims the memory either way, but clearing a large
+// container on a background goroutine keeps that work off the command path.
+func freeValue(value any) {
+	switch value := value.(type) {
+	case *list.List:
+		value.Init()
+	case map[string]string:
+		clear(value)
+	case *Set:
+		clear(value.members)
+		value.ints = nil
+	}
+}
+
+// scanHash returns the position of key in the SCAN order. Hashes are kept to
+// 53 bits so they are exact as sorted set scores.
+func scanHash(key string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64() >> 11)
+}
+
+// expireIfNeeded deletes key if its expiry time has passed and reports whether
+// it did. Caller must hold SETsMu.
+func (db *Database) expireIfNeeded(key string) bool {
+	exp, ok := db.EXPs[key]
+	if !ok || time.Now().UnixMilli() < exp {
+		return false
+	}
+	db.deleteKey(key)
+	if db.Expired != nil {
+		db.Expired(key)
+	}
+	return true
+}
+
+// deleteKey removes key from every keyspace. Caller must hold SETsMu.
+func (db *Database) deleteKey(key string) {
+	delete(db.SETs, key)
+	delete(db.EXPs, key)
+	delete(db.LISTs, key)
+	delete(db.HSETs, key)
+	delete(db.SADDs, key)
+	delete(db.ZADDs, key)
+	db.KEYs.Remove(key)
+	db.XADDsMu.Lock()
+	delete(db.XADDs, key)
+	db.XADDsMu.Unlock()
+}
+
+// ----------------------------------------------------------------------------
+
+// Glob matching --------------------------------------------------------------
+// Patterns nested deeper than this never match, bounding the recursion
+const maxGlobNesting = 1000
+
+// stringMatch reports whether str matches a glob-style pattern, with the same
+// semantics as Redis. "*" matches any run of characters, "?" any single
+// character and "[...]" a character class, which may contain ranges and be
+// negated with "^". A backslash escapes the next character.
+func stringMatch(pattern, str string) bool {
+	skipLonger := false
+	return globMatch(pattern, str, &skipLonger, 0)
+}
+
+// globMatch implements stringMatch. skipLonger is set once a "*" has failed
+// to match with every remaining suffix of the string, in which case letting an
+// outer "*" consume more characters can't help either.
+func globMatch(pattern, str string, skipLonger *bool, nesting int) bool {
+	if nesting > maxGlobNesting {
+		return false
+	}
+
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(str) > 0 {
+				if globMatch(pattern[1:], str, skipLonger, nesting+1) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+				str = str[1:]
+			}
+			*skipLonger = true
+			return false
+		case '?':
+			str = str[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					match = match || pattern[0] == str[0]
+				case len(pattern) >= 3 && pattern[1] == '-':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					match = match || (str[0] >= lo && str[0] <= hi)
+					pattern = pattern[2:]
+				default:
+					match = match || pattern[0] == str[0]
+				}
+				pattern = pattern[1:]
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if pattern[0] != str[0] {
+				return false
+			}
+			str = str[1:]
+		}
+
+		// An unterminated character class ends the pattern
+		if len(pattern) > 0 {
+			pattern = pattern[1:]
+		}
+		if len(str) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+		}
+	}
+	return len(pattern) == 0 && len(str) == 0
+}
+
 // ----------------------------------------------------------------------------
 
 // Handshake helpers ----------------------------------------------------------
@@ -180,16 +539,6 @@ func Psync(replId, offset int) *RESP {
 	}
 }
 
-// Can be used for handshake stage 3 as Master
-const EmptyRBD = "524544495330303131fa0972656469732d76657205372e322e30fa0a72656469732d62697473c040fa056374696d65c26d08bc65fa08757365642d6d656dc2b0c41000fa08616f662d62617365c000fff06e3bfec0ff5aa2"
-
-func getRDB() *RESP {
-	return &RESP{
-		Type:  RDB,
-		Value: EmptyRBD,
-	}
-}
-
 func psync(mrid string, mros int) *RESP {
 	return &RESP{
 		Type:  STRING,
@@ -255,150 +604,555 @@ func decodeSize(r *bufio.Reader) (int, error) {
 		}
 		return int(bt&0x3F)<<8 | int(next), nil
 	case 2:
-		next4 := make([]byte, 4)
-		_, err := io.ReadFull(r, next4)
+		// 0x80 is followed by a 32 bit length, 0x81 by a 64 bit length
+		next := make([]byte, 4)
+		if bt == 0x81 {
+			next = make([]byte, 8)
+		}
+		_, err := io.ReadFull(r, next)
 		if err != nil {
 			return 0, err
 		}
-		return int(next4[0])<<24 | int(next4[1])<<16 | int(next4[2])<<8 | int(next4[3]), nil
+		size := 0
+		for _, b := range next {
+			size = size<<8 | int(b)
+		}
+		return size, nil
 	default:
 		return 0, errors.New("error decoding size bytes")
 	}
 }
 
 func decodeString(r *bufio.Reader) (string, error) {
-	bt, _ := r.ReadByte()
+	bt, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
 	switch {
 	case bt < 0xc0:
-		str := make([]byte, int(bt))
-		io.ReadFull(r, str)
+		r.UnreadByte()
+		size, err := decodeSize(r)
+		if err != nil {
+			return "", err
+		}
+		str := make([]byte, size)
+		_, err = io.ReadFull(r, str)
+		if err != nil {
+			return "", err
+		}
 		return string(str), nil
 	case bt == 0xC0:
 		next, _ := r.ReadByte()
-		return strconv.Itoa(int(next)), nil
+		return strconv.Itoa(int(int8(next))), nil
 	case bt == 0xC1:
 		next2 := make([]byte, 2)
 		_, err := io.ReadFull(r, next2)
 		if err != nil {
 			return "", err
 		}
-		return strconv.Itoa(int(next2[1])<<8 | int(next2[0])), nil
+		return strconv.Itoa(int(int16(next2[1])<<8 | int16(next2[0]))), nil
 	case bt == 0xC2:
 		next4 := make([]byte, 4)
 		_, err := io.ReadFull(r, next4)
 		if err != nil {
 			return "", err
 		}
-		return strconv.Itoa(int(next4[3])<<24 | int(next4[2])<<16 | int(next4[1])<<8 | int(next4[0])), nil
+		return strconv.Itoa(int(int32(next4[3])<<24 | int32(next4[2])<<16 | int32(next4[1])<<8 | int32(next4[0]))), nil
 	case bt == 0xC3:
-		return "", errors.New("LZF compression not supported")
+		clen, err := decodeSize(r)
+		if err != nil {
+			return "", err
+		}
+		ulen, err := decodeSize(r)
+		if err != nil {
+			return "", err
+		}
+		compressed := make([]byte, clen)
+		_, err = io.ReadFull(r, compressed)
+		if err != nil {
+			return "", err
+		}
+		str, err := lzfDecompress(compressed, ulen)
+		if err != nil {
+			return "", err
+		}
+		return string(str), nil
 	default:
 		return "", errors.New("error decoding string")
 	}
 }
 
-func dedodeTime(r *bufio.Reader) (int64, error) {
-	byt, _ := r.ReadByte()
-	var expiryTime int64 = 0
-	if byt == 0xfc {
-		expiry := make([]byte, 8)
-		_, err := io.ReadFull(r, expiry)
-		if err != nil {
-			return 0, err
+// lzfDecompress expands data compressed with LZF, which Redis uses for
+// strings longer than 20 bytes when rdbcompression is enabled
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// Literal run of ctrl + 1 bytes
+			if i+ctrl+1 > len(in) {
+				return nil, errors.New("error decompressing string")
+			}
+			out = append(out, in[i:i+ctrl+1]...)
+			i += ctrl + 1
+			continue
 		}
-		expiryTime =
-			int64(expiry[7])<<56 | int64(expiry[6])<<48 | int64(expiry[5])<<40 | int64(expiry[4])<<32 |
-				int64(expiry[3])<<24 | int64(expiry[2])<<16 | int64(expiry[1])<<8 | int64(expiry[0])
-	} else if byt == 0xfd {
-		expiry := make([]byte, 4)
-		_, err := io.ReadFull(r, expiry)
-		if err != nil {
-			return 0, err
+
+		// Back reference of length + 2 bytes
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errors.New("error decompressing string")
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.New("error decompressing string")
+		}
+		ref := len(out) - ((ctrl&0x1f)<<8 | int(in[i])) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.New("error decompressing string")
+		}
+		// Copied byte by byte since the reference may overlap the output
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
 		}
-		expiryTime = int64(expiry[3])<<24 | int64(expiry[2])<<16 | int64(expiry[1])<<8 | int64(expiry[0])
-	} else {
-		r.UnreadByte()
-		return 0, nil
 	}
-	return expiryTime, nil
+	if len(out) != outLen {
+		return nil, errors.New("error decompressing string")
+	}
+	return out, nil
 }
 
-// ----------------------------------------------------------------------------
+// decodeZiplist returns the entries of a ziplist, the encoding used for small
+// collections before Redis 7
+func decodeZiplist(zl []byte) ([]string, error) {
+	if len(zl) < 11 {
+		return nil, errors.New("invalid ziplist")
+	}
+	values := []string{}
+	pos := 10
+	for pos < len(zl) && zl[pos] != 0xFF {
+		// Skip the length of the previous entry
+		if zl[pos] == 0xFE {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(zl) {
+			return nil, errors.New("invalid ziplist")
+		}
 
-// Stream helpers ------------------------------------------------------------
-func GetTopEntry(stream *radix.Radix) (int64, int64) {
-	top, _ := stream.Find("0-0")
-	return top.(*StreamTop).Time, top.(*StreamTop).Seq
-}
-
-func validateEntryID(stream *radix.Radix, key string) (int64, int64, error) {
-	if key == "*" {
-		time := time.Now().UnixMilli()
-		topTime, topSeq := GetTopEntry(stream)
-		var seq int64
-		if time == topTime {
-			seq = topSeq + 1
+		enc := zl[pos]
+		var header, size int
+		isInt := true
+		switch {
+		case enc>>6 == 0:
+			header, size, isInt = 1, int(enc&0x3F), false
+		case enc>>6 == 1 && pos+2 <= len(zl):
+			header, size, isInt = 2, int(enc&0x3F)<<8|int(zl[pos+1]), false
+		case enc == 0x80 && pos+5 <= len(zl):
+			header, size, isInt = 5, int(binary.BigEndian.Uint32(zl[pos+1:])), false
+		case enc == 0xC0:
+			header, size = 1, 2
+		case enc == 0xD0:
+			header, size = 1, 4
+		case enc == 0xE0:
+			header, size = 1, 8
+		case enc == 0xF0:
+			header, size = 1, 3
+		case enc == 0xFE:
+			header, size = 1, 1
+		case enc > 0xF0 && enc < 0xFE:
+			// Immediate 4 bit integer between 0 and 12
+			header, size = 1, 0
+		default:
+			return nil, errors.New("invalid ziplist")
+		}
+		if pos+header+size > len(zl) {
+			return nil, errors.New("invalid ziplist")
+		}
+
+		data := zl[pos+header : pos+header+size]
+		switch {
+		case !isInt:
+			values = append(values, string(data))
+		case size == 0:
+			values = append(values, strconv.Itoa(int(enc&0x0F)-1))
+		default:
+			var u uint64
+			for i := size - 1; i >= 0; i-- {
+				u = u<<8 | uint64(data[i])
+			}
+			shift := 64 - 8*size
+			values = append(values, strconv.FormatInt(int64(u<<shift)>>shift, 10))
+		}
+		pos += header + size
+	}
+	return values, nil
+}
+
+// decodeValue reads a value of the given RDB type and stores it at key.
+// Caller must hold SETsMu.
+func (db *Database) decodeValue(r *bufio.Reader, typ byte, key string) error {
+	switch typ {
+	case RDB_STRING:
+		value, err := decodeString(r)
+		if err != nil {
+			return err
+		}
+		db.setValue(key, value)
+	case RDB_HASH:
+		size, err := decodeSize(r)
+		if err != nil {
+			return err
+		}
+		hash := make(map[string]string, size)
+		for i := 0; i < size; i++ {
+			field, err := decodeString(r)
+			if err != nil {
+				return err
+			}
+			value, err := decodeString(r)
+			if err != nil {
+				return err
+			}
+			hash[field] = value
+		}
+		db.setValue(key, hash)
+	case RDB_HASH_ZIPLIST, RDB_HASH_LISTPACK:
+		blob, err := decodeString(r)
+		if err != nil {
+			return err
+		}
+		var entries []string
+		if typ == RDB_HASH_ZIPLIST {
+			entries, err = decodeZiplist([]byte(blob))
 		} else {
-			seq = 0
+			entries, err = listpack.Decode([]byte(blob))
+		}
+		if err != nil {
+			return err
+		}
+		hash := make(map[string]string, len(entries)/2)
+		for i := 0; i+1 < len(entries); i += 2 {
+			hash[entries[i]] = entries[i+1]
+		}
+		db.setValue(key, hash)
+	case RDB_SET:
+		size, err := decodeSize(r)
+		if err != nil {
+			return err
+		}
+		set := NewSet()
+		for i := 0; i < size; i++ {
+			member, err := decodeString(r)
+			if err != nil {
+				return err
+			}
+			set.Add(member)
+		}
+		db.setValue(key, set)
+	case RDB_SET_INTSET, RDB_SET_LISTPACK:
+		blob, err := decodeString(r)
+		if err != nil {
+			return err
+		}
+		var members []string
+		if typ == RDB_SET_INTSET {
+			members, err = decodeIntset([]byte(blob))
+		} else {
+			members, err = listpack.Decode([]byte(blob))
+		}
+		if err != nil {
+			return err
+		}
+		set := NewSet()
+		for _, member := range members {
+			set.Add(member)
+		}
+		db.setValue(key, set)
+	case RDB_ZSET_2:
+		size, err := decodeSize(r)
+		if err != nil {
+			return err
+		}
+		z := zset.NewZSet()
+		for i := 0; i < size; i++ {
+			member, err := decodeString(r)
+			if err != nil {
+				return err
+			}
+			score, err := decodeDouble(r)
+			if err != nil {
+				return err
+			}
+			z.Add(member, score)
+		}
+		db.setValue(key, z)
+	case RDB_ZSET_LISTPACK:
+		blob, err := decodeString(r)
+		if err != nil {
+			return err
+		}
+		entries, err := listpack.Decode([]byte(blob))
+		if err != nil {
+			return err
+		}
+		z := zset.NewZSet()
+		for i := 0; i+1 < len(entries); i += 2 {
+			score, err := strconv.ParseFloat(entries[i+1], 64)
+			if err != nil {
+				return err
+			}
+			z.Add(entries[i], score)
+		}
+		db.setValue(key, z)
+	case RDB_LIST_QUICKLIST_2:
+		size, err := decodeSize(r)
+		if err != nil {
+			return err
 		}
-		return time, seq, nil
+		l := list.New()
+		for i := 0; i < size; i++ {
+			container, err := decodeSize(r)
+			if err != nil {
+				return err
+			}
+			blob, err := decodeString(r)
+			if err != nil {
+				return err
+			}
+			// Plain nodes hold a single large element
+			if container == RDB_QUICKLIST_NODE_PLAIN {
+				l.PushBack(blob)
+				continue
+			}
+			elements, err := listpack.Decode([]byte(blob))
+			if err != nil {
+				return err
+			}
+			for _, element := range elements {
+				l.PushBack(element)
+			}
+		}
+		db.setValue(key, l)
+	case RDB_STREAM_LISTPACKS_2, RDB_STREAM_LISTPACKS_3:
+		stream, err := decodeStream(r, typ)
+		if err != nil {
+			return err
+		}
+		db.setValue(key, stream)
+	default:
+		return errors.New("unsupported value type " + strconv.Itoa(int(typ)))
 	}
+	return nil
+}
 
-	if key == "0-0" {
-		return 0, 0, errors.New("ERR The ID specified in XADD must be greater than 0-0")
+// decodeStream reads a stream written by writeStream. Streams of the older
+// format have no active time for consumers, which is taken to be the seen
+// time like Redis does.
+func decodeStream(r *bufio.Reader, typ byte) (*Stream, error) {
+	stream := NewStream()
+	nodes, err := decodeSize(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < nodes; i++ {
+		master, err := decodeString(r)
+		if err != nil {
+			return nil, err
+		}
+		node, err := decodeString(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(master) != 16 {
+			return nil, errors.New("invalid stream node key")
+		}
+		stream.Nodes.Insert(master, []byte(node))
 	}
 
-	parts := strings.Split(key, "-")
-	if len(parts) != 2 {
-		return 0, 0, errors.New("invalid stream key")
+	// Length, last ID, first ID, max deleted ID and entries added
+	var fields [8]int
+	for i := range fields {
+		if fields[i], err = decodeSize(r); err != nil {
+			return nil, err
+		}
 	}
+	stream.Length = fields[0]
+	stream.LastID = StreamID{uint64(fields[1]), uint64(fields[2])}
+	stream.MaxDeletedID = StreamID{uint64(fields[5]), uint64(fields[6])}
+	stream.EntriesAdded = int64(fields[7])
 
-	topTime, topSeq := GetTopEntry(stream)
-	time, _ := strconv.ParseInt(parts[0], 10, 64)
-	if time < topTime {
-		return 0, 0, errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	groups, err := decodeSize(r)
+	if err != nil {
+		return nil, err
 	}
+	for i := 0; i < groups; i++ {
+		name, err := decodeString(r)
+		if err != nil {
+			return nil, err
+		}
+		var fields [3]int
+		for j := range fields {
+			if fields[j], err = decodeSize(r); err != nil {
+				return nil, err
+			}
+		}
+		group := NewStreamGroup(StreamID{uint64(fields[0]), uint64(fields[1])}, int64(fields[2]))
+		stream.Groups[name] = group
 
-	var seq int64
-	if parts[1] == "*" {
-		if time == topTime {
-			seq = topSeq + 1
-		} else {
-			seq = 0
+		pending, err := decodeSize(r)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < pending; j++ {
+			id, err := decodeStreamIDKey(r)
+			if err != nil {
+				return nil, err
+			}
+			deliveryTime, err := decodeMillis(r)
+			if err != nil {
+				return nil, err
+			}
+			deliveryCount, err := decodeSize(r)
+			if err != nil {
+				return nil, err
+			}
+			group.PEL[id] = &StreamNACK{DeliveryTime: deliveryTime, DeliveryCount: int64(deliveryCount)}
+		}
+
+		consumers, err := decodeSize(r)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < consumers; j++ {
+			name, err := decodeString(r)
+			if err != nil {
+				return nil, err
+			}
+			consumer := &StreamConsumer{Name: name, PEL: map[StreamID]*StreamNACK{}}
+			if consumer.SeenTime, err = decodeMillis(r); err != nil {
+				return nil, err
+			}
+			consumer.ActiveTime = consumer.SeenTime
+			if typ == RDB_STREAM_LISTPACKS_3 {
+				if consumer.ActiveTime, err = decodeMillis(r); err != nil {
+					return nil, err
+				}
+			}
+			group.Consumers[name] = consumer
+
+			pending, err := decodeSize(r)
+			if err != nil {
+				return nil, err
+			}
+			for k := 0; k < pending; k++ {
+				id, err := decodeStreamIDKey(r)
+				if err != nil {
+					return nil, err
+				}
+				nack, ok := group.PEL[id]
+				if !ok {
+					return nil, errors.New("consumer pending entry not found in group")
+				}
+				nack.Consumer = consumer
+				consumer.PEL[id] = nack
+			}
 		}
-	} else {
-		seq, _ = strconv.ParseInt(parts[1], 10, 64)
 	}
+	return stream, nil
+}
 
-	if time == topTime && seq <= topSeq {
-		return 0, 0, errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+// decodeStreamIDKey reads a stream ID stored as 16 big-endian bytes
+func decodeStreamIDKey(r *bufio.Reader) (StreamID, error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return StreamID{}, err
 	}
+	return streamIDFromKey(string(key)), nil
+}
 
-	return time, seq, nil
+// decodeMillis reads a time in milliseconds stored as 8 little-endian bytes
+func decodeMillis(r *bufio.Reader) (int64, error) {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(b)), nil
 }
 
-func splitEntryId(id string) (int64, int64, error) {
-	if id == "-" {
-		return math.MinInt64, math.MinInt64, nil
+// decodeDouble reads a float stored as 8 little-endian bytes
+func decodeDouble(r *bufio.Reader) (float64, error) {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
 	}
-	if id == "+" {
-		return math.MaxInt64, math.MaxInt64, nil
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+// decodeIntset returns the members of an intset, the encoding Redis uses for
+// small sets of integers
+func decodeIntset(is []byte) ([]string, error) {
+	if len(is) < 8 {
+		return nil, errors.New("invalid intset")
 	}
-	parts := strings.Split(id, "-")
-	time, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil {
-		return 0, 0, err
+	size := int(binary.LittleEndian.Uint32(is))
+	length := int(binary.LittleEndian.Uint32(is[4:]))
+	if size != 2 && size != 4 && size != 8 || len(is) != 8+size*length {
+		return nil, errors.New("invalid intset")
 	}
-	if len(parts) == 1 {
-		return time, 0, nil
+	members := make([]string, 0, length)
+	for i := 8; i < len(is); i += size {
+		var n int64
+		switch size {
+		case 2:
+			n = int64(int16(binary.LittleEndian.Uint16(is[i:])))
+		case 4:
+			n = int64(int32(binary.LittleEndian.Uint32(is[i:])))
+		default:
+			n = int64(binary.LittleEndian.Uint64(is[i:]))
+		}
+		members = append(members, strconv.FormatInt(n, 10))
 	}
-	seq, err := strconv.ParseInt(parts[1], 10, 64)
-	if err != nil {
-		return 0, 0, err
+	return members, nil
+}
+
+func dedodeTime(r *bufio.Reader) (int64, error) {
+	byt, _ := r.ReadByte()
+	var expiryTime int64 = 0
+	if byt == 0xfc {
+		expiry := make([]byte, 8)
+		_, err := io.ReadFull(r, expiry)
+		if err != nil {
+			return 0, err
+		}
+		expiryTime =
+			int64(expiry[7])<<56 | int64(expiry[6])<<48 | int64(expiry[5])<<40 | int64(expiry[4])<<32 |
+				int64(expiry[3])<<24 | int64(expiry[2])<<16 | int64(expiry[1])<<8 | int64(expiry[0])
+	} else if byt == 0xfd {
+		expiry := make([]byte, 4)
+		_, err := io.ReadFull(r, expiry)
+		if err != nil {
+			return 0, err
+		}
+		// Seconds
+		expiryTime = int64(expiry[3])<<24 | int64(expiry[2])<<16 | int64(expiry[1])<<8 | int64(expiry[0])
+		expiryTime *= 1000
+	} else {
+		r.UnreadByte()
+		return 0, nil
 	}
-	return time, seq, nil
+	return expiryTime, nil
 }
 
+// ----------------------------------------------------------------------------
+
+// Stream helpers ------------------------------------------------------------
 func intToStr[T constraints.Signed](num T) string {
 	return strconv.Itoa(int(num))
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLzfDecompress(t *testing.T) {
+	// A literal "a" followed by a back reference repeating it 20 times
+	out, err := lzfDecompress([]byte{0x00, 'a', 0xE0, 0x0B, 0x00}, 21)
+	if err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	if string(out) != strings.Repeat("a", 21) {
+		t.Errorf("Expected 21 a's, got %q", out)
+	}
+
+	// Test a reference before the start of the output
+	_, err = lzfDecompress([]byte{0xE0, 0x0B, 0x00}, 20)
+	if err == nil {
+		t.Error("Expected error for an invalid back reference, but got nil")
+	}
+}
+
+func TestDecodeZiplist(t *testing.T) {
+	zl := []byte{
+		0x13, 0x00, 0x00, 0x00, // total bytes
+		0x0E, 0x00, 0x00, 0x00, // offset of the last entry
+		0x03, 0x00, // number of entries
+		0x00, 0x02, 'h', 'i', // 6 bit length string
+		0x04, 0xF3, // 4 bit immediate integer 2
+		0x02, 0xFE, 0x9C, // 8 bit integer -100
+		0xFF,
+	}
+	values, err := decodeZiplist(zl)
+	if err != nil {
+		t.Fatalf("Failed to decode ziplist: %v", err)
+	}
+	expected := []string{"hi", "2", "-100"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestStringMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"*", "anything", true},
+		{"user:*:session", "user:42:session", true},
+		{"user:*:session", "user:42:profile", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[b-a]llo", "hallo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{`h[\]]llo`, "h]llo", true},
+		{"a*", "a", true},
+		{"a*b", "a", false},
+		{"h[el", "he", true},
+		{"*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 100), false},
+	}
+	for _, test := range tests {
+		if got := stringMatch(test.pattern, test.str); got != test.match {
+			t.Errorf("stringMatch(%q, %q) = %v, expected %v", test.pattern, test.str, got, test.match)
+		}
+	}
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	zset "github.com/elordeiro/redis-server/zset"
+)
+
+// Sorted set commands --------------------------------------------------------
+func (s *Server) zadd(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 {
+		return ErrResp("ERR wrong number of arguments for 'zadd' command")
+	}
+
+	key := args[0].Value
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return ErrResp("ERR syntax error")
+	}
+	if nx && xx {
+		return ErrResp("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && lt) || (nx && (gt || lt)) {
+		return ErrResp("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) > 2 {
+		return ErrResp("ERR INCR option supports a single increment-element pair")
+	}
+
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, errResp := parseScore(pairs[2*j].Value)
+		if errResp != nil {
+			return errResp
+		}
+		scores[j] = score
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		if xx {
+			if incr {
+				return NullResp()
+			}
+			return Integer(0)
+		}
+		z = zset.NewZSet()
+		db.setValue(key, z)
+	}
+	defer func() {
+		if z.Len() == 0 {
+			db.deleteKey(key)
+		}
+	}()
+
+	added, changed := 0, 0
+	var result float64
+	for j, score := range scores {
+		member := pairs[2*j+1].Value
+		current, exists := z.Score(member)
+		if (exists && nx) || (!exists && xx) {
+			if incr {
+				return NullResp()
+			}
+			continue
+		}
+
+		if incr && exists {
+			score += current
+			if math.IsNaN(score) {
+				return ErrResp("ERR resulting score is not a number (NaN)")
+			}
+		}
+
+		if exists {
+			if (gt && score <= current) || (lt && score >= current) {
+				if incr {
+					return NullResp()
+				}
+				continue
+			}
+			if score != current {
+				z.Add(member, score)
+				changed++
+			}
+		} else {
+			z.Add(member, score)
+			added++
+		}
+		result = score
+	}
+	s.Dirty.Add(int64(added + changed))
+
+	if added > 0 {
+		s.signalKeyReady(db, key)
+	}
+
+	if incr {
+		return BulkString(formatFloat(result))
+	}
+	if ch {
+		return Integer(added + changed)
+	}
+	return Integer(added)
+}
+
+func (s *Server) zincrby(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'zincrby' command")
+	}
+	return s.zadd(db, []*RESP{args[0], BulkString("INCR"), args[1], args[2]})
+}
+
+func (s *Server) zrem(db *Database, args []*RESP) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'zrem' command")
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return Integer(0)
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if z.Remove(member.Value) {
+			removed++
+		}
+	}
+	if z.Len() == 0 {
+		db.deleteKey(key)
+	}
+	s.Dirty.Add(int64(removed))
+	return Integer(removed)
+}
+
+func (s *Server) zcard(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 {
+		return ErrResp("ERR wrong number of arguments for 'zcard' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return Integer(0)
+	}
+	return Integer(z.Len())
+}
+
+func (s *Server) zscore(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'zscore' command")
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return NullResp()
+	}
+	score, ok := z.Score(args[1].Value)
+	if !ok {
+		return NullResp()
+	}
+	return BulkString(formatFloat(score))
+}
+
+func (s *Server) zrank(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 && len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'zrank' command")
+	}
+	return s.rank(db, args, false)
+}
+
+func (s *Server) zrevrank(db *Database, args []*RESP) *RESP {
+	if len(args) != 2 && len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'zrevrank' command")
+	}
+	return s.rank(db, args, true)
+}
+
+func (s *Server) rank(db *Database, args []*RESP, reverse bool) *RESP {
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2].Value) != "WITHSCORE" {
+			return ErrResp("ERR syntax error")
+		}
+		withScore = true
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return NullResp()
+	}
+
+	rank, ok := z.Rank(args[1].Value, reverse)
+	if !ok {
+		return NullResp()
+	}
+	if withScore {
+		score, _ := z.Score(args[1].Value)
+		return &RESP{Type: ARRAY, Values: []*RESP{Integer(rank), BulkString(formatFloat(score))}}
+	}
+	return Integer(rank)
+}
+
+func (s *Server) zcount(db *Database, args []*RESP) *RESP {
+	if len(args) != 3 {
+		return ErrResp("ERR wrong number of arguments for 'zcount' command")
+	}
+
+	r, errResp := parseScoreRange(args[1].Value, args[2].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(args[0].Value)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return Integer(0)
+	}
+	return Integer(z.Count(r))
+}
+
+func (s *Server) zrange(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 {
+		return ErrResp("ERR wrong number of arguments for 'zrange' command")
+	}
+
+	query := &zrangeQuery{key: args[0].Value, start: args[1].Value, stop: args[2].Value, count: -1}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "BYSCORE":
+			query.by = ZRANGE_SCORE
+		case "BYLEX":
+			query.by = ZRANGE_LEX
+		case "REV":
+			query.reverse = true
+		case "WITHSCORES":
+			query.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			if errResp := query.parseLimit(args[i+1].Value, args[i+2].Value); errResp != nil {
+				return errResp
+			}
+			i += 2
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+
+	if query.limited && query.by == ZRANGE_RANK {
+		return ErrResp("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if query.withScores && query.by == ZRANGE_LEX {
+		return ErrResp("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	// With REV the range is given from max to min
+	if query.reverse && query.by != ZRANGE_RANK {
+		query.start, query.stop = query.stop, query.start
+	}
+	return s.zrangeGeneric(db, query)
+}
+
+func (s *Server) zrangebyscore(db *Database, args []*RESP) *RESP {
+	if len(args) < 3 {
+		return ErrResp("ERR wrong number of arguments for 'zrangebyscore' command")
+	}
+
+	query := &zrangeQuery{key: args[0].Value, start: args[1].Value, stop: args[2].Value, by: ZRANGE_SCORE, count: -1}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Value) {
+		case "WITHSCORES":
+			query.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return ErrResp("ERR syntax error")
+			}
+			if errResp := query.parseLimit(args[i+1].Value, args[i+2].Value); errResp != nil {
+				return errResp
+			}
+			i += 2
+		default:
+			return ErrResp("ERR syntax error")
+		}
+	}
+	return s.zrangeGeneric(db, query)
+}
+
+func (s *Server) zpopmin(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 && len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'zpopmin' command")
+	}
+	return s.zpop(db, args, false)
+}
+
+func (s *Server) zpopmax(db *Database, args []*RESP) *RESP {
+	if len(args) != 1 && len(args) != 2 {
+		return ErrResp("ERR wrong number of arguments for 'zpopmax' command")
+	}
+	return s.zpop(db, args, true)
+}
+
+func (s *Server) zpop(db *Database, args []*RESP, max bool) *RESP {
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1].Value)
+		if err != nil || n < 0 {
+			return ErrResp("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	key := args[0].Value
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(key)
+	if errResp != nil {
+		return errResp
+	}
+	if z == nil {
+		return ToResp()
+	}
+	elements := db.popElements(key, z, count, max)
+	s.Dirty.Add(int64(len(elements)))
+	return elementsResp(elements, true)
+}
+
+func (s *Server) bzpopmin(db *Database, args []*RESP, conn *ConnRW) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'bzpopmin' command")
+	}
+	return s.bzpop(db, args, false, conn)
+}
+
+func (s *Server) bzpopmax(db *Database, args []*RESP, conn *ConnRW) *RESP {
+	if len(args) < 2 {
+		return ErrResp("ERR wrong number of arguments for 'bzpopmax' command")
+	}
+	return s.bzpop(db, args, true, conn)
+}
+
+func (s *Server) bzpop(db *Database, args []*RESP, max bool, conn *ConnRW) *RESP {
+	timeout, errResp := parseTimeout(args[len(args)-1].Value)
+	if errResp != nil {
+		return errResp
+	}
+
+	keys := make([]string, len(args)-1)
+	for i := range keys {
+		keys[i] = args[i].Value
+	}
+
+	// Pops the element for a client and propagates the equivalent non-blocking
+	// command, since replicas must never block
+	popCmd := "ZPOPMIN"
+	if max {
+		popCmd = "ZPOPMAX"
+	}
+	popFrom := func(key string, z *zset.ZSet) *RESP {
+		s.propagateCommand(db, ToResp(popCmd, key))
+		s.Dirty.Add(1)
+		e := db.popElements(key, z, 1, max)[0]
+		return ToResp(key, e.Member, formatFloat(e.Score))
+	}
+
+	s.SETsMu.Lock()
+	for _, key := range keys {
+		z, errResp := db.getZSet(key)
+		if errResp != nil {
+			s.SETsMu.Unlock()
+			return errResp
+		}
+		if z != nil {
+			resp := popFrom(key, z)
+			s.SETsMu.Unlock()
+			return resp
+		}
+	}
+	if conn.RedirectRead {
+		s.SETsMu.Unlock()
+		return NullArrayResp()
+	}
+
+	client := &BlockedClient{DB: db, Keys: keys, Ch: make(chan *RESP, 1)}
+	client.Serve = func(key string) *RESP {
+		z, ok := db.ZADDs[key]
+		if !ok {
+			return nil
+		}
+		return popFrom(key, z)
+	}
+	s.blockOn(client)
+	s.SETsMu.Unlock()
+
+	resp := s.waitForKeys(client, timeout, conn)
+	if resp == nil {
+		return NullArrayResp()
+	}
+	return resp
+}
+
+// ----------------------------------------------------------------------------
+
+// Sorted set helpers ---------------------------------------------------------
+// ZRANGE query types
+const (
+	ZRANGE_RANK = iota
+	ZRANGE_SCORE
+	ZRANGE_LEX
+)
+
+type zrangeQuery struct {
+	key        string
+	start      string
+	stop       string
+	by         int
+	reverse    bool
+	withScores bool
+	limited    bool
+	offset     int
+	count      int
+}
+
+func (query *zrangeQuery) parseLimit(offset, count string) *RESP {
+	var errResp *RESP
+	query.offset, errResp = parseInt(offset)
+	if errResp != nil {
+		return errResp
+	}
+	query.count, errResp = parseInt(count)
+	if errResp != nil {
+		return errResp
+	}
+	query.limited = true
+	return nil
+}
+
+// zrangeGeneric runs a range query by rank, score or member.
+func (s *Server) zrangeGeneric(db *Database, query *zrangeQuery) *RESP {
+	var elements []zset.Element
+	var find func(z *zset.ZSet) []zset.Element
+
+	switch query.by {
+	case ZRANGE_RANK:
+		start, errResp := parseInt(query.start)
+		if errResp != nil {
+			return errResp
+		}
+		stop, errResp := parseInt(query.stop)
+		if errResp != nil {
+			return errResp
+		}
+		find = func(z *zset.ZSet) []zset.Element {
+			start, stop, ok := normalizeRange(start, stop, z.Len())
+			if !ok {
+				return nil
+			}
+			return z.RangeByRank(start, stop, query.reverse)
+		}
+	case ZRANGE_SCORE:
+		r, errResp := parseScoreRange(query.start, query.stop)
+		if errResp != nil {
+			return errResp
+		}
+		find = func(z *zset.ZSet) []zset.Element {
+			return z.RangeByScore(r, query.offset, query.count, query.reverse)
+		}
+	case ZRANGE_LEX:
+		r, errResp := parseLexRange(query.start, query.stop)
+		if errResp != nil {
+			return errResp
+		}
+		find = func(z *zset.ZSet) []zset.Element {
+			return z.RangeByLex(r, query.offset, query.count, query.reverse)
+		}
+	}
+	if query.offset < 0 {
+		return ToResp()
+	}
+
+	s.SETsMu.Lock()
+	defer s.SETsMu.Unlock()
+
+	z, errResp := db.getZSet(query.key)
+	if errResp != nil {
+		return errResp
+	}
+	if z != nil {
+		elements = find(z)
+	}
+	return elementsResp(elements, query.withScores)
+}
+
+// popElements pops up to count of the lowest or highest scoring elements and
+// deletes the key once the sorted set is empty. Caller must hold SETsMu.
+func (db *Database) popElements(key string, z *zset.ZSet, count int, max bool) []zset.Element {
+	var elements []zset.Element
+	if max {
+		elements = z.PopMax(count)
+	} else {
+		elements = z.PopMin(count)
+	}
+	if z.Len() == 0 {
+		db.deleteKey(key)
+	}
+	return elements
+}
+
+// elementsResp returns members, each followed by its score if withScores is set
+func elementsResp(elements []zset.Element, withScores bool) *RESP {
+	values := make([]string, 0, len(elements)*2)
+	for _, e := range elements {
+		values = append(values, e.Member)
+		if withScores {
+			values = append(values, formatFloat(e.Score))
+		}
+	}
+	return ToResp(values...)
+}
+
+// getZSet returns the sorted set stored at key, nil if the key does not
+// exist, or a WRONGTYPE error if the key holds another type.
+// Caller must hold SETsMu.
+func (db *Database) getZSet(key string) (*zset.ZSet, *RESP) {
+	db.expireIfNeeded(key)
+	z, ok := db.ZADDs[key]
+	if !ok && db.typeOf(key) != "none" {
+		return nil, WrongTypeResp()
+	}
+	return z, nil
+}
+
+// parseScore parses a score, accepting inf, +inf and -inf
+func parseScore(value string) (float64, *RESP) {
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, ErrResp("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// parseScoreRange parses the min and max of a score range, where a leading
+// "(" makes the bound exclusive
+func parseScoreRange(min, max string) (zset.Range, *RESP) {
+	r := zset.Range{}
+	var err error
+	if strings.HasPrefix(min, "(") {
+		r.MinExclusive = true
+		min = min[1:]
+	}
+	if strings.HasPrefix(max, "(") {
+		r.MaxExclusive = true
+		max = max[1:]
+	}
+	r.Min, err = strconv.ParseFloat(min, 64)
+	if err != nil || math.IsNaN(r.Min) {
+		return r, ErrResp("ERR min or max is not a float")
+	}
+	r.Max, err = strconv.ParseFloat(max, 64)
+	if err != nil || math.IsNaN(r.Max) {
+		return r, ErrResp("ERR min or max is not a float")
+	}
+	return r, nil
+}
+
+// parseLexRange parses the min and max of a member range. Bounds are either
+// "-", "+", or a member prefixed with "[" (inclusive) or "(" (exclusive).
+func parseLexRange(min, max string) (zset.LexRange, *RESP) {
+	r := zset.LexRange{}
+	var minOk, maxOk bool
+	r.Min, r.MinExclusive, minOk = parseLexBound(min)
+	r.Max, r.MaxExclusive, maxOk = parseLexBound(max)
+	if !minOk || !maxOk {
+		return r, ErrResp("ERR min or max not valid string range item")
+	}
+
+	// Nothing sorts after "+" or before "-", so these ranges are empty
+	if min == "+" || max == "-" {
+		return zset.LexRange{MinInf: true, MaxExclusive: true}, nil
+	}
+	r.MinInf = min == "-"
+	r.MaxInf = max == "+"
+	return r, nil
+}
+
+// parseLexBound parses a single bound of a member range
+func parseLexBound(bound string) (string, bool, bool) {
+	switch {
+	case bound == "-" || bound == "+":
+		return "", false, true
+	case strings.HasPrefix(bound, "["):
+		return bound[1:], false, true
+	case strings.HasPrefix(bound, "("):
+		return bound[1:], true, true
+	}
+	return "", false, false
+}
+
+// ----------------------------------------------------------------------------
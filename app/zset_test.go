@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZaddAndZrange(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("ZADD", "zset:range", "1", "a", "2", "b", "3", "c", "2", "bb"))
+	parsedResp, _, err := conn.Buffer.Read()
+	if err != nil {
+		t.Errorf("Failed to read response: %v", err)
+	}
+	if parsedResp.Type != INTEGER || parsedResp.Value != "4" {
+		t.Errorf("Expected 4, got %v", parsedResp)
+	}
+
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"ZRANGE", "zset:range", "0", "-1"}, []string{"a", "b", "bb", "c"}},
+		{[]string{"ZRANGE", "zset:range", "0", "1", "REV", "WITHSCORES"}, []string{"c", "3", "bb", "2"}},
+		{[]string{"ZRANGE", "zset:range", "(1", "+inf", "BYSCORE", "LIMIT", "1", "5"}, []string{"bb", "c"}},
+		{[]string{"ZRANGE", "zset:range", "3", "2", "BYSCORE", "REV"}, []string{"c", "bb", "b"}},
+		{[]string{"ZRANGE", "zset:range", "[b", "(c", "BYLEX"}, []string{"b", "bb"}},
+		{[]string{"ZRANGEBYSCORE", "zset:range", "-inf", "2", "WITHSCORES"}, []string{"a", "1", "b", "2", "bb", "2"}},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ = conn.Buffer.Read()
+		if parsedResp.Type != ARRAY || len(parsedResp.Values) != len(test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.args, test.expected, parsedResp)
+			continue
+		}
+		for i, v := range test.expected {
+			if parsedResp.Values[i].Value != v {
+				t.Errorf("%v: expected %s at index %d, got %v", test.args, v, i, parsedResp.Values[i])
+			}
+		}
+	}
+
+	Write(conn.Writer, ToResp("ZCOUNT", "zset:range", "(1", "3"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != INTEGER || parsedResp.Value != "3" {
+		t.Errorf("Expected 3, got %v", parsedResp)
+	}
+
+	Write(conn.Writer, ToResp("ZREVRANK", "zset:range", "a", "WITHSCORE"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != 2 ||
+		parsedResp.Values[0].Value != "3" || parsedResp.Values[1].Value != "1" {
+		t.Errorf("Expected [3 1], got %v", parsedResp)
+	}
+}
+
+func TestZaddFlags(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("ZADD", "zset:flags", "5", "a"))
+	conn.Buffer.Read()
+
+	tests := []struct {
+		args     []string
+		typ      byte
+		expected string
+	}{
+		{[]string{"ZADD", "zset:flags", "NX", "1", "a", "1", "b"}, INTEGER, "1"},
+		{[]string{"ZADD", "zset:flags", "XX", "CH", "6", "a", "1", "c"}, INTEGER, "1"},
+		{[]string{"ZADD", "zset:flags", "GT", "CH", "4", "a"}, INTEGER, "0"},
+		{[]string{"ZADD", "zset:flags", "LT", "CH", "4", "a"}, INTEGER, "1"},
+		{[]string{"ZADD", "zset:flags", "INCR", "2.5", "a"}, BULK, "6.5"},
+		{[]string{"ZINCRBY", "zset:flags", "-0.5", "a"}, BULK, "6"},
+		{[]string{"ZADD", "zset:flags", "NX", "INCR", "1", "a"}, 0, ""},
+		{[]string{"ZADD", "zset:flags", "NX", "XX", "1", "a"}, ERROR, "ERR XX and NX options at the same time are not compatible"},
+		{[]string{"ZADD", "zset:flags", "GT", "LT", "1", "a"}, ERROR, "ERR GT, LT, and/or NX options at the same time are not compatible"},
+		{[]string{"ZADD", "zset:flags", "INCR", "1", "a", "2", "b"}, ERROR, "ERR INCR option supports a single increment-element pair"},
+		{[]string{"ZADD", "zset:flags", "one", "a"}, ERROR, "ERR value is not a valid float"},
+		{[]string{"ZADD", "zset:flags", "+inf", "a"}, INTEGER, "0"},
+		{[]string{"ZINCRBY", "zset:flags", "-inf", "a"}, ERROR, "ERR resulting score is not a number (NaN)"},
+		{[]string{"ZSCORE", "zset:flags", "a"}, BULK, "inf"},
+		{[]string{"ZREM", "zset:flags", "a", "b", "c"}, INTEGER, "2"},
+		{[]string{"ZCARD", "zset:flags"}, INTEGER, "0"},
+	}
+	for _, test := range tests {
+		Write(conn.Writer, ToResp(test.args...))
+		parsedResp, _, _ := conn.Buffer.Read()
+		if parsedResp.Type != test.typ || parsedResp.Value != test.expected {
+			t.Errorf("%v: expected %s, got %v", test.args, test.expected, parsedResp)
+		}
+	}
+}
+
+func TestZpop(t *testing.T) {
+	createMasterServer("6379")
+	conn := connectToServer("6379")
+	defer conn.Conn.Close()
+
+	Write(conn.Writer, ToResp("ZADD", "zset:pop", "1", "a", "2", "b", "3", "c"))
+	conn.Buffer.Read()
+
+	Write(conn.Writer, ToResp("ZPOPMAX", "zset:pop", "2"))
+	parsedResp, _, _ := conn.Buffer.Read()
+	expected := []string{"c", "3", "b", "2"}
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, parsedResp)
+	}
+	for i, v := range expected {
+		if parsedResp.Values[i].Value != v {
+			t.Errorf("Expected %s at index %d, got %v", v, i, parsedResp.Values[i])
+		}
+	}
+
+	Write(conn.Writer, ToResp("ZPOPMIN", "zset:pop"))
+	conn.Buffer.Read()
+	Write(conn.Writer, ToResp("TYPE", "zset:pop"))
+	parsedResp, _, _ = conn.Buffer.Read()
+	if parsedResp.Value != "none" {
+		t.Errorf("Expected none, got %v", parsedResp)
+	}
+}
+
+func TestBzpopmin(t *testing.T) {
+	createMasterServer("6379")
+	blocked := connectToServer("6379")
+	defer blocked.Conn.Close()
+	adder := connectToServer("6379")
+	defer adder.Conn.Close()
+
+	Write(blocked.Writer, ToResp("BZPOPMIN", "zset:block", "0"))
+	time.Sleep(50 * time.Millisecond)
+
+	Write(adder.Writer, ToResp("ZADD", "zset:block", "2", "b", "1", "a"))
+	adder.Buffer.Read()
+
+	parsedResp, _, err := blocked.Buffer.Read()
+	if err != nil {
+		t.Errorf("Failed to read response: %v", err)
+	}
+	expected := []string{"zset:block", "a", "1"}
+	if parsedResp.Type != ARRAY || len(parsedResp.Values) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, parsedResp)
+	}
+	for i, v := range expected {
+		if parsedResp.Values[i].Value != v {
+			t.Errorf("Expected %s at index %d, got %v", v, i, parsedResp.Values[i])
+		}
+	}
+
+	Write(blocked.Writer, ToResp("BZPOPMIN", "zset:empty", "0.05"))
+	parsedResp, _, _ = blocked.Buffer.Read()
+	if parsedResp.Type != NULL_ARRAY {
+		t.Errorf("Expected nil array, got %v", parsedResp)
+	}
+
+	// Without blocking, as inside MULTI, an empty pop is a nil array as well
+	server := &Server{DBs: []*Database{NewDatabase(0)}}
+	resps := server.Handler(ToResp("BZPOPMAX", "zset:empty", "0"), &ConnRW{RedirectRead: true})
+	if got := string(resps[0].Marshal()); got != "*-1\r\n" {
+		t.Errorf("Expected %q, got %q", "*-1\r\n", got)
+	}
+}
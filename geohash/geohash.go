@@ -0,0 +1,313 @@
+package geohash
+
+import (
+	"math"
+)
+
+// Geohash maps a longitude and latitude to a 52 bit integer by splitting both
+// ranges in half 26 times and interleaving the resulting bits, latitude in the
+// even bits and longitude in the odd ones. Points that are close together
+// share long prefixes, so a sorted set scored by geohash can find every point
+// within an area by scanning the few score ranges of the boxes covering it.
+// Scores are the same as Redis, which only indexes latitudes that the web
+// mercator projection can show.
+
+const (
+	Step = 26
+
+	LonMin = -180.0
+	LonMax = 180.0
+	LatMin = -85.05112878
+	LatMax = 85.05112878
+
+	// EarthRadius is the radius in meters Redis uses for distances
+	EarthRadius = 6372797.560856
+
+	mercatorMax = 20037726.37
+	alphabet    = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// Range is an interval of scores to scan, from Min inclusive to Max exclusive.
+type Range struct {
+	Min uint64
+	Max uint64
+}
+
+// Shape is an area to search centered on Lon and Lat, a circle of Radius
+// meters, or a Width by Height meters box if Box is set.
+type Shape struct {
+	Lon    float64
+	Lat    float64
+	Radius float64
+	Width  float64
+	Height float64
+	Box    bool
+}
+
+// hash is the geohash of a box at a given precision, zero when unused.
+type hash struct {
+	bits uint64
+	step uint
+}
+
+type area struct {
+	minLon, maxLon, minLat, maxLat float64
+}
+
+// Valid reports whether lon and lat can be indexed.
+func Valid(lon, lat float64) bool {
+	return lon >= LonMin && lon <= LonMax && lat >= LatMin && lat <= LatMax
+}
+
+// Encode returns the score of a valid point.
+func Encode(lon, lat float64) uint64 {
+	return encode(lon, lat, Step, LatMin, LatMax).bits
+}
+
+// Decode returns the longitude and latitude at the center of the box of a
+// score.
+func Decode(score uint64) (float64, float64) {
+	a := decode(hash{score, Step})
+	lon := min(max((a.minLon+a.maxLon)/2, LonMin), LonMax)
+	lat := min(max((a.minLat+a.maxLat)/2, LatMin), LatMax)
+	return lon, lat
+}
+
+// String returns the standard 11 character geohash of a score. Standard
+// geohashes cover latitudes from -90 to 90, so the point is encoded again.
+// Scores only have 52 bits, the last character is always 0.
+func String(score uint64) string {
+	lon, lat := Decode(score)
+	bits := encode(lon, lat, Step, -90, 90).bits
+	buf := make([]byte, 11)
+	for i := range 10 {
+		buf[i] = alphabet[bits>>(52-(i+1)*5)&0x1f]
+	}
+	buf[10] = alphabet[0]
+	return string(buf)
+}
+
+// Distance returns the distance in meters between two points with the
+// haversine formula.
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := radians(lat1), radians(lon1)
+	lat2r, lon2r := radians(lat2), radians(lon2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// Avoids the expensive math when the longitudes are the same
+	if v == 0 {
+		return latDistance(lat1, lat2)
+	}
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
+}
+
+// Contains reports whether the shape contains a point and returns the distance
+// to it from the center.
+func (s Shape) Contains(lon, lat float64) (float64, bool) {
+	if !s.Box {
+		distance := Distance(s.Lon, s.Lat, lon, lat)
+		return distance, distance <= s.Radius
+	}
+	// The latitude distance is cheaper so it is checked first
+	if latDistance(lat, s.Lat) > s.Height/2 {
+		return 0, false
+	}
+	if Distance(lon, lat, s.Lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return Distance(s.Lon, s.Lat, lon, lat), true
+}
+
+// Ranges returns the score ranges covering the shape, the box of the center
+// and its neighbours, skipping the ones outside the shape. The center must be
+// valid.
+func (s Shape) Ranges() []Range {
+	minLon, minLat, maxLon, maxLat := s.boundingBox()
+
+	radius := s.Radius
+	if s.Box {
+		radius = math.Sqrt(s.Width*s.Width/4 + s.Height*s.Height/4)
+	}
+	step := estimateStep(radius, s.Lat)
+	center := encode(s.Lon, s.Lat, step, LatMin, LatMax)
+	neighbors := center.neighbors()
+
+	// Near the edges of the center box, the neighbours may not reach the end
+	// of the shape, in which case larger boxes are needed
+	north, south := decode(neighbors[1]), decode(neighbors[2])
+	east, west := decode(neighbors[3]), decode(neighbors[4])
+	if step > 1 && (north.maxLat < maxLat || south.minLat > minLat ||
+		east.maxLon < maxLon || west.minLon > minLon) {
+		step--
+		center = encode(s.Lon, s.Lat, step, LatMin, LatMax)
+		neighbors = center.neighbors()
+	}
+
+	if step >= 2 {
+		a := decode(center)
+		if a.minLat < minLat {
+			neighbors[2], neighbors[7], neighbors[8] = hash{}, hash{}, hash{}
+		}
+		if a.maxLat > maxLat {
+			neighbors[1], neighbors[5], neighbors[6] = hash{}, hash{}, hash{}
+		}
+		if a.minLon < minLon {
+			neighbors[4], neighbors[6], neighbors[8] = hash{}, hash{}, hash{}
+		}
+		if a.maxLon > maxLon {
+			neighbors[3], neighbors[5], neighbors[7] = hash{}, hash{}, hash{}
+		}
+	}
+
+	ranges := []Range{}
+	last := hash{}
+	for _, h := range neighbors {
+		// Very large shapes can have the same neighbour on several sides
+		if h == (hash{}) || h == last {
+			continue
+		}
+		last = h
+		shift := 52 - 2*h.step
+		ranges = append(ranges, Range{h.bits << shift, (h.bits + 1) << shift})
+	}
+	return ranges
+}
+
+// boundingBox returns the smallest and largest longitude and latitude of the
+// shape.
+func (s Shape) boundingBox() (float64, float64, float64, float64) {
+	width, height := s.Radius, s.Radius
+	if s.Box {
+		width, height = s.Width/2, s.Height/2
+	}
+
+	latDelta := degrees(height / EarthRadius)
+	lonDeltaTop := degrees(width / EarthRadius / math.Cos(radians(s.Lat+latDelta)))
+	lonDeltaBottom := degrees(width / EarthRadius / math.Cos(radians(s.Lat-latDelta)))
+	// The box is widest on the side closest to the equator
+	lonDelta := lonDeltaTop
+	if s.Lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	return s.Lon - lonDelta, s.Lat - latDelta, s.Lon + lonDelta, s.Lat + latDelta
+}
+
+// estimateStep returns the precision at which the box of a point and its
+// neighbours cover radius meters around it.
+func estimateStep(radius, lat float64) uint {
+	if radius == 0 {
+		return Step
+	}
+	step := 1
+	for ; radius < mercatorMax; radius *= 2 {
+		step++
+	}
+	step -= 2
+
+	// Boxes get narrower towards the poles
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(min(max(step, 1), Step))
+}
+
+func encode(lon, lat float64, step uint, latMin, latMax float64) hash {
+	latOffset := (lat - latMin) / (latMax - latMin) * float64(uint64(1)<<step)
+	lonOffset := (lon - LonMin) / (LonMax - LonMin) * float64(uint64(1)<<step)
+	return hash{interleave(uint32(latOffset), uint32(lonOffset)), step}
+}
+
+func decode(h hash) area {
+	lat, lon := deinterleave(h.bits)
+	cells := float64(uint64(1) << h.step)
+	return area{
+		minLon: LonMin + float64(lon)/cells*(LonMax-LonMin),
+		maxLon: LonMin + float64(lon+1)/cells*(LonMax-LonMin),
+		minLat: LatMin + float64(lat)/cells*(LatMax-LatMin),
+		maxLat: LatMin + float64(lat+1)/cells*(LatMax-LatMin),
+	}
+}
+
+// neighbors returns the box of h followed by its north, south, east, west,
+// north east, north west, south east and south west neighbours.
+func (h hash) neighbors() [9]hash {
+	return [9]hash{
+		h,
+		h.move(0, 1), h.move(0, -1), h.move(1, 0), h.move(-1, 0),
+		h.move(1, 1), h.move(-1, 1), h.move(1, -1), h.move(-1, -1),
+	}
+}
+
+// move returns the box dx boxes east and dy boxes north of h, wrapping around.
+func (h hash) move(dx, dy int) hash {
+	const odd, even = 0xaaaaaaaaaaaaaaaa, 0x5555555555555555
+	x, y := h.bits&odd, h.bits&even
+	shift := 64 - 2*h.step
+	x = moveBits(x, dx, even>>shift, odd>>shift)
+	y = moveBits(y, dy, odd>>shift, even>>shift)
+	return hash{x | y, h.step}
+}
+
+// moveBits adds d to the bits of a single coordinate, where fill is set in
+// the bits of the other coordinate so carries go through them.
+func moveBits(bits uint64, d int, fill, mask uint64) uint64 {
+	switch {
+	case d > 0:
+		bits += fill + 1
+	case d < 0:
+		bits = (bits | fill) - (fill + 1)
+	default:
+		return bits
+	}
+	return bits & mask
+}
+
+// interleave returns the bits of x in the even bits and the bits of y in the
+// odd bits.
+func interleave(x, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+// deinterleave splits the even and odd bits of b.
+func deinterleave(b uint64) (uint32, uint32) {
+	return squash(b), squash(b >> 1)
+}
+
+var masks = [...]uint64{
+	0x5555555555555555, 0x3333333333333333, 0x0F0F0F0F0F0F0F0F,
+	0x00FF00FF00FF00FF, 0x0000FFFF0000FFFF, 0x00000000FFFFFFFF,
+}
+
+// spread moves bit i of x to bit 2i.
+func spread(x uint32) uint64 {
+	v := uint64(x)
+	for i := 4; i >= 0; i-- {
+		v = (v | v<<(1<<i)) & masks[i]
+	}
+	return v
+}
+
+// squash moves bit 2i of v to bit i.
+func squash(v uint64) uint32 {
+	v &= masks[0]
+	for i := range 5 {
+		v = (v | v>>(1<<i)) & masks[i+1]
+	}
+	return uint32(v)
+}
+
+func latDistance(lat1, lat2 float64) float64 {
+	return EarthRadius * math.Abs(radians(lat2)-radians(lat1))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
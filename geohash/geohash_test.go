@@ -0,0 +1,119 @@
+package geohash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		lon, lat float64
+		score    uint64
+		hash     string
+	}{
+		{13.361389, 38.115556, 3479099956230698, "sqc8b49rny0"},
+		{15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0"},
+	}
+	for _, test := range tests {
+		score := Encode(test.lon, test.lat)
+		if score != test.score {
+			t.Errorf("%v,%v: expected score %d, got %d", test.lon, test.lat, test.score, score)
+		}
+		if hash := String(score); hash != test.hash {
+			t.Errorf("%v,%v: expected hash %s, got %s", test.lon, test.lat, test.hash, hash)
+		}
+		lon, lat := Decode(score)
+		if math.Abs(lon-test.lon) > 1e-5 || math.Abs(lat-test.lat) > 1e-5 {
+			t.Errorf("%v,%v: decoded to %v,%v", test.lon, test.lat, lon, lat)
+		}
+	}
+
+	lon, lat := Decode(3479099956230698)
+	if s := strconv.FormatFloat(lon, 'f', 17, 64); s != "13.36138933897018433" {
+		t.Errorf("Expected longitude 13.36138933897018433, got %s", s)
+	}
+	if s := strconv.FormatFloat(lat, 'f', 17, 64); s != "38.11555639549629859" {
+		t.Errorf("Expected latitude 38.11555639549629859, got %s", s)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	lon1, lat1 := Decode(Encode(13.361389, 38.115556))
+	lon2, lat2 := Decode(Encode(15.087269, 37.502669))
+	d := Distance(lon1, lat1, lon2, lat2)
+	if s := strconv.FormatFloat(d, 'f', 4, 64); s != "166274.1516" {
+		t.Errorf("Expected 166274.1516, got %s", s)
+	}
+	if d := Distance(10, 20, 10, 21); math.Abs(d-latDistance(20, 21)) > 1e-6 {
+		t.Errorf("Expected the latitude distance, got %v", d)
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	for _, v := range [][2]uint32{{0, 0}, {1, 0}, {0, 1}, {0x3ffffff, 0x1234567}, {0xffffffff, 0xffffffff}} {
+		b := interleave(v[0], v[1])
+		if x, y := deinterleave(b); x != v[0] || y != v[1] {
+			t.Errorf("Expected %v, got %v %v", v, x, y)
+		}
+	}
+	if b := interleave(1, 0); b != 1 {
+		t.Errorf("Expected x in the even bits, got %b", b)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	h := encode(0, 0, 4, LatMin, LatMax)
+	center := decode(h)
+	neighbors := h.neighbors()
+
+	north, east := decode(neighbors[1]), decode(neighbors[3])
+	if north.minLat != center.maxLat || north.minLon != center.minLon {
+		t.Errorf("Expected north to be above the center, got %+v %+v", north, center)
+	}
+	if east.minLon != center.maxLon || east.minLat != center.minLat {
+		t.Errorf("Expected east to be right of the center, got %+v %+v", east, center)
+	}
+	if back := neighbors[3].move(-1, 0); back != h {
+		t.Errorf("Expected moving back to return the center, got %+v", back)
+	}
+}
+
+func TestShape(t *testing.T) {
+	points := map[string][2]float64{
+		"Palermo": {13.361389, 38.115556},
+		"Catania": {15.087269, 37.502669},
+		"edge1":   {12.758489, 38.788135},
+		"edge2":   {17.241510, 38.788135},
+	}
+	shapes := []struct {
+		shape    Shape
+		expected []string
+	}{
+		{Shape{Lon: 15, Lat: 37, Radius: 200000}, []string{"Catania", "Palermo"}},
+		{Shape{Lon: 15, Lat: 37, Width: 400000, Height: 400000, Box: true}, []string{"Catania", "Palermo", "edge1", "edge2"}},
+		{Shape{Lon: 15, Lat: 37, Radius: 100000}, []string{"Catania"}},
+	}
+	for _, test := range shapes {
+		found := map[string]bool{}
+		for name, p := range points {
+			score := Encode(p[0], p[1])
+			inRange := false
+			for _, r := range test.shape.Ranges() {
+				inRange = inRange || score >= r.Min && score < r.Max
+			}
+			lon, lat := Decode(score)
+			if _, ok := test.shape.Contains(lon, lat); ok && inRange {
+				found[name] = true
+			}
+		}
+		if len(found) != len(test.expected) {
+			t.Errorf("%+v: expected %v, got %v", test.shape, test.expected, found)
+		}
+		for _, name := range test.expected {
+			if !found[name] {
+				t.Errorf("%+v: expected %s to be found", test.shape, name)
+			}
+		}
+	}
+}
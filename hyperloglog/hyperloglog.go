@@ -0,0 +1,362 @@
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog estimates the number of distinct elements added to it using
+// 16384 registers of 6 bits. Values use the same bytes as Redis, a 16 byte
+// header of "HYLL" <encoding:u8> <unused:3> <cardinality:u64 little endian>,
+// followed by the registers. The cached cardinality is invalid when the most
+// significant bit of its last byte is set.
+//
+// The dense encoding packs the registers 6 bits each, least significant bit
+// first. The sparse encoding is a run length encoding of the registers made of
+// three opcodes:
+//
+//	ZERO  00xxxxxx           xxxxxx+1 registers set to 0
+//	XZERO 01xxxxxx yyyyyyyy  xxxxxxyyyyyyyy+1 registers set to 0
+//	VAL   1vvvvvxx           xx+1 registers set to vvvvv+1
+//
+// New values start sparse and become dense once a register is too large for
+// VAL or the value grows past SparseMaxBytes.
+
+const (
+	p         = 14
+	Registers = 1 << p
+	q         = 64 - p
+	regBits   = 6
+	regMax    = 1<<regBits - 1
+
+	HeaderSize     = 16
+	DenseSize      = HeaderSize + (Registers*regBits+7)/8
+	SparseMaxBytes = 3000
+
+	Dense  = 0
+	Sparse = 1
+
+	sparseValMax   = 32
+	sparseValRun   = 4
+	sparseZeroRun  = 64
+	sparseXZeroRun = 16384
+
+	seed     = 0xadc83b19
+	alphaInf = 0.721347520444481703680 // 0.5/ln(2)
+)
+
+var ErrCorrupt = errors.New("hyperloglog: corrupt encoding")
+
+// New returns an empty value in the sparse encoding.
+func New() []byte {
+	hll := make([]byte, HeaderSize, HeaderSize+2)
+	writeHeader(hll, Sparse)
+	return appendZeros(hll, Registers)
+}
+
+// Valid reports whether b has the header of a value, and the right size if it
+// is dense. Sparse values are only checked when decoded.
+func Valid(b []byte) bool {
+	if len(b) < HeaderSize || string(b[:4]) != "HYLL" {
+		return false
+	}
+	switch b[4] {
+	case Dense:
+		return len(b) == DenseSize
+	case Sparse:
+		return true
+	}
+	return false
+}
+
+// Add adds elements to the value b, which must be valid, and reports whether
+// any register changed. Dense values are changed in place, sparse ones are
+// returned re-encoded, possibly as dense.
+func Add(b []byte, elements ...string) ([]byte, bool, error) {
+	if b[4] == Dense {
+		changed := false
+		for _, element := range elements {
+			index, count := patLen(element)
+			if getDense(b[HeaderSize:], index) < count {
+				setDense(b[HeaderSize:], index, count)
+				changed = true
+			}
+		}
+		if changed {
+			invalidateCache(b)
+		}
+		return b, changed, nil
+	}
+
+	registers, err := Decode(b)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := false
+	for _, element := range elements {
+		index, count := patLen(element)
+		if registers[index] < count {
+			registers[index] = count
+			changed = true
+		}
+	}
+	if !changed {
+		return b, false, nil
+	}
+	return Encode(registers, false), true, nil
+}
+
+// Count returns the estimated number of distinct elements of the value b,
+// which must be valid. The result is cached in the header of b.
+func Count(b []byte) (uint64, error) {
+	if b[15]&0x80 == 0 {
+		return binary.LittleEndian.Uint64(b[8:16]), nil
+	}
+	registers, err := Decode(b)
+	if err != nil {
+		return 0, err
+	}
+	count := CountRegisters(registers)
+	binary.LittleEndian.PutUint64(b[8:16], count)
+	return count, nil
+}
+
+// Decode returns the registers of the value b, which must be valid.
+func Decode(b []byte) ([]uint8, error) {
+	registers := make([]uint8, Registers)
+	if b[4] == Dense {
+		for i := range registers {
+			registers[i] = getDense(b[HeaderSize:], i)
+		}
+		return registers, nil
+	}
+
+	index := 0
+	for pos := HeaderSize; pos < len(b); pos++ {
+		op := b[pos]
+		switch {
+		case op&0xC0 == 0x00:
+			index += int(op&0x3F) + 1
+		case op&0xC0 == 0x40:
+			if pos+1 >= len(b) {
+				return nil, ErrCorrupt
+			}
+			pos++
+			index += (int(op&0x3F)<<8 | int(b[pos])) + 1
+		default:
+			value, run := (op>>2)&0x1F+1, int(op&0x03)+1
+			if index+run > Registers {
+				return nil, ErrCorrupt
+			}
+			for i := range run {
+				registers[index+i] = value
+			}
+			index += run
+		}
+		if index > Registers {
+			return nil, ErrCorrupt
+		}
+	}
+	if index != Registers {
+		return nil, ErrCorrupt
+	}
+	return registers, nil
+}
+
+// Encode returns a value holding registers, sparse unless dense is set or the
+// registers don't fit in the sparse encoding.
+func Encode(registers []uint8, dense bool) []byte {
+	if !dense {
+		if hll, ok := encodeSparse(registers); ok {
+			return hll
+		}
+	}
+	hll := make([]byte, DenseSize)
+	writeHeader(hll, Dense)
+	for i, value := range registers {
+		setDense(hll[HeaderSize:], i, value)
+	}
+	return hll
+}
+
+// IsDense reports whether the valid value b uses the dense encoding.
+func IsDense(b []byte) bool {
+	return b[4] == Dense
+}
+
+// Merge sets every register of dst to the larger of it and the matching
+// register of the value b, which must be valid.
+func Merge(dst []uint8, b []byte) error {
+	registers, err := Decode(b)
+	if err != nil {
+		return err
+	}
+	for i, value := range registers {
+		dst[i] = max(dst[i], value)
+	}
+	return nil
+}
+
+// CountRegisters estimates the number of distinct elements from registers
+// with the improved estimator of Otmar Ertl, like Redis.
+func CountRegisters(registers []uint8) uint64 {
+	histogram := [64]int{}
+	for _, value := range registers {
+		histogram[value]++
+	}
+
+	m := float64(Registers)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+// patLen returns the register an element maps to, and the length of the run
+// of zeroes in its hash plus one, which is the register's new minimum.
+func patLen(element string) (int, uint8) {
+	hash := murmurHash64A([]byte(element), seed)
+	index := int(hash & (Registers - 1))
+	hash >>= p
+	hash |= 1 << q
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+// getDense returns register i of dense registers. The last register may not
+// have a byte after it.
+func getDense(regs []byte, i int) uint8 {
+	pos, shift := i*regBits/8, uint(i*regBits&7)
+	value := uint(regs[pos]) >> shift
+	if pos+1 < len(regs) {
+		value |= uint(regs[pos+1]) << (8 - shift)
+	}
+	return uint8(value & regMax)
+}
+
+// setDense sets register i of dense registers.
+func setDense(regs []byte, i int, value uint8) {
+	pos, shift := i*regBits/8, uint(i*regBits&7)
+	regs[pos] &^= regMax << shift
+	regs[pos] |= value << shift
+	if pos+1 < len(regs) {
+		regs[pos+1] &^= regMax >> (8 - shift)
+		regs[pos+1] |= value >> (8 - shift)
+	}
+}
+
+// encodeSparse run length encodes registers, reporting false if a register
+// is too large or the result is larger than SparseMaxBytes.
+func encodeSparse(registers []uint8) ([]byte, bool) {
+	hll := make([]byte, HeaderSize, 64)
+	writeHeader(hll, Sparse)
+	for i := 0; i < len(registers); {
+		value := registers[i]
+		run := 1
+		for i+run < len(registers) && registers[i+run] == value {
+			run++
+		}
+		i += run
+
+		if value == 0 {
+			hll = appendZeros(hll, run)
+		} else if value > sparseValMax {
+			return nil, false
+		} else {
+			for ; run > 0; run -= sparseValRun {
+				hll = append(hll, 0x80|(value-1)<<2|byte(min(run, sparseValRun)-1))
+			}
+		}
+		if len(hll) > SparseMaxBytes {
+			return nil, false
+		}
+	}
+	return hll, true
+}
+
+// appendZeros appends the opcodes for a run of zero registers.
+func appendZeros(hll []byte, run int) []byte {
+	for ; run > sparseZeroRun; run -= sparseXZeroRun {
+		n := min(run, sparseXZeroRun) - 1
+		hll = append(hll, 0x40|byte(n>>8), byte(n))
+	}
+	if run > 0 {
+		hll = append(hll, byte(run-1))
+	}
+	return hll
+}
+
+func writeHeader(hll []byte, encoding byte) {
+	copy(hll, "HYLL")
+	hll[4] = encoding
+	invalidateCache(hll)
+}
+
+func invalidateCache(hll []byte) {
+	hll[15] |= 0x80
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// murmurHash64A is the 64 bit MurmurHash2 Redis uses to hash elements.
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ uint64(len(data))*m
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
@@ -0,0 +1,108 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	hll := New()
+	expected := []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x80\x7f\xff")
+	if !bytes.Equal(hll, expected) {
+		t.Errorf("Expected %q, got %q", expected, hll)
+	}
+	if !Valid(hll) {
+		t.Errorf("Expected a new value to be valid")
+	}
+
+	count, err := Count(hll)
+	if err != nil || count != 0 {
+		t.Errorf("Expected 0, got %d %v", count, err)
+	}
+}
+
+func TestAddAndCount(t *testing.T) {
+	hll, changed, err := Add(New(), "a", "b", "c", "d", "e", "f", "g")
+	if err != nil || !changed {
+		t.Fatalf("Expected registers to change, got %v %v", changed, err)
+	}
+	if _, changed, _ = Add(hll, "a", "g"); changed {
+		t.Errorf("Expected adding existing elements to change nothing")
+	}
+	if count, _ := Count(hll); count != 7 {
+		t.Errorf("Expected 7, got %d", count)
+	}
+	if IsDense(hll) {
+		t.Errorf("Expected a small value to be sparse")
+	}
+
+	// Large values become dense and stay within the expected error
+	for i := range 100000 {
+		hll, _, err = Add(hll, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if !IsDense(hll) || len(hll) != DenseSize {
+		t.Errorf("Expected a dense value, got %d bytes", len(hll))
+	}
+	count, _ := Count(hll)
+	if math.Abs(float64(count)-100007)/100007 > 0.02 {
+		t.Errorf("Expected about 100007, got %d", count)
+	}
+
+	// The cached count is used until the registers change
+	hll[8] ^= 1
+	if cached, _ := Count(hll); cached != count^1 {
+		t.Errorf("Expected the cached count %d, got %d", count^1, cached)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	registers := make([]uint8, Registers)
+	registers[0] = 1
+	registers[1] = 1
+	registers[100] = 32
+	for i := 200; i < 210; i++ {
+		registers[i] = 5
+	}
+	registers[Registers-1] = 3
+
+	sparse := Encode(registers, false)
+	if IsDense(sparse) {
+		t.Fatalf("Expected a sparse value")
+	}
+	// VAL 1x2, XZERO 98, VAL 32, XZERO 99, VAL 5x4, VAL 5x4, VAL 5x2, XZERO 16173, VAL 3
+	expected := []byte{0x81, 0x40, 0x61, 0xfc, 0x40, 0x62, 0x93, 0x93, 0x91, 0x7f, 0x2c, 0x88}
+	if !bytes.Equal(sparse[HeaderSize:], expected) {
+		t.Errorf("Expected %x, got %x", expected, sparse[HeaderSize:])
+	}
+
+	dense := Encode(registers, true)
+	for _, hll := range [][]byte{sparse, dense} {
+		decoded, err := Decode(hll)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(decoded, registers) {
+			t.Errorf("Expected decoded registers to match")
+		}
+	}
+
+	// Registers above the largest sparse value need the dense encoding
+	registers[7] = 33
+	if !IsDense(Encode(registers, false)) {
+		t.Errorf("Expected a dense value")
+	}
+
+	// Sparse values must cover every register exactly
+	if _, err := Decode(sparse[:len(sparse)-1]); err != ErrCorrupt {
+		t.Errorf("Expected ErrCorrupt, got %v", err)
+	}
+	if Valid([]byte("HYLL\x00")) || Valid(dense[:DenseSize-1]) {
+		t.Errorf("Expected truncated values to be invalid")
+	}
+}
@@ -0,0 +1,271 @@
+package listpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+// Listpack is the compact serialization Redis uses for small collections.
+// Its layout is <total-bytes:u32> <num-elements:u16> <entry>... <0xFF>, where
+// every entry is <encoding+data> <backlen>.
+
+const (
+	headerSize = 6
+	end        = 0xFF
+	// Element counts from this on are unknown and take a full scan
+	unknownCount = 0xFFFF
+)
+
+var ErrCorrupt = errors.New("listpack: corrupt encoding")
+
+// Sizes of the 16, 24, 32 and 64 bit integer encodings 0xF1 to 0xF4
+var intSizes = [...]int{2, 3, 4, 8}
+
+// Decode returns every element of the listpack as a string, integers are
+// formatted in base 10.
+func Decode(lp []byte) ([]string, error) {
+	if len(lp) < headerSize+1 {
+		return nil, ErrCorrupt
+	}
+	total := int(binary.LittleEndian.Uint32(lp))
+	if total > len(lp) {
+		return nil, ErrCorrupt
+	}
+
+	values := []string{}
+	pos := headerSize
+	for pos < total && lp[pos] != end {
+		value, n, err := decodeEntry(lp[pos:total])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		pos += n + backlenSize(n)
+	}
+	return values, nil
+}
+
+// New returns an empty listpack.
+func New() []byte {
+	lp := make([]byte, headerSize+1)
+	binary.LittleEndian.PutUint32(lp, headerSize+1)
+	lp[headerSize] = end
+	return lp
+}
+
+// Append adds value at the end of the listpack and returns the updated
+// listpack. Values that are integers in base 10 are stored as integers.
+func Append(lp []byte, value string) []byte {
+	total := int(binary.LittleEndian.Uint32(lp))
+	lp = append(lp[:total-1], encodeEntry(value)...)
+	lp = append(lp, end)
+	binary.LittleEndian.PutUint32(lp, uint32(len(lp)))
+	if count := binary.LittleEndian.Uint16(lp[4:]); count < unknownCount {
+		binary.LittleEndian.PutUint16(lp[4:], count+1)
+	}
+	return lp
+}
+
+// AppendInt adds an integer at the end of the listpack and returns the
+// updated listpack.
+func AppendInt(lp []byte, value int64) []byte {
+	return Append(lp, strconv.FormatInt(value, 10))
+}
+
+// Get returns the element at index.
+func Get(lp []byte, index int) (string, error) {
+	value, _, _, err := seek(lp, index)
+	return value, err
+}
+
+// Replace sets the element at index to value and returns the updated
+// listpack. The listpack is modified in place when the sizes of the old and
+// new elements match.
+func Replace(lp []byte, index int, value string) ([]byte, error) {
+	_, pos, old, err := seek(lp, index)
+	if err != nil {
+		return nil, err
+	}
+	entry := encodeEntry(value)
+	if len(entry) == old {
+		copy(lp[pos:], entry)
+		return lp, nil
+	}
+
+	total := int(binary.LittleEndian.Uint32(lp))
+	updated := make([]byte, 0, total-old+len(entry))
+	updated = append(updated, lp[:pos]...)
+	updated = append(updated, entry...)
+	updated = append(updated, lp[pos+old:total]...)
+	binary.LittleEndian.PutUint32(updated, uint32(len(updated)))
+	return updated, nil
+}
+
+// seek returns the element at index along with its position and size,
+// including the backlen.
+func seek(lp []byte, index int) (string, int, int, error) {
+	if len(lp) < headerSize+1 {
+		return "", 0, 0, ErrCorrupt
+	}
+	total := int(binary.LittleEndian.Uint32(lp))
+	if total > len(lp) {
+		return "", 0, 0, ErrCorrupt
+	}
+	pos := headerSize
+	for i := 0; ; i++ {
+		if pos >= total || lp[pos] == end {
+			return "", 0, 0, ErrCorrupt
+		}
+		value, n, err := decodeEntry(lp[pos:total])
+		if err != nil {
+			return "", 0, 0, err
+		}
+		if i == index {
+			return value, pos, n + backlenSize(n), nil
+		}
+		pos += n + backlenSize(n)
+	}
+}
+
+// encodeEntry returns the encoding, data and backlen of an element.
+func encodeEntry(value string) []byte {
+	var b []byte
+	if v, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(v, 10) == value {
+		b = encodeInt(v)
+	} else {
+		b = encodeStr(value)
+	}
+	return appendBacklen(b, len(b))
+}
+
+func encodeInt(v int64) []byte {
+	switch {
+	case v >= 0 && v < 1<<7:
+		return []byte{byte(v)}
+	case v >= -(1<<12) && v < 1<<12:
+		u := uint64(v) & (1<<13 - 1)
+		return []byte{0xC0 | byte(u>>8), byte(u)}
+	}
+	size := 8
+	for i, s := range intSizes[:3] {
+		if v >= -(1<<(8*s-1)) && v < 1<<(8*s-1) {
+			size = intSizes[i]
+			break
+		}
+	}
+	b := make([]byte, 1+size)
+	b[0] = 0xF1 + byte(slices.Index(intSizes[:], size))
+	u := uint64(v)
+	for i := 1; i <= size; i++ {
+		b[i] = byte(u)
+		u >>= 8
+	}
+	return b
+}
+
+func encodeStr(s string) []byte {
+	var b []byte
+	switch n := len(s); {
+	case n < 1<<6:
+		b = []byte{0x80 | byte(n)}
+	case n < 1<<12:
+		b = []byte{0xE0 | byte(n>>8), byte(n)}
+	default:
+		b = []byte{0xF0, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(b[1:], uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendBacklen appends the size n of an element's encoding and data, stored
+// so it can be read from right to left: 7 bits per byte, most significant
+// first, with the high bit set on all but the first byte.
+func appendBacklen(b []byte, n int) []byte {
+	size := backlenSize(n)
+	for i := size - 1; i >= 0; i-- {
+		v := byte(n>>(7*i)) & 0x7F
+		if i < size-1 {
+			v |= 0x80
+		}
+		b = append(b, v)
+	}
+	return b
+}
+
+// decodeEntry decodes the entry at the start of b and returns its value along
+// with the size of its encoding and data, excluding the backlen.
+func decodeEntry(b []byte) (string, int, error) {
+	enc := b[0]
+	switch {
+	case enc&0x80 == 0:
+		// 7 bit unsigned integer
+		return strconv.Itoa(int(enc & 0x7F)), 1, nil
+	case enc&0xC0 == 0x80:
+		// 6 bit length string
+		return decodeStr(b, 1, int(enc&0x3F))
+	case enc&0xE0 == 0xC0:
+		// 13 bit signed integer
+		if len(b) < 2 {
+			return "", 0, ErrCorrupt
+		}
+		v := int64(enc&0x1F)<<8 | int64(b[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return strconv.FormatInt(v, 10), 2, nil
+	case enc&0xF0 == 0xE0:
+		// 12 bit length string
+		if len(b) < 2 {
+			return "", 0, ErrCorrupt
+		}
+		return decodeStr(b, 2, int(enc&0x0F)<<8|int(b[1]))
+	case enc == 0xF0:
+		// 32 bit length string
+		if len(b) < 5 {
+			return "", 0, ErrCorrupt
+		}
+		return decodeStr(b, 5, int(binary.LittleEndian.Uint32(b[1:])))
+	case enc >= 0xF1 && enc <= 0xF4:
+		// 16, 24, 32 and 64 bit signed integers
+		size := intSizes[enc-0xF1]
+		if len(b) < 1+size {
+			return "", 0, ErrCorrupt
+		}
+		var u uint64
+		for i := size; i > 0; i-- {
+			u = u<<8 | uint64(b[i])
+		}
+		// Sign extend from size bytes
+		shift := 64 - 8*size
+		v := int64(u<<shift) >> shift
+		return strconv.FormatInt(v, 10), 1 + size, nil
+	default:
+		return "", 0, ErrCorrupt
+	}
+}
+
+func decodeStr(b []byte, header, length int) (string, int, error) {
+	if len(b) < header+length {
+		return "", 0, ErrCorrupt
+	}
+	return string(b[header : header+length]), header + length, nil
+}
+
+// backlenSize returns the number of bytes used to store the backlen of an
+// entry whose encoding and data take n bytes.
+func backlenSize(n int) int {
+	switch {
+	case n < 1<<7:
+		return 1
+	case n < 1<<14-1:
+		return 2
+	case n < 1<<21-1:
+		return 3
+	case n < 1<<28-1:
+		return 4
+	default:
+		return 5
+	}
+}
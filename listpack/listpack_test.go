@@ -0,0 +1,90 @@
+package listpack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	lp := []byte{
+		0x16, 0x00, 0x00, 0x00, // total bytes
+		0x05, 0x00, // number of elements
+		0x81, 'a', 0x02, // 6 bit string
+		0x01, 0x01, // 7 bit integer
+		0xDF, 0xFB, 0x02, // 13 bit integer -5
+		0xF1, 0xE0, 0xB1, 0x03, // 16 bit integer -20000
+		0xE0, 0x00, 0x02, // 12 bit string, empty
+		0xFF,
+	}
+
+	values, err := Decode(lp)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	expectedValues := []string{"a", "1", "-5", "-20000", ""}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("Expected values %v, but got %v", expectedValues, values)
+	}
+
+	// Test decoding a truncated listpack
+	_, err = Decode(lp[:8])
+	if err == nil {
+		t.Error("Expected error when decoding a truncated listpack, but got nil")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	values := []string{"a", "1", "-5", "-20000", "", "01", "+1", "9223372036854775807", "100000", strings.Repeat("x", 100), strings.Repeat("y", 5000)}
+	lp := New()
+	for _, value := range values {
+		lp = Append(lp, value)
+	}
+	lp = AppendInt(lp, -1<<40)
+	values = append(values, "-1099511627776")
+
+	decoded, err := Decode(lp)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if !reflect.DeepEqual(decoded, values) {
+		t.Errorf("Expected values %v, but got %v", values, decoded)
+	}
+	if count := int(lp[4]) | int(lp[5])<<8; count != len(values) {
+		t.Errorf("Expected %d elements, but got %d", len(values), count)
+	}
+
+	// Small integers use a single byte, the same encoding as Redis
+	if lp := Append(New(), "1"); !reflect.DeepEqual(lp, []byte{0x09, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x01, 0xFF}) {
+		t.Errorf("Unexpected encoding %v", lp)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	lp := New()
+	for _, value := range []string{"a", "1", "b"} {
+		lp = Append(lp, value)
+	}
+
+	// Same size elements are replaced in place
+	replaced, err := Replace(lp, 1, "2")
+	if err != nil || &replaced[0] != &lp[0] {
+		t.Errorf("Expected the listpack to be modified in place, got %v", err)
+	}
+	lp, err = Replace(replaced, 1, "a longer value")
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	lp, _ = Replace(lp, 2, "c")
+	values, _ := Decode(lp)
+	if expected := []string{"a", "a longer value", "c"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected values %v, but got %v", expected, values)
+	}
+
+	if value, err := Get(lp, 1); err != nil || value != "a longer value" {
+		t.Errorf("Expected a longer value, but got %q %v", value, err)
+	}
+	if _, err := Replace(lp, 3, "d"); err == nil {
+		t.Error("Expected error when replacing past the end, but got nil")
+	}
+}
@@ -53,6 +53,28 @@ func (q *Queue) Dequeue() (any, error) {
 	return first.value, nil
 }
 
+// Remove removes the first occurrence of item from the queue and reports
+// whether it was found.
+func (q *Queue) Remove(item any) bool {
+	var prev *node
+	for curr := q.head; curr != nil; prev, curr = curr, curr.next {
+		if curr.value != item {
+			continue
+		}
+		if prev == nil {
+			q.head = curr.next
+		} else {
+			prev.next = curr.next
+		}
+		if curr == q.tail {
+			q.tail = prev
+		}
+		q.count--
+		return true
+	}
+	return false
+}
+
 // Peek returns the item at the front of the queue without removing it.
 func (q *Queue) Peek() (any, error) {
 	if q.count == 0 {
@@ -213,3 +213,44 @@ func TestValues(t *testing.T) {
 		t.Errorf("Expected values %v, but got %v", expectedValues, values)
 	}
 }
+
+func TestRemove(t *testing.T) {
+	q := NewQueue()
+	// Test removing from an empty queue
+	if q.Remove(1) {
+		t.Error("Expected Remove to return false for an empty queue, but got true")
+	}
+	// Test removing from the middle, head and tail of the queue
+	q.Enqueue(1)
+	q.Enqueue(2)
+	q.Enqueue(3)
+	q.Enqueue(4)
+	if !q.Remove(2) {
+		t.Error("Expected Remove to return true for an existing item, but got false")
+	}
+	if !q.Remove(1) {
+		t.Error("Expected Remove to return true for the head item, but got false")
+	}
+	if !q.Remove(4) {
+		t.Error("Expected Remove to return true for the tail item, but got false")
+	}
+	values := q.Values()
+	expectedValues := []any{3}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("Expected values %v, but got %v", expectedValues, values)
+	}
+	// Test enqueueing after removing the tail
+	q.Enqueue(5)
+	values = q.Values()
+	expectedValues = []any{3, 5}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("Expected values %v, but got %v", expectedValues, values)
+	}
+	// Test removing a non-existing item
+	if q.Remove(6) {
+		t.Error("Expected Remove to return false for a non-existing item, but got true")
+	}
+	if q.Len() != 2 {
+		t.Errorf("Expected queue length 2, but got %d", q.Len())
+	}
+}
@@ -1,5 +1,7 @@
 package radix
 
+import "slices"
+
 type Radix struct {
 	root *node
 }
@@ -65,9 +67,15 @@ func (n *node) insert(key string, value any) {
 		return
 	}
 
+	// Edges are kept sorted by their first byte, which is unique among the
+	// edges of a node, so keys can be visited in order
+	i := 0
+	for i < len(n.edges) && n.edges[i].label[0] < key[0] {
+		i++
+	}
 	newNode := newNode(value)
 	newNode.isTerminal = true
-	n.edges = append(n.edges, newEdge(key, newNode))
+	n.edges = slices.Insert(n.edges, i, newEdge(key, newNode))
 }
 
 func commonPrefixLen(a, b string) int {
@@ -174,6 +182,50 @@ func (r *Radix) GetAll() []any {
 	return values
 }
 
+// Walk calls fn for every key and value in the tree.
+func (r *Radix) Walk(fn func(key string, value any)) {
+	r.root.walk("", fn)
+}
+
+func (n *node) walk(key string, fn func(key string, value any)) {
+	if n.isTerminal {
+		fn(key, n.value)
+	}
+
+	for _, edge := range n.edges {
+		edge.node.walk(key+edge.label, fn)
+	}
+}
+
+// Nodes returns the number of nodes in the tree, including the root.
+func (r *Radix) Nodes() int {
+	return r.root.nodes()
+}
+
+func (n *node) nodes() int {
+	count := 1
+	for _, edge := range n.edges {
+		count += edge.node.nodes()
+	}
+	return count
+}
+
+// Keys returns the number of keys in the tree.
+func (r *Radix) Keys() int {
+	return r.root.keys()
+}
+
+func (n *node) keys() int {
+	count := 0
+	if n.isTerminal {
+		count++
+	}
+	for _, edge := range n.edges {
+		count += edge.node.keys()
+	}
+	return count
+}
+
 func (r *Radix) GetFirst() (string, any, bool) {
 	return r.root.getFirst("")
 }
@@ -295,12 +347,175 @@ func (n *node) delete(key, parentLabel string, parent *node) {
 		if cpl == len(label) {
 			node.delete(key[cpl:], label, n)
 		}
+		// The remaining edge may not be the one the key went through
 		if len(n.edges) == 1 && !n.isTerminal {
 			if parent != nil {
-				parent.updateEdge(parentLabel, parentLabel+label, n.edges[0].node)
-				parent.deleteEdge(parentLabel)
+				parent.updateEdge(parentLabel, parentLabel+n.edges[0].label, n.edges[0].node)
 			}
 		}
 		return
 	}
 }
+
+// Iterator visits the keys of a tree in order, or in reverse order. The tree
+// must not be modified while iterating. Call Next to move to the first key.
+type Iterator struct {
+	stack   []frame
+	reverse bool
+	key     string
+	value   any
+}
+
+// frame is a node on the path to the current key. Edges are visited from
+// next, and the value of the node is visited if self is set, before its
+// children going forward and after them in reverse.
+type frame struct {
+	node *node
+	key  string
+	next int
+	self bool
+}
+
+// Iter returns an iterator from the first key.
+func (r *Radix) Iter() *Iterator {
+	return r.Seek("")
+}
+
+// ReverseIter returns an iterator from the last key backwards.
+func (r *Radix) ReverseIter() *Iterator {
+	root := frame{node: r.root, next: len(r.root.edges) - 1, self: true}
+	return &Iterator{stack: []frame{root}, reverse: true}
+}
+
+// Seek returns an iterator from the first key greater than or equal to key.
+func (r *Radix) Seek(key string) *Iterator {
+	it := &Iterator{stack: []frame{{node: r.root}}}
+	for remaining := key; ; {
+		top := &it.stack[len(it.stack)-1]
+		if len(remaining) == 0 {
+			top.self = true
+			return it
+		}
+
+		// The key of the node is a prefix of key, so it is smaller
+		edges := top.node.edges
+		i := 0
+		for i < len(edges) && edges[i].label[0] < remaining[0] {
+			i++
+		}
+		top.next = i
+		if i == len(edges) || edges[i].label[0] != remaining[0] {
+			return it
+		}
+
+		label := edges[i].label
+		cpl := commonPrefixLen(remaining, label)
+		switch {
+		case cpl == len(label):
+			top.next = i + 1
+			it.stack = append(it.stack, frame{node: edges[i].node, key: top.key + label})
+			remaining = remaining[cpl:]
+			continue
+		case cpl < len(remaining) && remaining[cpl] > label[cpl]:
+			top.next = i + 1
+		}
+		return it
+	}
+}
+
+// SeekReverse returns an iterator from the last key less than or equal to
+// key backwards.
+func (r *Radix) SeekReverse(key string) *Iterator {
+	it := &Iterator{stack: []frame{{node: r.root}}, reverse: true}
+	for remaining := key; ; {
+		top := &it.stack[len(it.stack)-1]
+		top.self = true
+		top.next = -1
+		if len(remaining) == 0 {
+			return it
+		}
+
+		edges := top.node.edges
+		i := len(edges) - 1
+		for i >= 0 && edges[i].label[0] > remaining[0] {
+			i--
+		}
+		top.next = i
+		if i == -1 || edges[i].label[0] != remaining[0] {
+			return it
+		}
+
+		label := edges[i].label
+		cpl := commonPrefixLen(remaining, label)
+		switch {
+		case cpl == len(label):
+			top.next = i - 1
+			it.stack = append(it.stack, frame{node: edges[i].node, key: top.key + label})
+			remaining = remaining[cpl:]
+			continue
+		case cpl == len(remaining) || remaining[cpl] < label[cpl]:
+			top.next = i - 1
+		}
+		return it
+	}
+}
+
+// Next moves to the next key, returning false when there are no more keys.
+func (it *Iterator) Next() bool {
+	if it.reverse {
+		return it.prev()
+	}
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if top.self {
+			top.self = false
+			if top.node.isTerminal {
+				it.key, it.value = top.key, top.node.value
+				return true
+			}
+			continue
+		}
+		if top.next < len(top.node.edges) {
+			edge := top.node.edges[top.next]
+			top.next++
+			it.stack = append(it.stack, frame{node: edge.node, key: top.key + edge.label, self: true})
+			continue
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
+
+func (it *Iterator) prev() bool {
+	for len(it.stack) > 0 {
+		top := &it.stack[len(it.stack)-1]
+		if top.next >= 0 {
+			edge := top.node.edges[top.next]
+			top.next--
+			it.stack = append(it.stack, frame{
+				node: edge.node,
+				key:  top.key + edge.label,
+				next: len(edge.node.edges) - 1,
+				self: true,
+			})
+			continue
+		}
+		done := *top
+		it.stack = it.stack[:len(it.stack)-1]
+		if done.self && done.node.isTerminal {
+			it.key, it.value = done.key, done.node.value
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the current key.
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+// Value returns the value of the current key.
+func (it *Iterator) Value() any {
+	return it.value
+}
@@ -1,8 +1,10 @@
 package radix
 
 import (
+	"math/rand"
 	"reflect"
 	"slices"
+	"strconv"
 	"testing"
 )
 
@@ -78,6 +80,15 @@ func TestDelete(t *testing.T) {
 	if ok {
 		t.Error("Deleted non-existing key")
 	}
+
+	// Test that siblings of a deleted key are kept
+	root.Delete("1526985054069-1")
+	if data, ok := root.Find("1526985054069-2"); !ok || data.(Data).Temperature != 27 {
+		t.Errorf("Expected the sibling of a deleted key, got %v", data)
+	}
+	if _, ok := root.Find("1526985054069-1"); ok {
+		t.Error("Failed to delete existing key")
+	}
 }
 func TestFindAll(t *testing.T) {
 	root := NewRadix()
@@ -124,6 +135,40 @@ func TestGetAll(t *testing.T) {
 		t.Errorf("Expected values %v, but got %v", expectedValues, values)
 	}
 }
+func TestNodes(t *testing.T) {
+	root := NewRadix()
+	if n := root.Nodes(); n != 1 {
+		t.Errorf("Expected 1 node, got %d", n)
+	}
+	root.Insert("1526985054069-0", Data{Temperature: 25, Humidity: 50})
+	root.Insert("1526985054069-1", Data{Temperature: 26, Humidity: 51})
+	// The root, the shared prefix and the two keys
+	if n := root.Nodes(); n != 4 {
+		t.Errorf("Expected 4 nodes, got %d", n)
+	}
+	if n := root.Keys(); n != 2 {
+		t.Errorf("Expected 2 keys, got %d", n)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := NewRadix()
+	root.Insert("1526985054069-1", Data{Temperature: 26, Humidity: 51})
+	root.Insert("1526985054069-0", Data{Temperature: 25, Humidity: 50})
+	root.Insert("1526985054070-0", Data{Temperature: 27, Humidity: 52})
+
+	expectedKeys := []string{"1526985054069-0", "1526985054069-1", "1526985054070-0"}
+
+	keys := []string{}
+	root.Walk(func(key string, value any) {
+		keys = append(keys, key)
+	})
+	slices.Sort(keys)
+
+	if !slices.Equal(keys, expectedKeys) {
+		t.Errorf("Expected keys %v, but got %v", expectedKeys, keys)
+	}
+}
 func TestGetFirst(t *testing.T) {
 	root := NewRadix()
 	root.Insert("1526985054069-0", Data{Temperature: 25, Humidity: 50})
@@ -243,3 +288,62 @@ func TestGetNext(t *testing.T) {
 		t.Errorf("Expected value %v, but got %v", expectedValue, value)
 	}
 }
+
+func TestSeek(t *testing.T) {
+	root := NewRadix()
+	keys := []string{}
+	rng := rand.New(rand.NewSource(1))
+	for range 500 {
+		key := strconv.Itoa(rng.Intn(100000))
+		root.Insert(key, key)
+		keys = append(keys, key)
+	}
+	for _, key := range keys[:100] {
+		root.Delete(key)
+	}
+	keys = keys[100:]
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+	// Deleted keys may have been inserted again
+	keys = slices.DeleteFunc(keys, func(key string) bool {
+		_, ok := root.Find(key)
+		return !ok
+	})
+
+	collect := func(it *Iterator) []string {
+		found := []string{}
+		for it.Next() {
+			if it.Value() != it.Key() {
+				t.Errorf("Expected value %s, got %v", it.Key(), it.Value())
+			}
+			found = append(found, it.Key())
+		}
+		return found
+	}
+
+	if found := collect(root.Iter()); !slices.Equal(found, keys) {
+		t.Errorf("Expected %v, got %v", keys, found)
+	}
+	reversed := slices.Clone(keys)
+	slices.Reverse(reversed)
+	if found := collect(root.ReverseIter()); !slices.Equal(found, reversed) {
+		t.Errorf("Expected %v, got %v", reversed, found)
+	}
+
+	for _, seek := range []string{"", "0", "1", "12", "5000", "55555", "9", "99999", "a"} {
+		i, _ := slices.BinarySearch(keys, seek)
+		if found := collect(root.Seek(seek)); !slices.Equal(found, keys[i:]) {
+			t.Errorf("Seek(%q): expected %v, got %v", seek, keys[i:], found)
+		}
+
+		j, ok := slices.BinarySearch(keys, seek)
+		if ok {
+			j++
+		}
+		expected := slices.Clone(keys[:j])
+		slices.Reverse(expected)
+		if found := collect(root.SeekReverse(seek)); !slices.Equal(found, expected) {
+			t.Errorf("SeekReverse(%q): expected %v, got %v", seek, expected, found)
+		}
+	}
+}
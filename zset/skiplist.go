@@ -0,0 +1,201 @@
+package zset
+
+import "math/rand/v2"
+
+const (
+	maxLevel = 32
+	// Probability of a node being promoted to the next level
+	levelP = 0.25
+)
+
+// skiplist orders elements by score, then by member. Every forward pointer
+// stores its span, the number of nodes it skips, so ranks can be computed in
+// O(log n).
+type skiplist struct {
+	header *node
+	tail   *node
+	length int
+	level  int
+}
+
+type node struct {
+	member   string
+	score    float64
+	backward *node
+	levels   []level
+}
+
+type level struct {
+	forward *node
+	span    int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{header: newNode(maxLevel, 0, ""), level: 1}
+}
+
+func newNode(lvl int, score float64, member string) *node {
+	return &node{member: member, score: score, levels: make([]level, lvl)}
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < maxLevel && rand.Float64() < levelP {
+		lvl++
+	}
+	return lvl
+}
+
+// before reports whether n sorts before the element (score, member)
+func (n *node) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// insert adds a new element, the member must not already be in the list
+func (zsl *skiplist) insert(score float64, member string) *node {
+	update := make([]*node, maxLevel)
+	rank := make([]int, maxLevel)
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	lvl := randomLevel()
+	if lvl > zsl.level {
+		for i := zsl.level; i < lvl; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].levels[i].span = zsl.length
+		}
+		zsl.level = lvl
+	}
+
+	x = newNode(lvl, score, member)
+	for i := 0; i < lvl; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	// Levels above the new node now span one more element
+	for i := lvl; i < zsl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+// delete removes the element (score, member) and reports whether it existed
+func (zsl *skiplist) delete(score float64, member string) bool {
+	update := make([]*node, maxLevel)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < zsl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.levels[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+	return true
+}
+
+// rank returns the 1 based rank of the element (score, member), or 0 if it
+// is not in the list
+func (zsl *skiplist) rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil &&
+			(x.levels[i].forward.before(score, member) ||
+				(x.levels[i].forward.score == score && x.levels[i].forward.member == member)) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if x != zsl.header && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node at the 1 based rank, or nil if out of range
+func (zsl *skiplist) byRank(rank int) *node {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank && x != zsl.header {
+			return x
+		}
+	}
+	return nil
+}
+
+// first returns the first node for which below is false, i.e. the first node
+// that is not below the lower bound of a range
+func (zsl *skiplist) first(below func(n *node) bool) *node {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && below(x.levels[i].forward) {
+			x = x.levels[i].forward
+		}
+	}
+	return x.levels[0].forward
+}
+
+// last returns the last node for which within is true, i.e. the last node
+// that does not exceed the upper bound of a range
+func (zsl *skiplist) last(within func(n *node) bool) *node {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && within(x.levels[i].forward) {
+			x = x.levels[i].forward
+		}
+	}
+	if x == zsl.header {
+		return nil
+	}
+	return x
+}
@@ -0,0 +1,230 @@
+package zset
+
+// ZSet is a sorted set, a skiplist ordered by score and member plus a map
+// from member to score for O(1) lookups.
+type ZSet struct {
+	dict map[string]float64
+	zsl  *skiplist
+}
+
+// Element is a member of a sorted set and its score.
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// Range is an interval of scores. Bounds are inclusive unless marked
+// exclusive.
+type Range struct {
+	Min          float64
+	Max          float64
+	MinExclusive bool
+	MaxExclusive bool
+}
+
+// LexRange is an interval of members. MinInf and MaxInf mark the "-" and "+"
+// bounds, in which case Min or Max are ignored.
+type LexRange struct {
+	Min          string
+	Max          string
+	MinExclusive bool
+	MaxExclusive bool
+	MinInf       bool
+	MaxInf       bool
+}
+
+// NewZSet creates a new empty sorted set.
+func NewZSet() *ZSet {
+	return &ZSet{dict: map[string]float64{}, zsl: newSkiplist()}
+}
+
+// Len returns the number of members in the sorted set.
+func (z *ZSet) Len() int {
+	return z.zsl.length
+}
+
+// Score returns the score of member.
+func (z *ZSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Add sets the score of member, adding it if needed. Returns true if the
+// member was added.
+func (z *ZSet) Add(member string, score float64) bool {
+	current, ok := z.dict[member]
+	if ok {
+		if current != score {
+			z.zsl.delete(current, member)
+			z.zsl.insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	return true
+}
+
+// Remove removes member and reports whether it was present.
+func (z *ZSet) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// Rank returns the 0 based rank of member, counted from the highest score
+// when reverse is set.
+func (z *ZSet) Rank(member string, reverse bool) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	rank := z.zsl.rank(score, member)
+	if reverse {
+		return z.zsl.length - rank, true
+	}
+	return rank - 1, true
+}
+
+// RangeByRank returns the elements between the 0 based ranks start and stop
+// inclusive, which must be within [0, Len()). Ranks are counted from the
+// highest score when reverse is set.
+func (z *ZSet) RangeByRank(start, stop int, reverse bool) []Element {
+	elements := make([]Element, 0, stop-start+1)
+	var x *node
+	if reverse {
+		x = z.zsl.byRank(z.zsl.length - start)
+	} else {
+		x = z.zsl.byRank(start + 1)
+	}
+	for ; x != nil && len(elements) < stop-start+1; x = step(x, reverse) {
+		elements = append(elements, Element{x.member, x.score})
+	}
+	return elements
+}
+
+// RangeByScore returns the elements with a score within r, skipping the
+// first offset matches and returning at most count elements, or all of them
+// if count is negative.
+func (z *ZSet) RangeByScore(r Range, offset, count int, reverse bool) []Element {
+	return z.rangeBy(r.below, r.within, offset, count, reverse)
+}
+
+// RangeByLex returns the elements with a member within r, assuming every
+// element has the same score. Offset and count work as in RangeByScore.
+func (z *ZSet) RangeByLex(r LexRange, offset, count int, reverse bool) []Element {
+	return z.rangeBy(r.below, r.within, offset, count, reverse)
+}
+
+// Count returns the number of elements with a score within r.
+func (z *ZSet) Count(r Range) int {
+	first := z.zsl.first(r.below)
+	if first == nil || !r.within(first) {
+		return 0
+	}
+	last := z.zsl.last(r.within)
+	return z.zsl.rank(last.score, last.member) - z.zsl.rank(first.score, first.member) + 1
+}
+
+// Clone returns a copy of the sorted set.
+func (z *ZSet) Clone() *ZSet {
+	clone := NewZSet()
+	for x := z.zsl.header.levels[0].forward; x != nil; x = x.levels[0].forward {
+		clone.Add(x.member, x.score)
+	}
+	return clone
+}
+
+// PopMin removes and returns up to count elements with the lowest scores.
+func (z *ZSet) PopMin(count int) []Element {
+	return z.pop(count, false)
+}
+
+// PopMax removes and returns up to count elements with the highest scores.
+func (z *ZSet) PopMax(count int) []Element {
+	return z.pop(count, true)
+}
+
+func (z *ZSet) pop(count int, max bool) []Element {
+	elements := []Element{}
+	for ; count > 0 && z.zsl.length > 0; count-- {
+		x := z.zsl.header.levels[0].forward
+		if max {
+			x = z.zsl.tail
+		}
+		elements = append(elements, Element{x.member, x.score})
+		z.Remove(x.member)
+	}
+	return elements
+}
+
+// rangeBy walks the elements between the first node not below the range and
+// the last node within it.
+func (z *ZSet) rangeBy(below, within func(n *node) bool, offset, count int, reverse bool) []Element {
+	var x *node
+	if reverse {
+		x = z.zsl.last(within)
+	} else {
+		x = z.zsl.first(below)
+	}
+
+	for ; x != nil && offset > 0; offset-- {
+		x = step(x, reverse)
+	}
+
+	elements := []Element{}
+	for ; x != nil && count != 0; count-- {
+		if (reverse && below(x)) || (!reverse && !within(x)) {
+			break
+		}
+		elements = append(elements, Element{x.member, x.score})
+		x = step(x, reverse)
+	}
+	return elements
+}
+
+func step(x *node, reverse bool) *node {
+	if reverse {
+		return x.backward
+	}
+	return x.levels[0].forward
+}
+
+func (r Range) below(n *node) bool {
+	if r.MinExclusive {
+		return n.score <= r.Min
+	}
+	return n.score < r.Min
+}
+
+func (r Range) within(n *node) bool {
+	if r.MaxExclusive {
+		return n.score < r.Max
+	}
+	return n.score <= r.Max
+}
+
+func (r LexRange) below(n *node) bool {
+	if r.MinInf {
+		return false
+	}
+	if r.MinExclusive {
+		return n.member <= r.Min
+	}
+	return n.member < r.Min
+}
+
+func (r LexRange) within(n *node) bool {
+	if r.MaxInf {
+		return true
+	}
+	if r.MaxExclusive {
+		return n.member < r.Max
+	}
+	return n.member <= r.Max
+}
@@ -0,0 +1,216 @@
+package zset
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func members(elements []Element) []string {
+	values := []string{}
+	for _, e := range elements {
+		values = append(values, e.Member)
+	}
+	return values
+}
+
+func TestAdd(t *testing.T) {
+	z := NewZSet()
+
+	// Test adding new members
+	if !z.Add("a", 1) || !z.Add("b", 2) {
+		t.Error("Expected Add to return true for new members")
+	}
+	if z.Len() != 2 {
+		t.Errorf("Expected length 2, but got %d", z.Len())
+	}
+
+	// Test updating the score of an existing member
+	if z.Add("a", 3) {
+		t.Error("Expected Add to return false for an existing member")
+	}
+	if score, _ := z.Score("a"); score != 3 {
+		t.Errorf("Expected score 3, but got %v", score)
+	}
+	if got := members(z.RangeByRank(0, 1, false)); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("Expected [b a], but got %v", got)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	z := NewZSet()
+	z.Add("a", 1)
+	z.Add("b", 2)
+
+	// Test removing an existing member
+	if !z.Remove("a") {
+		t.Error("Expected Remove to return true for an existing member")
+	}
+	if _, ok := z.Score("a"); ok {
+		t.Error("Found removed member")
+	}
+
+	// Test removing a non-existing member
+	if z.Remove("c") {
+		t.Error("Expected Remove to return false for a non-existing member")
+	}
+	if z.Len() != 1 {
+		t.Errorf("Expected length 1, but got %d", z.Len())
+	}
+}
+
+func TestRank(t *testing.T) {
+	z := NewZSet()
+	z.Add("c", 3)
+	z.Add("a", 1)
+	z.Add("b", 2)
+	// Equal scores are ordered by member
+	z.Add("bb", 2)
+
+	expected := map[string]int{"a": 0, "b": 1, "bb": 2, "c": 3}
+	for member, rank := range expected {
+		if got, _ := z.Rank(member, false); got != rank {
+			t.Errorf("Expected rank %d for %s, but got %d", rank, member, got)
+		}
+		if got, _ := z.Rank(member, true); got != 3-rank {
+			t.Errorf("Expected reverse rank %d for %s, but got %d", 3-rank, member, got)
+		}
+	}
+
+	if _, ok := z.Rank("missing", false); ok {
+		t.Error("Got rank of a non-existing member")
+	}
+}
+
+func TestRangeByScore(t *testing.T) {
+	z := NewZSet()
+	for i := 1; i <= 5; i++ {
+		z.Add(strconv.Itoa(i), float64(i))
+	}
+
+	got := members(z.RangeByScore(Range{Min: 2, Max: 4}, 0, -1, false))
+	if !reflect.DeepEqual(got, []string{"2", "3", "4"}) {
+		t.Errorf("Expected [2 3 4], but got %v", got)
+	}
+
+	got = members(z.RangeByScore(Range{Min: 2, Max: 4, MinExclusive: true}, 0, -1, true))
+	if !reflect.DeepEqual(got, []string{"4", "3"}) {
+		t.Errorf("Expected [4 3], but got %v", got)
+	}
+
+	// Test offset and count
+	got = members(z.RangeByScore(Range{Min: 1, Max: 5}, 1, 2, false))
+	if !reflect.DeepEqual(got, []string{"2", "3"}) {
+		t.Errorf("Expected [2 3], but got %v", got)
+	}
+
+	if count := z.Count(Range{Min: 1.5, Max: 5, MaxExclusive: true}); count != 3 {
+		t.Errorf("Expected count 3, but got %d", count)
+	}
+	if count := z.Count(Range{Min: 6, Max: 7}); count != 0 {
+		t.Errorf("Expected count 0, but got %d", count)
+	}
+}
+
+func TestRangeByLex(t *testing.T) {
+	z := NewZSet()
+	for _, m := range []string{"a", "b", "c", "d"} {
+		z.Add(m, 0)
+	}
+
+	got := members(z.RangeByLex(LexRange{Min: "b", MaxInf: true}, 0, -1, false))
+	if !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Errorf("Expected [b c d], but got %v", got)
+	}
+
+	got = members(z.RangeByLex(LexRange{MinInf: true, Max: "c", MaxExclusive: true}, 0, -1, true))
+	if !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("Expected [b a], but got %v", got)
+	}
+}
+
+func TestPop(t *testing.T) {
+	z := NewZSet()
+	z.Add("a", 1)
+	z.Add("b", 2)
+	z.Add("c", 3)
+
+	if got := members(z.PopMin(2)); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Expected [a b], but got %v", got)
+	}
+	if got := members(z.PopMax(5)); !reflect.DeepEqual(got, []string{"c"}) {
+		t.Errorf("Expected [c], but got %v", got)
+	}
+	if z.Len() != 0 {
+		t.Errorf("Expected length 0, but got %d", z.Len())
+	}
+}
+
+func TestClone(t *testing.T) {
+	z := NewZSet()
+	z.Add("a", 1)
+	z.Add("b", 2)
+
+	clone := z.Clone()
+	z.Remove("a")
+	clone.Add("c", 0)
+
+	if got := members(clone.RangeByRank(0, clone.Len()-1, false)); !reflect.DeepEqual(got, []string{"c", "a", "b"}) {
+		t.Errorf("Expected [c a b], but got %v", got)
+	}
+	if z.Len() != 1 {
+		t.Errorf("Expected length 1, but got %d", z.Len())
+	}
+}
+
+func TestRandomOperations(t *testing.T) {
+	z := NewZSet()
+	scores := map[string]float64{}
+
+	for i := 0; i < 2000; i++ {
+		member := strconv.Itoa(rand.IntN(500))
+		if rand.IntN(4) == 0 {
+			z.Remove(member)
+			delete(scores, member)
+		} else {
+			score := float64(rand.IntN(100))
+			z.Add(member, score)
+			scores[member] = score
+		}
+	}
+
+	// Compare against the same elements sorted by score and member
+	expected := []string{}
+	for m := range scores {
+		expected = append(expected, m)
+	}
+	slices.SortFunc(expected, func(a, b string) int {
+		if scores[a] != scores[b] {
+			if scores[a] < scores[b] {
+				return -1
+			}
+			return 1
+		}
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+		return 0
+	})
+
+	if z.Len() != len(expected) {
+		t.Fatalf("Expected length %d, but got %d", len(expected), z.Len())
+	}
+	if got := members(z.RangeByRank(0, z.Len()-1, false)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, but got %v", expected, got)
+	}
+	for i, m := range expected {
+		if rank, _ := z.Rank(m, false); rank != i {
+			t.Errorf("Expected rank %d for %s, but got %d", i, m, rank)
+		}
+	}
+}